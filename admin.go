@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+// runAdmin implements the "chirpy admin grant|revoke <email>" subcommand,
+// which sets whether a user can use the moderation endpoints. With the json
+// store the server must not be running, or it will overwrite the change.
+func runAdmin(args []string) {
+	flags := flag.NewFlagSet("admin", flag.ExitOnError)
+	store := flags.String("store", "json", "Storage backend (json or sqlite)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chirpy admin [--store json|sqlite] grant|revoke <email>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 || (flags.Arg(0) != "grant" && flags.Arg(0) != "revoke") {
+		flags.Usage()
+		os.Exit(2)
+	}
+	grant := flags.Arg(0) == "grant"
+	email := flags.Arg(1)
+
+	db, err := openStore(*store, model.DBConfig{}, false)
+	if err != nil {
+		log.Fatal(err)
+	}
+	user, err := db.SetUserAdmin(email, grant)
+	if closeErr := db.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if grant {
+		fmt.Printf("%s (user %d) is now an admin\n", user.Email, user.ID)
+	} else {
+		fmt.Printf("%s (user %d) is no longer an admin\n", user.Email, user.ID)
+	}
+}
@@ -0,0 +1,175 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+// errMissingToken is returned when a request has no usable Authorization
+// header, as opposed to one with a bad token.
+var errMissingToken = errors.New("missing bearer token")
+
+// Principal is the verified caller of an authenticated request.
+type Principal struct {
+	UserID int
+	// Scopes are the scopes the token was limited to, if any.
+	Scopes []string
+	// TokenID is the ID (jti) of the token the request was made with.
+	TokenID string
+	// SessionID is the session the token was issued for.
+	SessionID int
+	// ClientID is the OAuth client a delegated token was issued to. It is
+	// empty for tokens issued at login.
+	ClientID string
+}
+
+// HasScope reports whether the caller may act within scope. Tokens issued
+// at login may do anything; delegated tokens only what they were granted.
+func (p Principal) HasScope(scope string) bool {
+	if p.ClientID == "" {
+		return true
+	}
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type principalKey struct{}
+
+// PrincipalFromContext returns the caller put on the context by
+// RequireAuth, OptionalAuth or RequireAdmin.
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	principal, ok := ctx.Value(principalKey{}).(Principal)
+	return principal, ok
+}
+
+// callerID returns the ID of the caller of r, or zero if it is anonymous.
+// Handlers behind RequireAuth can rely on it being set.
+func callerID(r *http.Request) int {
+	principal, _ := PrincipalFromContext(r.Context())
+	return principal.UserID
+}
+
+// bearerToken returns the token from a "Bearer <token>" Authorization header.
+func bearerToken(r *http.Request) (string, error) {
+	scheme, token, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") || token == "" {
+		return "", errMissingToken
+	}
+	return token, nil
+}
+
+// authenticate validates the access token sent with r and returns the
+// caller it was issued to.
+func (cfg ApiConfig) authenticate(r *http.Request) (Principal, error) {
+	tokenString, err := bearerToken(r)
+	if err != nil {
+		return Principal{}, err
+	}
+	claims, err := model.ValidateAccessToken(tokenString, cfg.Keys)
+	if err != nil {
+		return Principal{}, err
+	}
+	id, err := claims.UserID()
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{
+		UserID:    id,
+		Scopes:    claims.Scopes(),
+		TokenID:   claims.ID,
+		SessionID: claims.SessionID,
+		ClientID:  claims.ClientID,
+	}, nil
+}
+
+// respondUnauthorized writes the 401 response for a request whose token is
+// missing or fails err, with the WWW-Authenticate challenge of RFC 6750.
+func respondUnauthorized(w http.ResponseWriter, err error) {
+	if errors.Is(err, errMissingToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy"`)
+		respondWithError(w, http.StatusUnauthorized, "Missing bearer token")
+		return
+	}
+	w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="invalid_token"`)
+	respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+}
+
+// RequireAuth rejects requests without a valid access token and puts the
+// caller on the context of the rest.
+func (cfg ApiConfig) RequireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if err != nil {
+			respondUnauthorized(w, err)
+			return
+		}
+		ctx := context.WithValue(r.Context(), principalKey{}, principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// OptionalAuth puts the caller on the context when the request has a valid
+// access token. Requests without one, or with a bad one, are served as
+// anonymous.
+func (cfg ApiConfig) OptionalAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if err == nil {
+			r = r.WithContext(context.WithValue(r.Context(), principalKey{}, principal))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope rejects requests whose delegated token wasn't granted scope.
+// It goes after RequireAuth.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, _ := PrincipalFromContext(r.Context())
+			if !principal.HasScope(scope) {
+				w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="chirpy", error="insufficient_scope", scope=%q`, scope))
+				respondWithError(w, http.StatusForbidden, fmt.Sprintf("Token lacks the %s scope", scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireFirstParty rejects delegated tokens, keeping OAuth clients away
+// from account settings, sessions and the like. It goes after RequireAuth.
+func RequireFirstParty(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		if principal.ClientID != "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="chirpy", error="insufficient_scope"`)
+			respondWithError(w, http.StatusForbidden, "Not available to OAuth clients")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireAdmin is RequireAuth for routes only admins may use. Delegated
+// tokens are refused even when issued to an admin.
+func (cfg ApiConfig) RequireAdmin(next http.Handler) http.Handler {
+	return cfg.RequireAuth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		user, err := cfg.DB.GetUser(principal.UserID)
+		if err != nil || !user.IsAdmin || principal.ClientID != "" {
+			respondWithError(w, http.StatusForbidden, "Forbidden request")
+			return
+		}
+		next.ServeHTTP(w, r)
+	}))
+}
@@ -2,51 +2,97 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
-	"strings"
+	"time"
 
 	"github.com/christopherplain/chirpy/internal/model"
 	"github.com/go-chi/chi/v5"
 )
 
-func (cfg ApiConfig) HandleGetChirp(w http.ResponseWriter, r *http.Request) {
-	param := chi.URLParam(r, "id")
-	id, err := strconv.Atoi(param)
-	if err != nil {
-		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
-		return
+// ChirpRespBody is a chirp as returned to a particular caller.
+type ChirpRespBody struct {
+	model.Chirp
+	Attachments []AttachmentRespBody `json:"attachments,omitempty"`
+	Liked       bool                 `json:"liked"`
+}
+
+type ChirpReqBody struct {
+	Body        string `json:"body"`
+	InReplyToID int    `json:"in_reply_to_id"`
+	MediaIDs    []int  `json:"media_ids"`
+	// PublishAt and Draft hold the chirp back as a pending chirp.
+	PublishAt *time.Time `json:"publish_at"`
+	Draft     bool       `json:"draft"`
+}
+
+// chirpRespBodies adds the caller-specific fields to chirps. viewerID is zero
+// for anonymous callers.
+func (cfg ApiConfig) chirpRespBodies(chirps []model.Chirp, viewerID int) ([]ChirpRespBody, error) {
+	liked := map[int]bool{}
+	if viewerID != 0 {
+		ids := make([]int, 0, len(chirps))
+		for _, chirp := range chirps {
+			ids = append(ids, chirp.ID)
+		}
+		var err error
+		liked, err = cfg.DB.GetLikedChirps(viewerID, ids)
+		if err != nil {
+			return nil, err
+		}
 	}
 
-	chirp, err := cfg.DB.GetChirp(id)
+	respBody := make([]ChirpRespBody, 0, len(chirps))
+	for _, chirp := range chirps {
+		respBody = append(respBody, ChirpRespBody{
+			Chirp:       chirp,
+			Attachments: attachmentRespBodies(chirp.Attachments),
+			Liked:       liked[chirp.ID],
+		})
+	}
+	return respBody, nil
+}
+
+func (cfg ApiConfig) respondWithChirps(w http.ResponseWriter, code int, chirps []model.Chirp, viewerID int) {
+	respBody, err := cfg.chirpRespBodies(chirps, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusNotFound, err.Error())
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
 	}
-
-	respondWithJSON(w, http.StatusOK, chirp)
+	respondWithJSON(w, code, respBody)
 }
 
-func (cfg ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
-	tokenString := strings.Split(r.Header.Get("Authorization"), " ")[1]
-	token, err := model.ValidateJWT(tokenString, cfg.JwtSecret)
+func (cfg ApiConfig) respondWithChirp(w http.ResponseWriter, code int, chirp model.Chirp, viewerID int) {
+	respBody, err := cfg.chirpRespBodies([]model.Chirp{chirp}, viewerID)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirp")
 		return
 	}
+	respondWithJSON(w, code, respBody[0])
+}
 
-	idString, err := token.Claims.GetSubject()
+func (cfg ApiConfig) HandleGetChirp(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(param)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
-	userID, err := strconv.Atoi(idString)
+
+	chirp, err := cfg.DB.GetChirp(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
+	cfg.respondWithChirp(w, http.StatusOK, chirp, callerID(r))
+}
+
+func (cfg ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
 	param := chi.URLParam(r, "id")
 	id, err := strconv.Atoi(param)
 	if err != nil {
@@ -62,53 +108,116 @@ func (cfg ApiConfig) HandleDeleteChirp(w http.ResponseWriter, r *http.Request) {
 
 	if userID != chirp.AuthorID {
 		respondWithError(w, http.StatusForbidden, "Forbidden request")
+		return
 	}
 
 	err = cfg.DB.DeleteChirp(id)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
 	}
 
 	respondWithJSON(w, http.StatusOK, struct{}{})
 }
 
 func (cfg ApiConfig) HandleGetChirps(w http.ResponseWriter, r *http.Request) {
-	var authorID *int
-	authorIDQuery, err := strconv.Atoi(r.URL.Query().Get("author_id"))
-	if err == nil {
-		*authorID = authorIDQuery
-	}
-
-	sort := "asc"
-	sortQuery := r.URL.Query().Get("sort")
-	if sortQuery == "desc" {
-		sort = "desc"
+	q, err := parseChirpQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
 	}
 
-	chirps, err := cfg.DB.GetChirps(authorID, sort)
+	chirps, err := fetchPage(w, r, q, cfg.DB.GetChirps)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
 		return
 	}
-	respondWithJSON(w, http.StatusOK, chirps)
+	cfg.respondWithChirps(w, http.StatusOK, chirps, callerID(r))
 }
 
 func (cfg *ApiConfig) HandlePostChirp(w http.ResponseWriter, r *http.Request) {
-	tokenString := strings.Split(r.Header.Get("Authorization"), " ")[1]
-	token, err := model.ValidateJWT(tokenString, cfg.JwtSecret)
+	id := callerID(r)
+
+	reqBody := ChirpReqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding request body: %s", err)
+		respondWithError(w, http.StatusInternalServerError, msg)
+		return
+	}
+
+	if !cfg.validateChirpBody(w, id, reqBody.Body) {
+		return
+	}
+	verdict := cfg.Moderator.Moderate(reqBody.Body)
+	if verdict.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp was rejected by moderation")
+		return
+	}
+
+	if reqBody.InReplyToID != 0 {
+		if _, err := cfg.DB.GetChirp(reqBody.InReplyToID); err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid in_reply_to_id: "+err.Error())
+			return
+		}
+	}
+
+	if reqBody.PublishAt != nil || reqBody.Draft {
+		cfg.createPendingChirp(w, model.PendingChirp{
+			AuthorID:    id,
+			Body:        verdict.Body,
+			InReplyToID: reqBody.InReplyToID,
+			MediaIDs:    reqBody.MediaIDs,
+			Flagged:     verdict.Flagged,
+			Draft:       reqBody.Draft,
+			PublishAt:   reqBody.PublishAt,
+		})
+		return
+	}
+
+	savedChirp, err := cfg.DB.CreateChirp(model.ChirpParams{
+		Body:        verdict.Body,
+		AuthorID:    id,
+		InReplyToID: reqBody.InReplyToID,
+		Flagged:     verdict.Flagged,
+		MediaIDs:    reqBody.MediaIDs,
+	})
+	if errors.Is(err, model.ErrInvalidMedia) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
 		return
 	}
+	cfg.Previews.Enqueue(savedChirp)
+
+	cfg.respondWithChirp(w, http.StatusCreated, savedChirp, id)
+}
+
+func (cfg ApiConfig) HandlePatchChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
 
-	idString, err := token.Claims.GetSubject()
+	param := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(param)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
-	id, err := strconv.Atoi(idString)
+
+	chirp, err := cfg.DB.GetChirp(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if userID != chirp.AuthorID {
+		respondWithError(w, http.StatusForbidden, "Forbidden request")
+		return
+	}
+	if time.Since(chirp.CreatedAt) > cfg.ChirpEditWindow {
+		respondWithError(w, http.StatusForbidden, "Chirp can no longer be edited")
 		return
 	}
 
@@ -121,16 +230,54 @@ func (cfg *ApiConfig) HandlePostChirp(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err = model.ValidateChirp(reqBody.Body); err != nil {
+	if !cfg.validateChirpBody(w, userID, reqBody.Body) {
+		return
+	}
+	verdict := cfg.Moderator.Moderate(reqBody.Body)
+	if verdict.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp was rejected by moderation")
+		return
+	}
+
+	updatedChirp, err := cfg.DB.UpdateChirp(id, verdict.Body, verdict.Flagged)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp")
+		return
+	}
+	cfg.Previews.Enqueue(updatedChirp)
+
+	cfg.respondWithChirp(w, http.StatusOK, updatedChirp, userID)
+}
+
+// validateChirpBody checks body against the length limit for the author's
+// account tier. It writes the error response and returns false if the body
+// is too long.
+func (cfg ApiConfig) validateChirpBody(w http.ResponseWriter, authorID int, body string) bool {
+	author, err := cfg.DB.GetUser(authorID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return false
+	}
+	if err := model.ValidateChirp(body, cfg.ChirpLimits.MaxLength(author)); err != nil {
 		respondWithError(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func (cfg ApiConfig) HandleGetChirpHistory(w http.ResponseWriter, r *http.Request) {
+	param := chi.URLParam(r, "id")
+	id, err := strconv.Atoi(param)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
 		return
 	}
 
-	savedChirp, err := cfg.DB.CreateChirp(reqBody.Body, id)
+	revisions, err := cfg.DB.GetChirpHistory(id)
 	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		respondWithError(w, http.StatusNotFound, err.Error())
 		return
 	}
 
-	respondWithJSON(w, http.StatusCreated, savedChirp)
+	respondWithJSON(w, http.StatusOK, revisions)
 }
@@ -1,10 +1,30 @@
 package api
 
-import "github.com/christopherplain/chirpy/internal/model"
+import (
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/keys"
+	"github.com/christopherplain/chirpy/internal/media"
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/moderation"
+	"github.com/christopherplain/chirpy/internal/oidc"
+)
 
 type ApiConfig struct {
-	DB             *model.DB
-	FileserverHits int
-	JwtSecret      string
-	PolkaKey       string
+	DB                 model.Store
+	FileserverHits     int
+	Keys               *keys.Ring
+	Issuer             string
+	PolkaKey           string
+	ChirpEditWindow    time.Duration
+	ChirpRestoreWindow time.Duration
+	RefreshTokenTTL    time.Duration
+	ChirpLimits        model.ChirpLimits
+	Moderator          moderation.Moderator
+	Blobs              media.BlobStore
+	MaxUploadBytes     int64
+	MaxImportBytes     int64
+	Previews           *PreviewWorker
+	// OIDC is the external provider users can sign in with, if any.
+	OIDC *oidc.Provider
 }
@@ -0,0 +1,89 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/keys"
+	"github.com/christopherplain/chirpy/internal/media"
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/moderation"
+)
+
+// newTestConfig returns a config with a fresh JSON database and blob store,
+// an EdDSA signing key, and otherwise the settings main uses by default.
+func newTestConfig(t *testing.T) ApiConfig {
+	t.Helper()
+	dir := t.TempDir()
+	db, err := model.NewDB(filepath.Join(dir, "database.json"), model.DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	blobs, err := media.NewLocalStore(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDir := filepath.Join(dir, "keys")
+	if _, err := keys.Generate(keyDir, "EdDSA"); err != nil {
+		t.Fatal(err)
+	}
+	ring, err := keys.NewRing(keyDir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ApiConfig{
+		DB:                 db,
+		Keys:               ring,
+		Issuer:             "https://chirpy.example",
+		RefreshTokenTTL:    60 * 24 * time.Hour,
+		ChirpEditWindow:    15 * time.Minute,
+		ChirpRestoreWindow: 7 * 24 * time.Hour,
+		ChirpLimits:        model.DefaultChirpLimits,
+		Moderator:          moderation.Default(),
+		Blobs:              blobs,
+		MaxUploadBytes:     1 << 20,
+		MaxImportBytes:     10 << 20,
+	}
+}
+
+// createUser creates a user and logs them in, returning the user and their
+// access token.
+func createUser(t *testing.T, cfg ApiConfig, email string) (model.User, string) {
+	t.Helper()
+	user, err := cfg.DB.CreateUser(email, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	reqBody, err := json.Marshal(UserReqBody{Email: email, Password: "password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := httptest.NewRecorder()
+	cfg.HandleUserLogin(w, httptest.NewRequest("POST", "/api/login", bytes.NewReader(reqBody)))
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	respBody := UserRespBody{}
+	if err := json.NewDecoder(w.Body).Decode(&respBody); err != nil {
+		t.Fatal(err)
+	}
+	return user, respBody.Token
+}
+
+// serve runs handler behind RequireAuth, as the router does, for req made
+// with token, which may be empty.
+func serve(cfg ApiConfig, handler http.HandlerFunc, req *http.Request, token string) *httptest.ResponseRecorder {
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	cfg.RequireAuth(handler).ServeHTTP(w, req)
+	return w
+}
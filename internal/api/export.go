@@ -0,0 +1,506 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/media"
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+// exportVersion is the version of the export format. Imports of other
+// versions are refused.
+const exportVersion = 1
+
+// exportFileName is the name of the records file in a ZIP export. The
+// attached media sit next to it under media/.
+const exportFileName = "chirpy-export.jsonl"
+
+// exportPageSize is how many chirps are read from the store at a time while
+// exporting.
+const exportPageSize = 100
+
+// ExportRecord is one line of an export. The first record is the profile,
+// followed by the user's chirps, oldest first, then the users they follow
+// and the users following them.
+type ExportRecord struct {
+	// Type is "profile", "chirp", "following" or "follower", and says which
+	// of the other fields is set.
+	Type    string         `json:"type"`
+	Version int            `json:"version,omitempty"`
+	Profile *ExportProfile `json:"profile,omitempty"`
+	Chirp   *ExportChirp   `json:"chirp,omitempty"`
+	User    *ExportUser    `json:"user,omitempty"`
+}
+
+type ExportProfile struct {
+	ID          int    `json:"id"`
+	Email       string `json:"email"`
+	Handle      string `json:"handle,omitempty"`
+	IsChirpyRed bool   `json:"is_chirpy_red"`
+}
+
+type ExportChirp struct {
+	ID          int                `json:"id"`
+	Body        string             `json:"body"`
+	CreatedAt   time.Time          `json:"created_at"`
+	UpdatedAt   time.Time          `json:"updated_at"`
+	InReplyToID int                `json:"in_reply_to_id,omitempty"`
+	Attachments []model.Attachment `json:"attachments,omitempty"`
+}
+
+type ExportUser struct {
+	ID     int    `json:"id"`
+	Email  string `json:"email"`
+	Handle string `json:"handle,omitempty"`
+}
+
+type ImportRespBody struct {
+	Chirps  int `json:"chirps"`
+	Skipped int `json:"skipped"`
+	Follows int `json:"follows"`
+	Media   int `json:"media"`
+	// IDs maps the chirp IDs in the export to the IDs of the new chirps.
+	IDs map[int]int `json:"ids"`
+	// Error is set when the import failed partway. The other fields then
+	// say what was imported before it failed.
+	Error string `json:"error,omitempty"`
+}
+
+func exportUser(user model.User) *ExportUser {
+	return &ExportUser{ID: user.ID, Email: user.Email, Handle: user.Handle}
+}
+
+// HandleExportUser streams the caller's profile, chirps and follows as JSON
+// Lines, or with ?format=zip as a ZIP archive that also holds the images
+// attached to the chirps.
+func (cfg ApiConfig) HandleExportUser(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "jsonl" && format != "zip" {
+		respondWithError(w, http.StatusBadRequest, "format must be jsonl or zip")
+		return
+	}
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	if format != "zip" {
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+exportFileName+`"`)
+		w.WriteHeader(http.StatusOK)
+		if _, err := cfg.writeExport(w, user); err != nil {
+			log.Printf("Error exporting user %d: %s\n", userID, err)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="chirpy-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	if err := cfg.writeExportZip(w, user); err != nil {
+		log.Printf("Error exporting user %d: %s\n", userID, err)
+	}
+}
+
+// writeExport writes user's records to w and returns the keys of the media
+// attached to their chirps. Once the response has started there is no way
+// to report an error to the client, so errors cut the export short.
+func (cfg ApiConfig) writeExport(w io.Writer, user model.User) ([]string, error) {
+	encoder := json.NewEncoder(w)
+	err := encoder.Encode(ExportRecord{
+		Type:    "profile",
+		Version: exportVersion,
+		Profile: &ExportProfile{
+			ID:          user.ID,
+			Email:       user.Email,
+			Handle:      user.Handle,
+			IsChirpyRed: user.IsChirpyRed,
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	keys := []string{}
+	q := model.ChirpQuery{AuthorID: &user.ID, Order: "asc", Limit: exportPageSize}
+	for {
+		chirps, err := cfg.DB.GetChirps(q)
+		if err != nil {
+			return nil, err
+		}
+		for _, chirp := range chirps {
+			err := encoder.Encode(ExportRecord{
+				Type: "chirp",
+				Chirp: &ExportChirp{
+					ID:          chirp.ID,
+					Body:        chirp.Body,
+					CreatedAt:   chirp.CreatedAt,
+					UpdatedAt:   chirp.UpdatedAt,
+					InReplyToID: chirp.InReplyToID,
+					Attachments: chirp.Attachments,
+				},
+			})
+			if err != nil {
+				return nil, err
+			}
+			for _, attachment := range chirp.Attachments {
+				keys = append(keys, attachment.Key)
+			}
+		}
+		if len(chirps) < exportPageSize {
+			break
+		}
+		q.AfterID = chirps[len(chirps)-1].ID
+	}
+
+	following, err := cfg.DB.GetFollowing(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range following {
+		if err := encoder.Encode(ExportRecord{Type: "following", User: exportUser(u)}); err != nil {
+			return nil, err
+		}
+	}
+	followers, err := cfg.DB.GetFollowers(user.ID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range followers {
+		if err := encoder.Encode(ExportRecord{Type: "follower", User: exportUser(u)}); err != nil {
+			return nil, err
+		}
+	}
+	return keys, nil
+}
+
+func (cfg ApiConfig) writeExportZip(w io.Writer, user model.User) error {
+	archive := zip.NewWriter(w)
+	records, err := archive.Create(exportFileName)
+	if err != nil {
+		return err
+	}
+	keys, err := cfg.writeExport(records, user)
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		blob, err := cfg.Blobs.Open(key)
+		if err != nil {
+			// The record still names the attachment; only its content is
+			// missing.
+			log.Printf("Error exporting media %s: %s\n", key, err)
+			continue
+		}
+		// Images are already compressed.
+		file, err := archive.CreateHeader(&zip.FileHeader{Name: "media/" + key, Method: zip.Store})
+		if err == nil {
+			_, err = io.Copy(file, blob)
+		}
+		blob.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// HandleImportUser recreates the chirps and follows of an export under the
+// caller's account. The body is the JSON Lines file, or the ZIP archive
+// when sent as application/zip. Chirps get new IDs and keep their creation
+// time as far as importTime allows; replies to chirps outside the export
+// become top-level chirps. Chirps that are too long for the caller's
+// account, rejected by moderation or whose media can't be restored are
+// skipped. Followers can't be imported, and followed users are matched by
+// handle.
+//
+// The whole import is read and checked before anything is saved. If saving
+// fails partway, the error response still holds the counts and IDs of what
+// was imported, so the client can retry with the rest.
+func (cfg ApiConfig) HandleImportUser(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	user, err := cfg.DB.GetUser(userID)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxImportBytes)
+	var records io.Reader = r.Body
+	var archive *zip.Reader
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/zip") {
+		data, err := io.ReadAll(r.Body)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Import is too large")
+			return
+		}
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Couldn't read import")
+			return
+		}
+		archive, err = zip.NewReader(bytes.NewReader(data), int64(len(data)))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid ZIP archive")
+			return
+		}
+		file, err := archive.Open(exportFileName)
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Archive is missing "+exportFileName)
+			return
+		}
+		defer file.Close()
+		records = file
+	}
+
+	decoder := json.NewDecoder(bufio.NewReader(records))
+	first := ExportRecord{}
+	if err := decoder.Decode(&first); err != nil || first.Type != "profile" || first.Profile == nil {
+		respondWithError(w, http.StatusBadRequest, "Import must start with a profile record")
+		return
+	}
+	if first.Version != exportVersion {
+		msg := fmt.Sprintf("Unsupported export version %d", first.Version)
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	latest, err := cfg.DB.GetChirps(model.ChirpQuery{AuthorID: &userID, Order: "desc", Limit: 1})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+	floor := time.Time{}
+	if len(latest) > 0 {
+		floor = latest[0].CreatedAt
+	}
+	now := time.Now().UTC()
+
+	respBody := ImportRespBody{IDs: map[int]int{}}
+	chirps := []importChirp{}
+	followees := []string{}
+	for {
+		record := ExportRecord{}
+		err := decoder.Decode(&record)
+		if err == io.EOF {
+			break
+		}
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondWithError(w, http.StatusRequestEntityTooLarge, "Import is too large")
+			return
+		}
+		if err != nil {
+			msg := fmt.Sprintf("Error decoding import: %s", err)
+			respondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		switch {
+		case record.Type == "chirp" && record.Chirp != nil:
+			chirp, ok := cfg.checkImportChirp(user, *record.Chirp, archive)
+			if !ok {
+				respBody.Skipped++
+				continue
+			}
+			chirp.createdAt = importTime(record.Chirp.CreatedAt, floor, now)
+			floor = chirp.createdAt
+			chirps = append(chirps, chirp)
+
+		case record.Type == "following" && record.User != nil && record.User.Handle != "":
+			followees = append(followees, record.User.Handle)
+		}
+	}
+
+	if user.Handle == "" && model.ValidateHandle(first.Profile.Handle) {
+		// Keep the user's handle if it's free here; losing it isn't worth
+		// failing the import over.
+		_, err := cfg.DB.UpdateUser(userID, "", "", first.Profile.Handle, nil)
+		if err != nil && !errors.Is(err, model.ErrHandleTaken) {
+			respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
+			return
+		}
+	}
+
+	for _, chirp := range chirps {
+		imported, err := cfg.saveImportChirp(userID, chirp, respBody.IDs)
+		if err != nil {
+			log.Printf("Error importing chirp %d: %s\n", chirp.exported.ID, err)
+			respondWithImportError(w, respBody, "Couldn't import chirp")
+			return
+		}
+		respBody.IDs[chirp.exported.ID] = imported.ID
+		respBody.Chirps++
+		respBody.Media += len(imported.Attachments)
+		cfg.Previews.Enqueue(imported)
+	}
+
+	for _, handle := range followees {
+		followee, err := cfg.DB.GetUserByHandle(handle)
+		if err != nil || followee.ID == userID {
+			continue
+		}
+		if err := cfg.DB.FollowUser(userID, followee.ID); err != nil {
+			log.Printf("Error importing follow of %s: %s\n", handle, err)
+			respondWithImportError(w, respBody, "Couldn't follow user")
+			return
+		}
+		respBody.Follows++
+	}
+
+	respondWithJSON(w, http.StatusOK, respBody)
+}
+
+// respondWithImportError reports an import that failed partway, along with
+// what was imported before it failed.
+func respondWithImportError(w http.ResponseWriter, respBody ImportRespBody, msg string) {
+	respBody.Error = msg
+	respondWithJSON(w, http.StatusInternalServerError, respBody)
+}
+
+// importTime returns the creation time of an imported chirp that was
+// created at t. Chirp IDs are handed out in order, so to keep the author's
+// chirps in the same order by ID and by time, t is moved forward to floor,
+// the time of the author's latest chirp, if it is earlier. Missing and
+// future times become now.
+func importTime(t time.Time, floor time.Time, now time.Time) time.Time {
+	if t.IsZero() || t.After(now) {
+		t = now
+	}
+	if t.Before(floor) {
+		t = floor
+	}
+	return t.UTC()
+}
+
+// importChirp is an exported chirp that passed the checks for importing.
+type importChirp struct {
+	exported  ExportChirp
+	body      string
+	flagged   bool
+	createdAt time.Time
+	media     []importMedia
+}
+
+// importMedia is an attachment read from the archive and sanitized.
+type importMedia struct {
+	data        []byte
+	contentType string
+}
+
+// checkImportChirp checks whether author can import the exported chirp and
+// reads its media from archive, which may be nil. It saves nothing and
+// reports false if the chirp should be skipped.
+func (cfg ApiConfig) checkImportChirp(author model.User, exported ExportChirp, archive *zip.Reader) (importChirp, bool) {
+	if model.ValidateChirp(exported.Body, cfg.ChirpLimits.MaxLength(author)) != nil {
+		return importChirp{}, false
+	}
+	verdict := cfg.Moderator.Moderate(exported.Body)
+	if verdict.Rejected {
+		return importChirp{}, false
+	}
+
+	chirp := importChirp{exported: exported, body: verdict.Body, flagged: verdict.Flagged}
+	if len(exported.Attachments) > 0 {
+		if archive == nil || len(exported.Attachments) > model.MaxAttachments {
+			return importChirp{}, false
+		}
+		for _, attachment := range exported.Attachments {
+			m, err := cfg.readImportMedia(archive, attachment.Key)
+			if err != nil {
+				log.Printf("Error importing media %s: %s\n", attachment.Key, err)
+				return importChirp{}, false
+			}
+			chirp.media = append(chirp.media, m)
+		}
+	}
+	return chirp, true
+}
+
+// saveImportChirp stores the media of chirp as new uploads by authorID and
+// creates the chirp. ids maps the exported chirp IDs imported so far to the
+// new ones.
+func (cfg ApiConfig) saveImportChirp(authorID int, chirp importChirp, ids map[int]int) (model.Chirp, error) {
+	mediaIDs := []int{}
+	for _, m := range chirp.media {
+		id, err := cfg.saveImportMedia(authorID, m)
+		if err != nil {
+			return model.Chirp{}, err
+		}
+		mediaIDs = append(mediaIDs, id)
+	}
+
+	return cfg.DB.CreateChirp(model.ChirpParams{
+		Body:        chirp.body,
+		AuthorID:    authorID,
+		InReplyToID: ids[chirp.exported.InReplyToID],
+		Flagged:     chirp.flagged,
+		MediaIDs:    mediaIDs,
+		CreatedAt:   chirp.createdAt,
+	})
+}
+
+// readImportMedia reads the image saved under key in archive, checking it
+// as HandlePostMedia would.
+func (cfg ApiConfig) readImportMedia(archive *zip.Reader, key string) (importMedia, error) {
+	if key == "" || path.Base(key) != key {
+		return importMedia{}, errors.New("invalid key")
+	}
+	file, err := archive.Open("media/" + key)
+	if err != nil {
+		return importMedia{}, err
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, cfg.MaxUploadBytes+1))
+	if err != nil {
+		return importMedia{}, err
+	}
+	if int64(len(data)) > cfg.MaxUploadBytes {
+		return importMedia{}, errors.New("file is too large")
+	}
+	data, contentType, err := media.Sanitize(data)
+	if err != nil {
+		return importMedia{}, err
+	}
+	return importMedia{data: data, contentType: contentType}, nil
+}
+
+// saveImportMedia stores m as a new upload by ownerID.
+func (cfg ApiConfig) saveImportMedia(ownerID int, m importMedia) (int, error) {
+	newKey, err := media.NewKey(media.Extensions[m.contentType])
+	if err != nil {
+		return 0, err
+	}
+	if err := cfg.Blobs.Put(newKey, bytes.NewReader(m.data)); err != nil {
+		return 0, err
+	}
+	saved, err := cfg.DB.CreateMedia(model.Media{
+		OwnerID:     ownerID,
+		Key:         newKey,
+		ContentType: m.contentType,
+		Size:        int64(len(m.data)),
+	})
+	if err != nil {
+		cfg.Blobs.Delete(newKey)
+		return 0, err
+	}
+	return saved.ID, nil
+}
@@ -0,0 +1,414 @@
+package api
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"image"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/media"
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/moderation"
+)
+
+func mustCreateChirp(t *testing.T, cfg ApiConfig, params model.ChirpParams) model.Chirp {
+	t.Helper()
+	chirp, err := cfg.DB.CreateChirp(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return chirp
+}
+
+func exportRecords(t *testing.T, data []byte) []ExportRecord {
+	t.Helper()
+	records := []ExportRecord{}
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		record := ExportRecord{}
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			t.Fatalf("export line %q: %s", scanner.Text(), err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+// importExport posts data to the import endpoint as contentType and returns
+// the decoded response.
+func importExport(t *testing.T, cfg ApiConfig, token string, contentType string, data []byte) ImportRespBody {
+	t.Helper()
+	req := httptest.NewRequest("POST", "/api/users/me/import", bytes.NewReader(data))
+	req.Header.Set("Content-Type", contentType)
+	w := serve(cfg, cfg.HandleImportUser, req, token)
+	if w.Code != http.StatusOK {
+		t.Fatalf("import: %d %s", w.Code, w.Body)
+	}
+	respBody := ImportRespBody{}
+	if err := json.NewDecoder(w.Body).Decode(&respBody); err != nil {
+		t.Fatal(err)
+	}
+	return respBody
+}
+
+func TestExportImportRoundTrip(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice, aliceToken := createUser(t, cfg, "alice@example.com")
+	bob, _ := createUser(t, cfg, "bob@example.com")
+	for user, handle := range map[int]string{alice.ID: "alice", bob.ID: "bob"} {
+		if _, err := cfg.DB.UpdateUser(user, "", "", handle, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	bobChirp := mustCreateChirp(t, cfg, model.ChirpParams{Body: "hi from bob", AuthorID: bob.ID})
+	first := mustCreateChirp(t, cfg, model.ChirpParams{Body: "first #go", AuthorID: alice.ID})
+	reply := mustCreateChirp(t, cfg, model.ChirpParams{Body: "replying to myself", AuthorID: alice.ID, InReplyToID: first.ID})
+	toBob := mustCreateChirp(t, cfg, model.ChirpParams{Body: "hi bob", AuthorID: alice.ID, InReplyToID: bobChirp.ID})
+	if err := cfg.DB.FollowUser(alice.ID, bob.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.DB.FollowUser(bob.ID, alice.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	w := serve(cfg, cfg.HandleExportUser, httptest.NewRequest("GET", "/api/users/me/export", nil), aliceToken)
+	if w.Code != http.StatusOK {
+		t.Fatalf("export: %d %s", w.Code, w.Body)
+	}
+	export := w.Body.Bytes()
+	records := exportRecords(t, export)
+	types := []string{}
+	for _, record := range records {
+		types = append(types, record.Type)
+	}
+	if got := strings.Join(types, " "); got != "profile chirp chirp chirp following follower" {
+		t.Fatalf("export records: %s", got)
+	}
+	if profile := records[0].Profile; profile.ID != alice.ID || profile.Handle != "alice" || records[0].Version != exportVersion {
+		t.Errorf("profile record = %+v", records[0])
+	}
+
+	carol, carolToken := createUser(t, cfg, "carol@example.com")
+	respBody := importExport(t, cfg, carolToken, "application/x-ndjson", export)
+	if respBody.Chirps != 3 || respBody.Skipped != 0 || respBody.Follows != 1 {
+		t.Errorf("import response = %+v", respBody)
+	}
+
+	for _, old := range []model.Chirp{first, reply, toBob} {
+		id, ok := respBody.IDs[old.ID]
+		if !ok {
+			t.Fatalf("no new ID for chirp %d", old.ID)
+		}
+		if id == old.ID {
+			t.Errorf("chirp %d kept its ID", old.ID)
+		}
+		chirp, err := cfg.DB.GetChirp(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if chirp.AuthorID != carol.ID || chirp.Body != old.Body || !chirp.CreatedAt.Equal(old.CreatedAt) {
+			t.Errorf("imported chirp = %+v, want a copy of %+v by carol", chirp, old)
+		}
+	}
+	// Replies within the export point at the new chirps; replies to anyone
+	// else's chirps become top-level chirps.
+	if chirp, _ := cfg.DB.GetChirp(respBody.IDs[reply.ID]); chirp.InReplyToID != respBody.IDs[first.ID] {
+		t.Errorf("the reply points at %d, want %d", chirp.InReplyToID, respBody.IDs[first.ID])
+	}
+	if chirp, _ := cfg.DB.GetChirp(respBody.IDs[toBob.ID]); chirp.InReplyToID != 0 {
+		t.Errorf("the reply to bob points at %d, want no parent", chirp.InReplyToID)
+	}
+
+	following, err := cfg.DB.GetFollowing(carol.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(following) != 1 || following[0].ID != bob.ID {
+		t.Errorf("carol follows %+v, want bob", following)
+	}
+	// Followers aren't imported, and the handle stays with alice.
+	if followers, _ := cfg.DB.GetFollowers(carol.ID); len(followers) != 0 {
+		t.Errorf("carol has followers %+v", followers)
+	}
+	if user, _ := cfg.DB.GetUser(carol.ID); user.Handle != "" {
+		t.Errorf("carol took the handle %q", user.Handle)
+	}
+}
+
+func TestImportSkipsChirps(t *testing.T) {
+	cfg := newTestConfig(t)
+	cfg.Moderator = moderation.NewWordList([]string{"fornax"}, moderation.ActionReject)
+	alice, token := createUser(t, cfg, "alice@example.com")
+
+	export := strings.Join([]string{
+		`{"type": "profile", "version": 1, "profile": {"id": 1, "email": "alice@example.org", "handle": "ally"}}`,
+		`{"type": "chirp", "chirp": {"id": 10, "body": "kept", "created_at": "2024-01-02T03:04:05Z"}}`,
+		`{"type": "chirp", "chirp": {"id": 11, "body": "` + strings.Repeat("a", 141) + `"}}`,
+		`{"type": "chirp", "chirp": {"id": 12, "body": "a fornax"}}`,
+		`{"type": "chirp", "chirp": {"id": 13, "body": "photo", "attachments": [{"id": 1, "key": "x.png"}]}}`,
+		`{"type": "chirp", "chirp": {"id": 14, "body": "reply to a skipped chirp", "in_reply_to_id": 11}}`,
+		`{"type": "following", "user": {"id": 5, "handle": "nobody"}}`,
+		`{"type": "unknown"}`,
+	}, "\n")
+	respBody := importExport(t, cfg, token, "application/x-ndjson", []byte(export))
+	if respBody.Chirps != 2 || respBody.Skipped != 3 || respBody.Follows != 0 {
+		t.Errorf("import response = %+v", respBody)
+	}
+	if _, ok := respBody.IDs[11]; ok {
+		t.Error("the skipped chirp got an ID")
+	}
+	if chirp, _ := cfg.DB.GetChirp(respBody.IDs[14]); chirp.InReplyToID != 0 {
+		t.Errorf("the reply to a skipped chirp points at %d", chirp.InReplyToID)
+	}
+	// A free handle comes along.
+	if user, _ := cfg.DB.GetUser(alice.ID); user.Handle != "ally" {
+		t.Errorf("handle = %q, want ally", user.Handle)
+	}
+}
+
+func TestImportRejects(t *testing.T) {
+	cfg := newTestConfig(t)
+	_, token := createUser(t, cfg, "alice@example.com")
+
+	for name, export := range map[string]string{
+		"empty":       "",
+		"not JSON":    "chirps",
+		"no profile":  `{"type": "chirp", "chirp": {"id": 1, "body": "hi"}}`,
+		"new version": `{"type": "profile", "version": 2, "profile": {"id": 1}}`,
+		"bad record":  "{\"type\": \"profile\", \"version\": 1, \"profile\": {\"id\": 1}}\n{\"type\":",
+	} {
+		req := httptest.NewRequest("POST", "/api/users/me/import", strings.NewReader(export))
+		if w := serve(cfg, cfg.HandleImportUser, req, token); w.Code != http.StatusBadRequest {
+			t.Errorf("%s: got %d, want 400", name, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest("POST", "/api/users/me/import", strings.NewReader("PK\x03\x04"))
+	req.Header.Set("Content-Type", "application/zip")
+	if w := serve(cfg, cfg.HandleImportUser, req, token); w.Code != http.StatusBadRequest {
+		t.Errorf("broken ZIP: got %d, want 400", w.Code)
+	}
+
+	req = httptest.NewRequest("POST", "/api/users/me/import", strings.NewReader(""))
+	if w := serve(cfg, cfg.HandleImportUser, req, ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("without a token: got %d, want 401", w.Code)
+	}
+}
+
+func TestImportTime(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	floor := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"kept", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)},
+		{"missing", time.Time{}, now},
+		{"future", now.Add(time.Hour), now},
+		{"before the floor", time.Date(2001, 1, 1, 0, 0, 0, 0, time.UTC), floor},
+	}
+	for _, tt := range tests {
+		if got := importTime(tt.t, floor, now); !got.Equal(tt.want) {
+			t.Errorf("%s: got %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestImportKeepsChirpOrder(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice, token := createUser(t, cfg, "alice@example.com")
+	existing := mustCreateChirp(t, cfg, model.ChirpParams{Body: "already here", AuthorID: alice.ID})
+
+	export := strings.Join([]string{
+		`{"type": "profile", "version": 1, "profile": {"id": 1}}`,
+		`{"type": "chirp", "chirp": {"id": 10, "body": "old", "created_at": "2020-01-02T03:04:05Z"}}`,
+		`{"type": "chirp", "chirp": {"id": 11, "body": "future", "created_at": "2999-01-01T00:00:00Z"}}`,
+		`{"type": "chirp", "chirp": {"id": 12, "body": "no date"}}`,
+	}, "\n")
+	respBody := importExport(t, cfg, token, "application/x-ndjson", []byte(export))
+	if respBody.Chirps != 3 {
+		t.Fatalf("import response = %+v", respBody)
+	}
+
+	// Ordered by ID, alice's chirps are ordered by time too, and none is
+	// dated after the import.
+	chirps, err := cfg.DB.GetChirps(model.ChirpQuery{AuthorID: &alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 4 || chirps[0].ID != existing.ID {
+		t.Fatalf("chirps = %+v", chirps)
+	}
+	for i, chirp := range chirps[1:] {
+		if chirp.CreatedAt.Before(chirps[i].CreatedAt) {
+			t.Errorf("chirp %d (%s) is dated before chirp %d (%s)", chirp.ID, chirp.CreatedAt, chirps[i].ID, chirps[i].CreatedAt)
+		}
+		if chirp.CreatedAt.After(time.Now()) || chirp.CreatedAt.Before(existing.CreatedAt) {
+			t.Errorf("chirp %q is dated %s, want between %s and now", chirp.Body, chirp.CreatedAt, existing.CreatedAt)
+		}
+	}
+}
+
+func TestImportChecksEverythingFirst(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice, token := createUser(t, cfg, "alice@example.com")
+	bob, _ := createUser(t, cfg, "bob@example.com")
+	if _, err := cfg.DB.UpdateUser(bob.ID, "", "", "bob", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// The broken last record is found before anything is saved.
+	export := strings.Join([]string{
+		`{"type": "profile", "version": 1, "profile": {"id": 1, "handle": "ally"}}`,
+		`{"type": "chirp", "chirp": {"id": 10, "body": "hi"}}`,
+		`{"type": "following", "user": {"id": 2, "handle": "bob"}}`,
+		`{"type": "chirp", "chirp": {"id": 11, "body": `,
+	}, "\n")
+	req := httptest.NewRequest("POST", "/api/users/me/import", strings.NewReader(export))
+	if w := serve(cfg, cfg.HandleImportUser, req, token); w.Code != http.StatusBadRequest {
+		t.Fatalf("got %d, want 400", w.Code)
+	}
+	if chirps, _ := cfg.DB.GetChirps(model.ChirpQuery{AuthorID: &alice.ID}); len(chirps) != 0 {
+		t.Errorf("the rejected import created chirps: %+v", chirps)
+	}
+	if following, _ := cfg.DB.GetFollowing(alice.ID); len(following) != 0 {
+		t.Errorf("the rejected import followed %+v", following)
+	}
+	if user, _ := cfg.DB.GetUser(alice.ID); user.Handle != "" {
+		t.Errorf("the rejected import set the handle %q", user.Handle)
+	}
+}
+
+// failingBlobs is a blob store that stops taking blobs after a number of
+// them.
+type failingBlobs struct {
+	media.BlobStore
+	puts int
+}
+
+func (b *failingBlobs) Put(key string, r io.Reader) error {
+	if b.puts == 0 {
+		return errors.New("disk full")
+	}
+	b.puts--
+	return b.BlobStore.Put(key, r)
+}
+
+func TestImportReportsPartialImport(t *testing.T) {
+	cfg := newTestConfig(t)
+	_, token := createUser(t, cfg, "alice@example.com")
+
+	img := &bytes.Buffer{}
+	if err := png.Encode(img, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	archive := &bytes.Buffer{}
+	zw := zip.NewWriter(archive)
+	records, err := zw.Create(exportFileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.WriteString(records, strings.Join([]string{
+		`{"type": "profile", "version": 1, "profile": {"id": 1}}`,
+		`{"type": "chirp", "chirp": {"id": 10, "body": "first", "attachments": [{"id": 1, "key": "a.png"}]}}`,
+		`{"type": "chirp", "chirp": {"id": 11, "body": "second", "attachments": [{"id": 2, "key": "a.png"}]}}`,
+	}, "\n"))
+	file, err := zw.Create("media/a.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	file.Write(img.Bytes())
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg.Blobs = &failingBlobs{BlobStore: cfg.Blobs, puts: 1}
+	req := httptest.NewRequest("POST", "/api/users/me/import", bytes.NewReader(archive.Bytes()))
+	req.Header.Set("Content-Type", "application/zip")
+	w := serve(cfg, cfg.HandleImportUser, req, token)
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("got %d, want 500", w.Code)
+	}
+	respBody := ImportRespBody{}
+	if err := json.NewDecoder(w.Body).Decode(&respBody); err != nil {
+		t.Fatal(err)
+	}
+	if respBody.Error == "" || respBody.Chirps != 1 || len(respBody.IDs) != 1 {
+		t.Fatalf("response = %+v, want an error and the first chirp", respBody)
+	}
+	if chirp, err := cfg.DB.GetChirp(respBody.IDs[10]); err != nil || chirp.Body != "first" {
+		t.Errorf("GetChirp(%d) = %+v, %v", respBody.IDs[10], chirp, err)
+	}
+}
+
+func TestExportImportZip(t *testing.T) {
+	cfg := newTestConfig(t)
+	alice, aliceToken := createUser(t, cfg, "alice@example.com")
+
+	img := &bytes.Buffer{}
+	if err := png.Encode(img, image.NewGray(image.Rect(0, 0, 4, 4))); err != nil {
+		t.Fatal(err)
+	}
+	const key = "0123456789abcdef0123456789abcdef.png"
+	if err := cfg.Blobs.Put(key, bytes.NewReader(img.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	upload, err := cfg.DB.CreateMedia(model.Media{OwnerID: alice.ID, Key: key, ContentType: "image/png", Size: int64(img.Len())})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chirp := mustCreateChirp(t, cfg, model.ChirpParams{Body: "look", AuthorID: alice.ID, MediaIDs: []int{upload.ID}})
+
+	w := serve(cfg, cfg.HandleExportUser, httptest.NewRequest("GET", "/api/users/me/export?format=zip", nil), aliceToken)
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "application/zip" {
+		t.Fatalf("export: %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+	archive := w.Body.Bytes()
+	r, err := zip.NewReader(bytes.NewReader(archive), int64(len(archive)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := []string{}
+	for _, file := range r.File {
+		names = append(names, file.Name)
+	}
+	if got := strings.Join(names, " "); got != exportFileName+" media/"+key {
+		t.Fatalf("archive holds %s", got)
+	}
+
+	_, carolToken := createUser(t, cfg, "carol@example.com")
+	respBody := importExport(t, cfg, carolToken, "application/zip", archive)
+	if respBody.Chirps != 1 || respBody.Media != 1 {
+		t.Fatalf("import response = %+v", respBody)
+	}
+	imported, err := cfg.DB.GetChirp(respBody.IDs[chirp.ID])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(imported.Attachments) != 1 || imported.Attachments[0].Key == key {
+		t.Fatalf("attachments = %+v, want a new copy of the image", imported.Attachments)
+	}
+	blob, err := cfg.Blobs.Open(imported.Attachments[0].Key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer blob.Close()
+	data, err := io.ReadAll(blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, img.Bytes()) {
+		t.Error("the imported image differs from the exported one")
+	}
+}
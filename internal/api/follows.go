@@ -0,0 +1,117 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+func (cfg ApiConfig) HandleFollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.parseFollowRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.DB.FollowUser(followerID, followeeID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't follow user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+func (cfg ApiConfig) HandleUnfollowUser(w http.ResponseWriter, r *http.Request) {
+	followerID, followeeID, ok := cfg.parseFollowRequest(w, r)
+	if !ok {
+		return
+	}
+
+	if err := cfg.DB.UnfollowUser(followerID, followeeID); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't unfollow user")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// parseFollowRequest checks the user named in the URL can be followed by the
+// caller. It writes the error response and returns
+// false if not.
+func (cfg ApiConfig) parseFollowRequest(w http.ResponseWriter, r *http.Request) (int, int, bool) {
+	followerID := callerID(r)
+
+	followeeID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return 0, 0, false
+	}
+	if followerID == followeeID {
+		respondWithError(w, http.StatusBadRequest, "Users can't follow themselves")
+		return 0, 0, false
+	}
+	if _, err := cfg.DB.GetUser(followeeID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return 0, 0, false
+	}
+
+	return followerID, followeeID, true
+}
+
+func (cfg ApiConfig) HandleGetFollowers(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithUserList(w, r, cfg.DB.GetFollowers)
+}
+
+func (cfg ApiConfig) HandleGetFollowing(w http.ResponseWriter, r *http.Request) {
+	cfg.respondWithUserList(w, r, cfg.DB.GetFollowing)
+}
+
+func (cfg ApiConfig) respondWithUserList(w http.ResponseWriter, r *http.Request, list func(int) ([]model.User, error)) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+
+	users, err := list(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respBody := make([]UserRespBody, 0, len(users))
+	for _, user := range users {
+		respBody = append(respBody, UserRespBody{
+			ID:          user.ID,
+			Email:       user.Email,
+			IsChirpyRed: user.IsChirpyRed,
+			Handle:      user.Handle,
+			IsAdmin:     user.IsAdmin,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, respBody)
+}
+
+func (cfg ApiConfig) HandleGetTimeline(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	q, err := parseChirpQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The timeline is newest first unless asked otherwise.
+	if r.URL.Query().Get("sort") == "" {
+		q.Order = "desc"
+	}
+
+	chirps, err := fetchPage(w, r, q, func(q model.ChirpQuery) ([]model.Chirp, error) {
+		return cfg.DB.GetTimeline(userID, q)
+	})
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve timeline")
+		return
+	}
+	cfg.respondWithChirps(w, http.StatusOK, chirps, userID)
+}
@@ -0,0 +1,11 @@
+package api
+
+import "net/http"
+
+// HandleJWKS publishes the public keys tokens are signed with.
+func (cfg ApiConfig) HandleJWKS(w http.ResponseWriter, r *http.Request) {
+	// Keep the cache short so a newly added key is picked up before many
+	// tokens signed with it are in circulation.
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, cfg.Keys.JWKS())
+}
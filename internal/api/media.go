@@ -0,0 +1,169 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/media"
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// mediaURLPrefix is where uploads are served from.
+const mediaURLPrefix = "/app/media/"
+
+type MediaRespBody struct {
+	ID          int    `json:"id"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size"`
+}
+
+type AttachmentRespBody struct {
+	ID          int    `json:"id"`
+	URL         string `json:"url"`
+	ContentType string `json:"content_type"`
+}
+
+func attachmentRespBodies(attachments []model.Attachment) []AttachmentRespBody {
+	if len(attachments) == 0 {
+		return nil
+	}
+	respBody := make([]AttachmentRespBody, 0, len(attachments))
+	for _, attachment := range attachments {
+		respBody = append(respBody, AttachmentRespBody{
+			ID:          attachment.ID,
+			URL:         mediaURLPrefix + attachment.Key,
+			ContentType: attachment.ContentType,
+		})
+	}
+	return respBody
+}
+
+// HandlePostMedia accepts an image uploaded as the "file" field of a
+// multipart form. The returned ID can be passed in media_ids when posting a
+// chirp.
+func (cfg ApiConfig) HandlePostMedia(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	// Leave room for the rest of the multipart body around the file.
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxUploadBytes+64*1024)
+	file, _, err := r.FormFile("file")
+	var maxBytesErr *http.MaxBytesError
+	if errors.As(err, &maxBytesErr) {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Missing file")
+		return
+	}
+	defer file.Close()
+
+	data, err := io.ReadAll(io.LimitReader(file, cfg.MaxUploadBytes+1))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Couldn't read file")
+		return
+	}
+	if int64(len(data)) > cfg.MaxUploadBytes {
+		respondWithError(w, http.StatusRequestEntityTooLarge, "File is too large")
+		return
+	}
+
+	data, contentType, err := media.Sanitize(data)
+	if errors.Is(err, media.ErrUnsupportedType) {
+		respondWithError(w, http.StatusUnsupportedMediaType, "Only JPEG, PNG and GIF images are supported")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid image")
+		return
+	}
+
+	key, err := media.NewKey(media.Extensions[contentType])
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store file")
+		return
+	}
+	if err := cfg.Blobs.Put(key, bytes.NewReader(data)); err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store file")
+		return
+	}
+
+	saved, err := cfg.DB.CreateMedia(model.Media{
+		OwnerID:     userID,
+		Key:         key,
+		ContentType: contentType,
+		Size:        int64(len(data)),
+	})
+	if err != nil {
+		cfg.Blobs.Delete(key)
+		respondWithError(w, http.StatusInternalServerError, "Couldn't store file")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, MediaRespBody{
+		ID:          saved.ID,
+		URL:         mediaURLPrefix + saved.Key,
+		ContentType: saved.ContentType,
+		Size:        saved.Size,
+	})
+}
+
+func (cfg ApiConfig) HandleGetMedia(w http.ResponseWriter, r *http.Request) {
+	key := chi.URLParam(r, "key")
+	contentType := ""
+	for t, ext := range media.Extensions {
+		if path.Ext(key) == ext {
+			contentType = t
+		}
+	}
+
+	blob, err := cfg.Blobs.Open(key)
+	if contentType == "" || err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	// Keys are random and never reused, so the content never changes.
+	w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+	io.Copy(w, blob)
+}
+
+// RunMediaJanitor deletes, every interval until ctx is done, the uploads
+// that have gone unattached for longer than maxAge: those never used in a
+// chirp and those whose chirp was deleted.
+func (cfg ApiConfig) RunMediaJanitor(ctx context.Context, interval time.Duration, maxAge time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := cfg.DB.PruneMedia(time.Now().Add(-maxAge))
+		if err != nil {
+			log.Printf("Error pruning media: %s\n", err)
+			continue
+		}
+		for _, m := range pruned {
+			if err := cfg.Blobs.Delete(m.Key); err != nil {
+				log.Printf("Error deleting media %s: %s\n", m.Key, err)
+			}
+		}
+		if len(pruned) > 0 {
+			log.Printf("Pruned %d unattached media\n", len(pruned))
+		}
+	}
+}
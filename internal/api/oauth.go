@@ -0,0 +1,472 @@
+package api
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+// authorizationCodeTTL is how long a client has to exchange an
+// authorization code for tokens.
+const authorizationCodeTTL = 5 * time.Minute
+
+// scopeDescriptions are what the consent page says each scope lets a client
+// do.
+var scopeDescriptions = map[string]string{
+	model.ScopeOpenID:      "Confirm who you are on Chirpy",
+	model.ScopeProfile:     "See your handle",
+	model.ScopeEmail:       "See your email address",
+	model.ScopeChirpsRead:  "Read your timeline and scheduled chirps",
+	model.ScopeChirpsWrite: "Post, edit and delete chirps, and like, rechirp, report and follow for you",
+}
+
+// authorizeParams are the parameters of an authorization request. The
+// consent form posts them back along with the user's decision.
+var authorizeParams = []string{
+	"response_type", "client_id", "redirect_uri", "scope", "state",
+	"code_challenge", "code_challenge_method", "nonce",
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Sign in with Chirpy</title>
+</head>
+<body>
+{{if .Params -}}
+<h1>Sign in to {{.ClientName}} with Chirpy</h1>
+{{if .Error}}<p role="alert">{{.Error}}</p>
+{{end -}}
+<p>{{.ClientName}} will be able to:</p>
+<ul>
+{{range .Scopes}}<li>{{.}}</li>
+{{end -}}
+</ul>
+<form method="post" action="authorize">
+{{range $name, $value := .Params}}<input type="hidden" name="{{$name}}" value="{{$value}}">
+{{end -}}
+<label>Email <input type="email" name="email" autocomplete="username" required></label>
+<label>Password <input type="password" name="password" autocomplete="current-password" required></label>
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny" formnovalidate>Deny</button>
+</form>
+{{- else -}}
+<h1>Sign in with Chirpy</h1>
+<p role="alert">{{.Error}}</p>
+{{- end}}
+</body>
+</html>
+`))
+
+type consentPage struct {
+	ClientName string
+	// Scopes describe the scopes the client asks for.
+	Scopes []string
+	// Params are the authorization request, carried through the form. The
+	// page only shows Error when they are empty.
+	Params map[string]string
+	Error  string
+}
+
+type OAuthTokenRespBody struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	Scope       string `json:"scope"`
+	// IDToken is issued when the openid scope was granted.
+	IDToken string `json:"id_token,omitempty"`
+}
+
+type UserInfoRespBody struct {
+	Subject string `json:"sub"`
+	model.UserClaims
+}
+
+// OpenIDConfiguration is the OpenID Connect discovery document.
+type OpenIDConfiguration struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+}
+
+// oauthError is an OAuth 2.0 error (RFC 6749), sent to the client in the
+// redirect from the authorization endpoint or in the token response.
+type oauthError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e oauthError) Error() string {
+	return e.Code + ": " + e.Description
+}
+
+// authorizeRequest is a validated authorization request.
+type authorizeRequest struct {
+	Client        model.OAuthClient
+	RedirectURI   string
+	Scopes        []string
+	State         string
+	CodeChallenge string
+	Nonce         string
+}
+
+// parseAuthorizeRequest validates the authorization request in r. Until the
+// client and redirect URI check out, errors can only be shown to the user.
+// After that the returned request has RedirectURI set, and errors are
+// oauthErrors to send back to the client.
+func (cfg ApiConfig) parseAuthorizeRequest(r *http.Request) (authorizeRequest, error) {
+	req := authorizeRequest{}
+	client, err := cfg.DB.GetOAuthClient(r.FormValue("client_id"))
+	if err != nil {
+		return req, errors.New("Unknown client")
+	}
+	redirectURI := r.FormValue("redirect_uri")
+	if !containsString(client.RedirectURIs, redirectURI) {
+		return req, errors.New("The redirect URI isn't registered for this client")
+	}
+	req.Client = client
+	req.RedirectURI = redirectURI
+	req.State = r.FormValue("state")
+
+	if r.FormValue("response_type") != "code" {
+		return req, oauthError{"unsupported_response_type", "Only the code response type is supported"}
+	}
+	req.CodeChallenge = r.FormValue("code_challenge")
+	if r.FormValue("code_challenge_method") != "S256" || !validCodeChallenge(req.CodeChallenge) {
+		return req, oauthError{"invalid_request", "PKCE with the S256 code challenge method is required"}
+	}
+	for _, scope := range strings.Fields(r.FormValue("scope")) {
+		if !containsString(client.Scopes, scope) {
+			return req, oauthError{"invalid_scope", fmt.Sprintf("Scope %s isn't available to this client", scope)}
+		}
+		if !containsString(req.Scopes, scope) {
+			req.Scopes = append(req.Scopes, scope)
+		}
+	}
+	if len(req.Scopes) == 0 {
+		return req, oauthError{"invalid_scope", "No scope requested"}
+	}
+	req.Nonce = r.FormValue("nonce")
+	return req, nil
+}
+
+// validCodeChallenge reports whether challenge can be an S256 code
+// challenge: a base64url-encoded SHA-256 hash.
+func validCodeChallenge(challenge string) bool {
+	sum, err := base64.RawURLEncoding.DecodeString(challenge)
+	return err == nil && len(sum) == sha256.Size
+}
+
+// verifyCodeChallenge reports whether verifier is the PKCE code verifier
+// challenge was derived from (RFC 7636).
+func verifyCodeChallenge(verifier string, challenge string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	encoded := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(encoded), []byte(challenge)) == 1
+}
+
+// renderConsent writes the consent page. It must not be framed, so other
+// sites can't trick users into clicking Allow.
+func renderConsent(w http.ResponseWriter, code int, page consentPage) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; frame-ancestors 'none'")
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.WriteHeader(code)
+	if err := consentTemplate.Execute(w, page); err != nil {
+		log.Printf("Error rendering consent page: %s\n", err)
+	}
+}
+
+func newConsentPage(req authorizeRequest, r *http.Request, msg string) consentPage {
+	page := consentPage{
+		ClientName: req.Client.Name,
+		Params:     map[string]string{},
+		Error:      msg,
+	}
+	for _, scope := range req.Scopes {
+		page.Scopes = append(page.Scopes, scopeDescriptions[scope])
+	}
+	for _, name := range authorizeParams {
+		if value := r.FormValue(name); value != "" {
+			page.Params[name] = value
+		}
+	}
+	return page
+}
+
+// redirectToClient sends the user back to the client with params added to
+// the query of its redirect URI.
+func redirectToClient(w http.ResponseWriter, r *http.Request, req authorizeRequest, params url.Values) {
+	// Registered redirect URIs were validated, so this can't fail.
+	u, _ := url.Parse(req.RedirectURI)
+	query := u.Query()
+	for name, values := range params {
+		query[name] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	u.RawQuery = query.Encode()
+	http.Redirect(w, r, u.String(), http.StatusSeeOther)
+}
+
+// failAuthorize reports err from parseAuthorizeRequest to the client if it
+// can be trusted with it, and to the user otherwise.
+func failAuthorize(w http.ResponseWriter, r *http.Request, req authorizeRequest, err error) {
+	var oauthErr oauthError
+	if req.RedirectURI == "" || !errors.As(err, &oauthErr) {
+		renderConsent(w, http.StatusBadRequest, consentPage{Error: err.Error()})
+		return
+	}
+	redirectToClient(w, r, req, url.Values{
+		"error":             {oauthErr.Code},
+		"error_description": {oauthErr.Description},
+	})
+}
+
+// HandleAuthorize shows the page where users sign in and let a client act
+// for them.
+func (cfg ApiConfig) HandleAuthorize(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r)
+	if err != nil {
+		failAuthorize(w, r, req, err)
+		return
+	}
+	renderConsent(w, http.StatusOK, newConsentPage(req, r, ""))
+}
+
+// HandleAuthorizeDecision takes the consent form and sends the user back to
+// the client with an authorization code, or with access_denied if they
+// declined.
+func (cfg ApiConfig) HandleAuthorizeDecision(w http.ResponseWriter, r *http.Request) {
+	req, err := cfg.parseAuthorizeRequest(r)
+	if err != nil {
+		failAuthorize(w, r, req, err)
+		return
+	}
+	if r.PostFormValue("decision") != "allow" {
+		redirectToClient(w, r, req, url.Values{"error": {"access_denied"}})
+		return
+	}
+
+	user, err := cfg.DB.AuthenticateUser(r.PostFormValue("email"), r.PostFormValue("password"))
+	if err != nil {
+		renderConsent(w, http.StatusUnauthorized, newConsentPage(req, r, "Invalid email address or password"))
+		return
+	}
+
+	code, hash, err := model.NewOAuthSecret()
+	if err != nil {
+		redirectToClient(w, r, req, url.Values{"error": {"server_error"}})
+		return
+	}
+	now := time.Now()
+	err = cfg.DB.CreateAuthorizationCode(model.AuthorizationCode{
+		Hash:          hash,
+		ClientID:      req.Client.ID,
+		UserID:        user.ID,
+		RedirectURI:   req.RedirectURI,
+		Scope:         strings.Join(req.Scopes, " "),
+		CodeChallenge: req.CodeChallenge,
+		Nonce:         req.Nonce,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(authorizationCodeTTL),
+	}, now)
+	if err != nil {
+		log.Printf("Error creating authorization code: %s\n", err)
+		redirectToClient(w, r, req, url.Values{"error": {"server_error"}})
+		return
+	}
+	redirectToClient(w, r, req, url.Values{"code": {code}})
+}
+
+// errInvalidClient is returned when a token request's client is unknown or
+// fails to authenticate.
+var errInvalidClient = oauthError{"invalid_client", "Client authentication failed"}
+
+// authenticateClient identifies the client making a token request, from
+// HTTP Basic authentication or client_id and client_secret in the body.
+// Confidential clients must present their secret; public clients only send
+// their ID.
+func (cfg ApiConfig) authenticateClient(r *http.Request) (model.OAuthClient, error) {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// RFC 6749 has both form-encoded before they are joined.
+		var idErr, secretErr error
+		id, idErr = url.QueryUnescape(id)
+		secret, secretErr = url.QueryUnescape(secret)
+		if idErr != nil || secretErr != nil {
+			return model.OAuthClient{}, errInvalidClient
+		}
+	} else {
+		id = r.PostFormValue("client_id")
+		secret = r.PostFormValue("client_secret")
+	}
+
+	client, err := cfg.DB.GetOAuthClient(id)
+	if err != nil {
+		return model.OAuthClient{}, errInvalidClient
+	}
+	if client.SecretHash == "" {
+		return client, nil
+	}
+	hash := model.HashOAuthSecret(secret)
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hash), []byte(client.SecretHash)) != 1 {
+		return model.OAuthClient{}, errInvalidClient
+	}
+	return client, nil
+}
+
+// HandleOAuthToken exchanges an authorization code and its PKCE code
+// verifier for an access token limited to the granted scopes, and an ID
+// token if openid was one of them.
+func (cfg ApiConfig) HandleOAuthToken(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	if err := r.ParseForm(); err != nil {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"invalid_request", "Malformed request body"})
+		return
+	}
+
+	client, err := cfg.authenticateClient(r)
+	if err != nil {
+		if _, _, ok := r.BasicAuth(); ok {
+			w.Header().Set("WWW-Authenticate", `Basic realm="chirpy"`)
+		}
+		respondWithJSON(w, http.StatusUnauthorized, err)
+		return
+	}
+	if r.PostFormValue("grant_type") != "authorization_code" {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"unsupported_grant_type", "Only authorization_code is supported"})
+		return
+	}
+
+	code, err := cfg.DB.ConsumeAuthorizationCode(model.HashOAuthSecret(r.PostFormValue("code")), time.Now())
+	if errors.Is(err, model.ErrInvalidAuthorizationCode) {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "Authorization code is invalid, expired or used"})
+		return
+	}
+	if err != nil {
+		log.Printf("Error consuming authorization code: %s\n", err)
+		respondWithJSON(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	if code.ClientID != client.ID || code.RedirectURI != r.PostFormValue("redirect_uri") {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "Authorization code was issued to another client or redirect URI"})
+		return
+	}
+	if !verifyCodeChallenge(r.PostFormValue("code_verifier"), code.CodeChallenge) {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "Code verifier doesn't match the code challenge"})
+		return
+	}
+	user, err := cfg.DB.GetUser(code.UserID)
+	if err != nil {
+		respondWithJSON(w, http.StatusBadRequest, oauthError{"invalid_grant", "User no longer exists"})
+		return
+	}
+
+	accessToken, err := model.GenerateDelegatedToken(cfg.Keys, user.ID, client.ID, code.Scope)
+	if err != nil {
+		log.Printf("Error issuing access token: %s\n", err)
+		respondWithJSON(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+		return
+	}
+	respBody := OAuthTokenRespBody{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int(model.AccessTokenTTL.Seconds()),
+		Scope:       code.Scope,
+	}
+	if containsString(strings.Fields(code.Scope), model.ScopeOpenID) {
+		respBody.IDToken, err = model.GenerateIDToken(cfg.Keys, cfg.Issuer, user, code)
+		if err != nil {
+			log.Printf("Error issuing ID token: %s\n", err)
+			respondWithJSON(w, http.StatusInternalServerError, oauthError{Code: "server_error"})
+			return
+		}
+	}
+	respondWithJSON(w, http.StatusOK, respBody)
+}
+
+// HandleUserInfo returns the claims about the caller that their token's
+// scopes release. Tokens issued at login see all of them.
+func (cfg ApiConfig) HandleUserInfo(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+	user, err := cfg.DB.GetUser(principal.UserID)
+	if err != nil {
+		respondUnauthorized(w, err)
+		return
+	}
+
+	scopes := principal.Scopes
+	if principal.ClientID == "" {
+		scopes = model.SupportedScopes
+	}
+	respondWithJSON(w, http.StatusOK, UserInfoRespBody{
+		Subject:    strconv.Itoa(user.ID),
+		UserClaims: model.NewUserClaims(user, scopes),
+	})
+}
+
+// HandleOpenIDConfiguration serves the discovery document clients configure
+// themselves from.
+func (cfg ApiConfig) HandleOpenIDConfiguration(w http.ResponseWriter, r *http.Request) {
+	algs := []string{}
+	for _, key := range cfg.Keys.Keys() {
+		if alg := key.Method.Alg(); !containsString(algs, alg) {
+			algs = append(algs, alg)
+		}
+	}
+
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	respondWithJSON(w, http.StatusOK, OpenIDConfiguration{
+		Issuer:                            cfg.Issuer,
+		AuthorizationEndpoint:             cfg.Issuer + "/oauth/authorize",
+		TokenEndpoint:                     cfg.Issuer + "/oauth/token",
+		UserinfoEndpoint:                  cfg.Issuer + "/oauth/userinfo",
+		JWKSURI:                           cfg.Issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   model.SupportedScopes,
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{"authorization_code"},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  algs,
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{"S256"},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "auth_time", "nonce", "email", "preferred_username"},
+	})
+}
+
+func containsString(values []string, s string) bool {
+	for _, v := range values {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
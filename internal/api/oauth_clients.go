@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxClientNameLength caps the name of an OAuth client, in bytes.
+const maxClientNameLength = 100
+
+type OAuthClientReqBody struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	// Scopes are the scopes the client may ask for. They default to all
+	// supported scopes.
+	Scopes []string `json:"scopes"`
+	// Public registers a client without a secret, for apps that can't keep
+	// one.
+	Public bool `json:"public"`
+}
+
+type OAuthClientRespBody struct {
+	ClientID string `json:"client_id"`
+	// ClientSecret is only returned when the client is registered.
+	ClientSecret string    `json:"client_secret,omitempty"`
+	Name         string    `json:"name"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	Public       bool      `json:"public"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+func newOAuthClientRespBody(client model.OAuthClient) OAuthClientRespBody {
+	return OAuthClientRespBody{
+		ClientID:     client.ID,
+		Name:         client.Name,
+		RedirectURIs: client.RedirectURIs,
+		Scopes:       client.Scopes,
+		Public:       client.SecretHash == "",
+		CreatedAt:    client.CreatedAt,
+	}
+}
+
+// validRedirectURI reports whether uri may be registered as a redirect URI:
+// an absolute https URL, or an http one on the loopback interface for native
+// apps (RFC 8252), without a fragment.
+func validRedirectURI(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || u.Host == "" || u.User != nil || strings.Contains(uri, "#") {
+		return false
+	}
+	switch u.Scheme {
+	case "https":
+		return true
+	case "http":
+		host := u.Hostname()
+		return host == "localhost" || net.ParseIP(host).IsLoopback()
+	}
+	return false
+}
+
+// HandleCreateOAuthClient registers an OAuth client. Its secret is in the
+// response and can't be retrieved later.
+func (cfg ApiConfig) HandleCreateOAuthClient(w http.ResponseWriter, r *http.Request) {
+	reqBody := OAuthClientReqBody{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil {
+		msg := fmt.Sprintf("Error decoding request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+
+	reqBody.Name = strings.TrimSpace(reqBody.Name)
+	if reqBody.Name == "" || len(reqBody.Name) > maxClientNameLength {
+		msg := fmt.Sprintf("Name must be 1 to %d bytes long", maxClientNameLength)
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if len(reqBody.RedirectURIs) == 0 {
+		respondWithError(w, http.StatusBadRequest, "At least one redirect URI is required")
+		return
+	}
+	for _, uri := range reqBody.RedirectURIs {
+		if !validRedirectURI(uri) {
+			msg := fmt.Sprintf("Invalid redirect URI %q: use https, or http on localhost", uri)
+			respondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+	}
+	if len(reqBody.Scopes) == 0 {
+		reqBody.Scopes = model.SupportedScopes
+	}
+	for _, scope := range reqBody.Scopes {
+		if !containsString(model.SupportedScopes, scope) {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("Unsupported scope %q", scope))
+			return
+		}
+	}
+
+	id, err := model.NewOAuthClientID()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	client := model.OAuthClient{
+		ID:           id,
+		Name:         reqBody.Name,
+		RedirectURIs: reqBody.RedirectURIs,
+		Scopes:       reqBody.Scopes,
+	}
+	secret := ""
+	if !reqBody.Public {
+		secret, client.SecretHash, err = model.NewOAuthSecret()
+		if err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	client, err = cfg.DB.CreateOAuthClient(client)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't register client")
+		return
+	}
+	respBody := newOAuthClientRespBody(client)
+	respBody.ClientSecret = secret
+	respondWithJSON(w, http.StatusCreated, respBody)
+}
+
+// HandleGetOAuthClients lists the registered OAuth clients.
+func (cfg ApiConfig) HandleGetOAuthClients(w http.ResponseWriter, r *http.Request) {
+	clients, err := cfg.DB.GetOAuthClients()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve clients")
+		return
+	}
+	respBody := make([]OAuthClientRespBody, 0, len(clients))
+	for _, client := range clients {
+		respBody = append(respBody, newOAuthClientRespBody(client))
+	}
+	respondWithJSON(w, http.StatusOK, respBody)
+}
+
+// HandleDeleteOAuthClient unregisters an OAuth client. Access tokens already
+// issued to it stay valid until they expire.
+func (cfg ApiConfig) HandleDeleteOAuthClient(w http.ResponseWriter, r *http.Request) {
+	if err := cfg.DB.DeleteOAuthClient(chi.URLParam(r, "id")); err != nil {
+		respondWithError(w, http.StatusNotFound, "Client not found")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
@@ -0,0 +1,338 @@
+package api
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+const (
+	testRedirectURI = "https://app.example/callback"
+	// testVerifier is a PKCE code verifier; testChallenge is its S256
+	// challenge.
+	testVerifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+var testChallenge = func() string {
+	sum := sha256.Sum256([]byte(testVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}()
+
+// oauthTest is an OAuth provider with a user, alice, and two confidential
+// clients, app and other, registered with the same redirect URI.
+type oauthTest struct {
+	cfg         ApiConfig
+	alice       model.User
+	app, other  model.OAuthClient
+	appSecret   string
+	otherSecret string
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+	o := &oauthTest{cfg: newTestConfig(t)}
+	var err error
+	o.alice, err = o.cfg.DB.CreateUser("alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o.app, o.appSecret = o.registerClient(t, "app")
+	o.other, o.otherSecret = o.registerClient(t, "other")
+	return o
+}
+
+func (o *oauthTest) registerClient(t *testing.T, id string) (model.OAuthClient, string) {
+	t.Helper()
+	secret, hash, err := model.NewOAuthSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	client, err := o.cfg.DB.CreateOAuthClient(model.OAuthClient{
+		ID:           id,
+		Name:         id,
+		SecretHash:   hash,
+		RedirectURIs: []string{testRedirectURI},
+		Scopes:       model.SupportedScopes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client, secret
+}
+
+// authorizeRequestParams returns a valid authorization request for client.
+func authorizeRequestParams(client model.OAuthClient) url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ID},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid chirps:read"},
+		"state":                 {"xyz"},
+		"code_challenge":        {testChallenge},
+		"code_challenge_method": {"S256"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+	}
+}
+
+// decide posts the consent form with params, signed in as alice.
+func (o *oauthTest) decide(params url.Values, decision string) *httptest.ResponseRecorder {
+	form := url.Values{}
+	for name, values := range params {
+		form[name] = values
+	}
+	form.Set("email", "alice@example.com")
+	form.Set("password", "password")
+	form.Set("decision", decision)
+	req := httptest.NewRequest(http.MethodPost, "/oauth/authorize", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	o.cfg.HandleAuthorizeDecision(w, req)
+	return w
+}
+
+// redirectQuery returns the query of the redirect to testRedirectURI in w.
+func redirectQuery(t *testing.T, w *httptest.ResponseRecorder) url.Values {
+	t.Helper()
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("status = %d, want a redirect; body: %s", w.Code, w.Body)
+	}
+	u, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if base := u.Scheme + "://" + u.Host + u.Path; base != testRedirectURI {
+		t.Fatalf("redirected to %s, want %s", base, testRedirectURI)
+	}
+	return u.Query()
+}
+
+// authorize runs the consent step for client and returns the code.
+func (o *oauthTest) authorize(t *testing.T, client model.OAuthClient) string {
+	t.Helper()
+	query := redirectQuery(t, o.decide(authorizeRequestParams(client), "allow"))
+	if query.Get("state") != "xyz" || query.Get("code") == "" {
+		t.Fatalf("redirect query = %v, want a code and the state", query)
+	}
+	return query.Get("code")
+}
+
+// exchange redeems code at the token endpoint as client.
+func (o *oauthTest) exchange(client model.OAuthClient, secret string, code string, verifier string) *httptest.ResponseRecorder {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	}
+	req := httptest.NewRequest(http.MethodPost, "/oauth/token", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(client.ID, secret)
+	w := httptest.NewRecorder()
+	o.cfg.HandleOAuthToken(w, req)
+	return w
+}
+
+func oauthErrorCode(t *testing.T, w *httptest.ResponseRecorder) string {
+	t.Helper()
+	body := oauthError{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("decoding %q: %s", w.Body, err)
+	}
+	return body.Code
+}
+
+func TestOAuthCodeFlow(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.authorize(t, o.app)
+
+	w := o.exchange(o.app, o.appSecret, code, testVerifier)
+	if w.Code != http.StatusOK {
+		t.Fatalf("token status = %d; body: %s", w.Code, w.Body)
+	}
+	body := OAuthTokenRespBody{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Scope != "openid chirps:read" || body.IDToken == "" {
+		t.Errorf("token response = %+v", body)
+	}
+	claims, err := model.ValidateAccessToken(body.AccessToken, o.cfg.Keys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.ClientID != "app" || claims.Subject != "1" || claims.Scope != "openid chirps:read" {
+		t.Errorf("access token claims = %+v", claims)
+	}
+}
+
+func TestAuthorizeUnregisteredRedirectURI(t *testing.T) {
+	o := newOAuthTest(t)
+	for name, params := range map[string]url.Values{
+		"unregistered":   {"redirect_uri": {"https://evil.example/callback"}},
+		"prefix":         {"redirect_uri": {testRedirectURI + "/more"}},
+		"missing":        {"redirect_uri": {""}},
+		"unknown client": {"client_id": {"nobody"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			query := authorizeRequestParams(o.app)
+			for k, v := range params {
+				query[k] = v
+			}
+			req := httptest.NewRequest(http.MethodGet, "/oauth/authorize?"+query.Encode(), nil)
+			w := httptest.NewRecorder()
+			o.cfg.HandleAuthorize(w, req)
+			if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+				t.Errorf("GET: status = %d, Location = %q; want 400 without a redirect", w.Code, w.Header().Get("Location"))
+			}
+
+			w = o.decide(query, "allow")
+			if w.Code != http.StatusBadRequest || w.Header().Get("Location") != "" {
+				t.Errorf("POST: status = %d, Location = %q; want 400 without a redirect", w.Code, w.Header().Get("Location"))
+			}
+		})
+	}
+}
+
+func TestAuthorizeRequiresS256(t *testing.T) {
+	o := newOAuthTest(t)
+	for name, params := range map[string]url.Values{
+		"no method":    {"code_challenge_method": {""}},
+		"plain method": {"code_challenge_method": {"plain"}, "code_challenge": {testVerifier}},
+		"no challenge": {"code_challenge": {""}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			query := authorizeRequestParams(o.app)
+			for k, v := range params {
+				query[k] = v
+			}
+			got := redirectQuery(t, o.decide(query, "allow"))
+			if got.Get("error") != "invalid_request" || got.Get("code") != "" {
+				t.Errorf("redirect query = %v, want invalid_request and no code", got)
+			}
+		})
+	}
+}
+
+func TestAuthorizeDenied(t *testing.T) {
+	o := newOAuthTest(t)
+	got := redirectQuery(t, o.decide(authorizeRequestParams(o.app), "deny"))
+	if got.Get("error") != "access_denied" || got.Get("code") != "" {
+		t.Errorf("redirect query = %v, want access_denied and no code", got)
+	}
+}
+
+func TestOAuthTokenWrongVerifier(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.authorize(t, o.app)
+
+	w := o.exchange(o.app, o.appSecret, code, strings.Repeat("a", 43))
+	if w.Code != http.StatusBadRequest || oauthErrorCode(t, w) != "invalid_grant" {
+		t.Errorf("wrong verifier: status = %d; body: %s", w.Code, w.Body)
+	}
+	// The failed attempt used the code up.
+	w = o.exchange(o.app, o.appSecret, code, testVerifier)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("the code still worked after a wrong verifier: status = %d", w.Code)
+	}
+}
+
+func TestOAuthTokenCodeReuse(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.authorize(t, o.app)
+
+	if w := o.exchange(o.app, o.appSecret, code, testVerifier); w.Code != http.StatusOK {
+		t.Fatalf("first exchange: status = %d; body: %s", w.Code, w.Body)
+	}
+	w := o.exchange(o.app, o.appSecret, code, testVerifier)
+	if w.Code != http.StatusBadRequest || oauthErrorCode(t, w) != "invalid_grant" {
+		t.Errorf("second exchange: status = %d; body: %s", w.Code, w.Body)
+	}
+}
+
+func TestOAuthTokenOtherClient(t *testing.T) {
+	o := newOAuthTest(t)
+	code := o.authorize(t, o.app)
+
+	w := o.exchange(o.other, o.otherSecret, code, testVerifier)
+	if w.Code != http.StatusBadRequest || oauthErrorCode(t, w) != "invalid_grant" {
+		t.Errorf("exchange by another client: status = %d; body: %s", w.Code, w.Body)
+	}
+
+	// Nor can a client pass itself off as the one the code was issued to.
+	code = o.authorize(t, o.app)
+	w = o.exchange(o.app, o.otherSecret, code, testVerifier)
+	if w.Code != http.StatusUnauthorized || oauthErrorCode(t, w) != "invalid_client" {
+		t.Errorf("exchange with another client's secret: status = %d; body: %s", w.Code, w.Body)
+	}
+}
+
+// TestDelegatedTokenScopes checks that a token issued to a client only
+// reaches the routes its scopes cover, and never the account routes, even
+// for an admin.
+func TestDelegatedTokenScopes(t *testing.T) {
+	o := newOAuthTest(t)
+	if _, err := o.cfg.DB.SetUserAdmin("alice@example.com", true); err != nil {
+		t.Fatal(err)
+	}
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	routes := map[string]http.Handler{
+		"chirps:read":  o.cfg.RequireAuth(RequireScope(model.ScopeChirpsRead)(ok)),
+		"chirps:write": o.cfg.RequireAuth(RequireScope(model.ScopeChirpsWrite)(ok)),
+		"account":      o.cfg.RequireAuth(RequireFirstParty(http.HandlerFunc(o.cfg.HandlePutUser))),
+		"admin":        o.cfg.RequireAdmin(ok),
+	}
+
+	delegated, err := model.GenerateDelegatedToken(o.cfg.Keys, o.alice.ID, o.app.ID, "openid chirps:read")
+	if err != nil {
+		t.Fatal(err)
+	}
+	firstParty, err := model.GenerateAccessToken(o.cfg.Keys, o.alice.ID, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		route string
+		token string
+		want  int
+	}{
+		{"chirps:read", delegated, http.StatusNoContent},
+		{"chirps:write", delegated, http.StatusForbidden},
+		{"account", delegated, http.StatusForbidden},
+		{"admin", delegated, http.StatusForbidden},
+		{"chirps:read", firstParty, http.StatusNoContent},
+		{"chirps:write", firstParty, http.StatusNoContent},
+		{"account", firstParty, http.StatusOK},
+		{"admin", firstParty, http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"email":"mallory@example.com"}`))
+		req.Header.Set("Authorization", "Bearer "+tt.token)
+		w := httptest.NewRecorder()
+		routes[tt.route].ServeHTTP(w, req)
+		kind := "delegated"
+		if tt.token == firstParty {
+			kind = "first-party"
+		}
+		if w.Code != tt.want {
+			t.Errorf("%s token on %s route: status = %d, want %d", kind, tt.route, w.Code, tt.want)
+		}
+	}
+
+	user, err := o.cfg.DB.GetUser(o.alice.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Email != "mallory@example.com" {
+		t.Errorf("Email = %q: the first-party update didn't go through", user.Email)
+	}
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+const (
+	// oidcStateCookie holds the login state between sending the user to the
+	// external provider and their coming back.
+	oidcStateCookie = "chirpy_oidc_login"
+	oidcCookiePath  = "/api/login/oidc"
+	// oidcLoginTTL is how long the user has to sign in at the provider.
+	oidcLoginTTL = 10 * time.Minute
+)
+
+// randomString returns 32 random bytes, base64url-encoded. That is also a
+// valid PKCE code verifier.
+func randomString() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (cfg ApiConfig) setLoginStateCookie(w http.ResponseWriter, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     oidcCookiePath,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(cfg.OIDC.RedirectURL(), "https://"),
+		// Lax, so the cookie comes along when the provider redirects back.
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// HandleOIDCLogin sends the user to sign in with the external provider. The
+// state, nonce and PKCE verifier of the attempt are kept in a signed cookie
+// for HandleOIDCCallback.
+func (cfg ApiConfig) HandleOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	state := model.LoginState{}
+	for _, s := range []*string{&state.State, &state.Nonce, &state.Verifier} {
+		var err error
+		if *s, err = randomString(); err != nil {
+			respondWithError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	sum := sha256.Sum256([]byte(state.Verifier))
+	challenge := base64.RawURLEncoding.EncodeToString(sum[:])
+
+	authURL, err := cfg.OIDC.AuthCodeURL(r.Context(), state.State, state.Nonce, challenge)
+	if err != nil {
+		log.Printf("Error starting OIDC login: %s\n", err)
+		respondWithError(w, http.StatusBadGateway, "Identity provider is unavailable")
+		return
+	}
+	token, err := model.GenerateLoginStateToken(cfg.Keys, state, oidcLoginTTL)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	cfg.setLoginStateCookie(w, token, int(oidcLoginTTL.Seconds()))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// HandleOIDCCallback finishes signing in with the external provider. The
+// account there is linked to a Chirpy user the first time, by its verified
+// email address, and the user is created if there is none. The response is
+// the same as from logging in with a password.
+func (cfg ApiConfig) HandleOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	cookie, err := r.Cookie(oidcStateCookie)
+	// The login state is good for one try only.
+	cfg.setLoginStateCookie(w, "", -1)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Sign-in expired or was started in another browser")
+		return
+	}
+	state, err := model.ValidateLoginStateToken(cookie.Value, cfg.Keys)
+	query := r.URL.Query()
+	if err != nil || subtle.ConstantTimeCompare([]byte(query.Get("state")), []byte(state.State)) != 1 {
+		respondWithError(w, http.StatusBadRequest, "Invalid sign-in state")
+		return
+	}
+	if providerErr := query.Get("error"); providerErr != "" {
+		msg := fmt.Sprintf("Identity provider refused sign-in: %s", providerErr)
+		respondWithError(w, http.StatusUnauthorized, msg)
+		return
+	}
+
+	claims, err := cfg.OIDC.Exchange(r.Context(), query.Get("code"), state.Verifier, state.Nonce)
+	if err != nil {
+		log.Printf("Error finishing OIDC login: %s\n", err)
+		respondWithError(w, http.StatusUnauthorized, "Couldn't verify sign-in with the identity provider")
+		return
+	}
+
+	email := ""
+	if claims.EmailVerified {
+		email = claims.Email
+	}
+	user, err := cfg.DB.SignInExternalUser(cfg.OIDC.Issuer(), claims.Subject, email)
+	if errors.Is(err, model.ErrNoVerifiedEmail) {
+		respondWithError(w, http.StatusForbidden, "Identity provider didn't share a verified email address")
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't sign in")
+		return
+	}
+	cfg.respondWithLogin(w, user, r.UserAgent())
+}
@@ -0,0 +1,215 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/oidc"
+	"github.com/christopherplain/chirpy/internal/oidc/oidctest"
+)
+
+const testCallbackURL = "https://chirpy.example/api/login/oidc/callback"
+
+func newOIDCTest(t *testing.T) (ApiConfig, *oidctest.Server) {
+	t.Helper()
+	server := oidctest.NewServer("chirpy", "client-secret")
+	t.Cleanup(server.Close)
+	cfg := newTestConfig(t)
+	cfg.OIDC = oidc.NewProvider(oidc.Config{
+		Issuer:       server.URL,
+		ClientID:     "chirpy",
+		ClientSecret: "client-secret",
+		RedirectURL:  testCallbackURL,
+	})
+	return cfg, server
+}
+
+// startOIDCLogin starts a login and follows it through the provider,
+// returning the login state cookie and the callback request the provider
+// sends the browser back with.
+func startOIDCLogin(t *testing.T, cfg ApiConfig) (*http.Cookie, *http.Request) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	cfg.HandleOIDCLogin(w, httptest.NewRequest(http.MethodGet, "/api/login/oidc", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login status = %d; body: %s", w.Code, w.Body)
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != oidcStateCookie || !cookies[0].HttpOnly {
+		t.Fatalf("login cookies = %v", cookies)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cookies[0], httptest.NewRequest(http.MethodGet, back.String(), nil)
+}
+
+func callback(cfg ApiConfig, cookie *http.Cookie, req *http.Request) *httptest.ResponseRecorder {
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	cfg.HandleOIDCCallback(w, req)
+	return w
+}
+
+// completeOIDCLogin goes through a whole login and returns the callback's
+// response.
+func completeOIDCLogin(t *testing.T, cfg ApiConfig) *httptest.ResponseRecorder {
+	t.Helper()
+	cookie, req := startOIDCLogin(t, cfg)
+	return callback(cfg, cookie, req)
+}
+
+func loginResponse(t *testing.T, w *httptest.ResponseRecorder) UserRespBody {
+	t.Helper()
+	if w.Code != http.StatusOK {
+		t.Fatalf("callback status = %d; body: %s", w.Code, w.Body)
+	}
+	body := UserRespBody{}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatal(err)
+	}
+	if body.Token == "" || body.RefreshToken == "" {
+		t.Errorf("login response has no tokens: %s", w.Body)
+	}
+	return body
+}
+
+func TestOIDCCallbackProvisions(t *testing.T) {
+	cfg, server := newOIDCTest(t)
+	server.SetUser(oidctest.User{Subject: "alice-sub", Email: "alice@example.com", EmailVerified: true})
+
+	body := loginResponse(t, completeOIDCLogin(t, cfg))
+	if body.Email != "alice@example.com" {
+		t.Errorf("Email = %q", body.Email)
+	}
+	user, err := cfg.DB.GetUser(body.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.Password != "" {
+		t.Error("the provisioned user has a password")
+	}
+
+	// Signing in again finds the same user, even after the address changed
+	// at the provider.
+	server.SetUser(oidctest.User{Subject: "alice-sub", Email: "alice@example.org", EmailVerified: true})
+	again := loginResponse(t, completeOIDCLogin(t, cfg))
+	if again.ID != body.ID {
+		t.Errorf("second sign-in returned user %d, want %d", again.ID, body.ID)
+	}
+}
+
+func TestOIDCCallbackLinks(t *testing.T) {
+	cfg, server := newOIDCTest(t)
+	existing, err := cfg.DB.CreateUser("alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetUser(oidctest.User{Subject: "alice-sub", Email: "alice@example.com", EmailVerified: true})
+
+	body := loginResponse(t, completeOIDCLogin(t, cfg))
+	if body.ID != existing.ID {
+		t.Errorf("linked to user %d, want %d", body.ID, existing.ID)
+	}
+	// The password may have been set by someone else.
+	if _, err := cfg.DB.AuthenticateUser("alice@example.com", "password"); err == nil {
+		t.Error("the password set before linking still works")
+	}
+}
+
+func TestOIDCCallbackUnverifiedEmail(t *testing.T) {
+	cfg, server := newOIDCTest(t)
+	if _, err := cfg.DB.CreateUser("alice@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+	server.SetUser(oidctest.User{Subject: "mallory-sub", Email: "alice@example.com"})
+
+	w := completeOIDCLogin(t, cfg)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("callback with an unverified email: status = %d, want 403", w.Code)
+	}
+	if _, err := cfg.DB.AuthenticateUser("alice@example.com", "password"); err != nil {
+		t.Errorf("the refused sign-in changed the user: %s", err)
+	}
+}
+
+func TestOIDCCallbackProviderError(t *testing.T) {
+	cfg, server := newOIDCTest(t)
+	server.SetUser(oidctest.User{})
+
+	w := completeOIDCLogin(t, cfg)
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("callback with access_denied: status = %d, want 401", w.Code)
+	}
+}
+
+func TestOIDCCallbackRejectsBadState(t *testing.T) {
+	cfg, server := newOIDCTest(t)
+	server.SetUser(oidctest.User{Subject: "alice-sub", Email: "alice@example.com", EmailVerified: true})
+
+	t.Run("state mismatch", func(t *testing.T) {
+		cookie, req := startOIDCLogin(t, cfg)
+		query := req.URL.Query()
+		query.Set("state", "forged")
+		req.URL.RawQuery = query.Encode()
+		if w := callback(cfg, cookie, req); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("another login's cookie", func(t *testing.T) {
+		cookie, _ := startOIDCLogin(t, cfg)
+		_, req := startOIDCLogin(t, cfg)
+		if w := callback(cfg, cookie, req); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("missing cookie", func(t *testing.T) {
+		_, req := startOIDCLogin(t, cfg)
+		if w := callback(cfg, nil, req); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("expired cookie", func(t *testing.T) {
+		cookie, req := startOIDCLogin(t, cfg)
+		state, err := model.ValidateLoginStateToken(cookie.Value, cfg.Keys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		cookie.Value, err = model.GenerateLoginStateToken(cfg.Keys, state, -time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if w := callback(cfg, cookie, req); w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want 400", w.Code)
+		}
+	})
+
+	t.Run("cookie is cleared", func(t *testing.T) {
+		cookie, req := startOIDCLogin(t, cfg)
+		w := callback(cfg, cookie, req)
+		cleared := w.Result().Cookies()
+		if len(cleared) != 1 || cleared[0].Name != oidcStateCookie || cleared[0].MaxAge >= 0 {
+			t.Errorf("callback cookies = %v, want the login state cookie cleared", cleared)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+package api
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 200
+)
+
+// parseChirpQuery reads the paging and filtering parameters shared by the
+// chirp listing endpoints: author_id, sort, limit, cursor, since and until.
+func parseChirpQuery(r *http.Request) (model.ChirpQuery, error) {
+	query := r.URL.Query()
+	q := model.ChirpQuery{
+		Order: "asc",
+		Limit: defaultPageSize,
+	}
+
+	if s := query.Get("author_id"); s != "" {
+		authorID, err := strconv.Atoi(s)
+		if err != nil {
+			return q, errors.New("Invalid author_id")
+		}
+		q.AuthorID = &authorID
+	}
+
+	if query.Get("sort") == "desc" {
+		q.Order = "desc"
+	}
+
+	if s := query.Get("limit"); s != "" {
+		limit, err := strconv.Atoi(s)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if s := query.Get("cursor"); s != "" {
+		afterID, err := decodeCursor(s)
+		if err != nil {
+			return q, errors.New("Invalid cursor")
+		}
+		q.AfterID = afterID
+	}
+
+	var err error
+	if q.Since, err = parseTimeParam(query.Get("since")); err != nil {
+		return q, errors.New("since must be an RFC 3339 time")
+	}
+	if q.Until, err = parseTimeParam(query.Get("until")); err != nil {
+		return q, errors.New("until must be an RFC 3339 time")
+	}
+
+	return q, nil
+}
+
+func parseTimeParam(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+func encodeCursor(id int) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(id)))
+}
+
+func decodeCursor(cursor string) (int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.Atoi(string(data))
+}
+
+// fetchPage runs fetch for one more chirp than the page holds, so it can tell
+// whether another page follows. If it does, a Link header pointing at the next
+// page is added to the response.
+func fetchPage(w http.ResponseWriter, r *http.Request, q model.ChirpQuery, fetch func(model.ChirpQuery) ([]model.Chirp, error)) ([]model.Chirp, error) {
+	limit := q.Limit
+	q.Limit++
+	chirps, err := fetch(q)
+	if err != nil {
+		return nil, err
+	}
+	if len(chirps) <= limit {
+		return chirps, nil
+	}
+
+	chirps = chirps[:limit]
+	next := *r.URL
+	values := next.Query()
+	values.Set("cursor", encodeCursor(chirps[limit-1].ID))
+	next.RawQuery = values.Encode()
+	w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+
+	return chirps, nil
+}
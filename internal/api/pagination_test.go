@@ -0,0 +1,92 @@
+package api
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+func TestParseChirpQuery(t *testing.T) {
+	r := httptest.NewRequest("GET", "/api/chirps?author_id=3&sort=desc&limit=10&cursor="+encodeCursor(42)+"&since=2024-01-02T03:04:05Z", nil)
+	q, err := parseChirpQuery(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.AuthorID == nil || *q.AuthorID != 3 {
+		t.Errorf("AuthorID = %v, want 3", q.AuthorID)
+	}
+	if q.Order != "desc" || q.Limit != 10 || q.AfterID != 42 {
+		t.Errorf("got %+v", q)
+	}
+	if want := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC); !q.Since.Equal(want) || !q.Until.IsZero() {
+		t.Errorf("Since, Until = %s, %s", q.Since, q.Until)
+	}
+
+	q, err = parseChirpQuery(httptest.NewRequest("GET", "/api/chirps", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.Order != "asc" || q.Limit != defaultPageSize || q.AfterID != 0 || q.AuthorID != nil {
+		t.Errorf("defaults: got %+v", q)
+	}
+}
+
+func TestParseChirpQueryRejects(t *testing.T) {
+	for _, query := range []string{
+		"author_id=alice",
+		"limit=0",
+		"limit=201",
+		"limit=ten",
+		"cursor=%21%21",
+		"cursor=" + url.QueryEscape("bm90IGFuIGlk"),
+		"since=yesterday",
+		"until=2024-01-02",
+	} {
+		if _, err := parseChirpQuery(httptest.NewRequest("GET", "/api/chirps?"+query, nil)); err == nil {
+			t.Errorf("%s: accepted", query)
+		}
+	}
+}
+
+func TestFetchPage(t *testing.T) {
+	all := []model.Chirp{{ID: 1}, {ID: 2}, {ID: 3}, {ID: 4}, {ID: 5}}
+	fetch := func(q model.ChirpQuery) ([]model.Chirp, error) {
+		chirps := []model.Chirp{}
+		for _, chirp := range all {
+			if chirp.ID > q.AfterID && len(chirps) < q.Limit {
+				chirps = append(chirps, chirp)
+			}
+		}
+		return chirps, nil
+	}
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/api/chirps?limit=2", nil)
+	chirps, err := fetchPage(w, r, model.ChirpQuery{Limit: 2}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 2 || chirps[1].ID != 2 {
+		t.Fatalf("got %+v, want chirps 1 and 2", chirps)
+	}
+	want := "</api/chirps?cursor=" + encodeCursor(2) + "&limit=2>; rel=\"next\""
+	if link := w.Header().Get("Link"); link != want {
+		t.Errorf("Link = %q, want %q", link, want)
+	}
+
+	// The last page has no Link to a next one.
+	w = httptest.NewRecorder()
+	chirps, err = fetchPage(w, r, model.ChirpQuery{AfterID: 3, Limit: 2}, fetch)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 2 || chirps[1].ID != 5 {
+		t.Fatalf("got %+v, want chirps 4 and 5", chirps)
+	}
+	if link := w.Header().Get("Link"); link != "" {
+		t.Errorf("Link = %q on the last page", link)
+	}
+}
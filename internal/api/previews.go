@@ -0,0 +1,85 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/preview"
+)
+
+// PreviewWorker fetches the previews of links in chirps in the background,
+// so posting a chirp never waits on someone else's server. Chirps still
+// queued when the server stops go without a preview.
+type PreviewWorker struct {
+	db      model.Store
+	fetcher preview.Fetcher
+	queue   chan int
+}
+
+// NewPreviewWorker returns a worker that queues up to size chirps.
+func NewPreviewWorker(db model.Store, fetcher preview.Fetcher, size int) *PreviewWorker {
+	return &PreviewWorker{
+		db:      db,
+		fetcher: fetcher,
+		queue:   make(chan int, size),
+	}
+}
+
+// Enqueue schedules a preview for chirp if it contains a link. A nil worker
+// ignores it, as does a full queue.
+func (p *PreviewWorker) Enqueue(chirp model.Chirp) {
+	if p == nil || chirp.Preview != nil || model.LinkURL(chirp.Body) == "" {
+		return
+	}
+	select {
+	case p.queue <- chirp.ID:
+	default:
+		log.Printf("Preview queue is full, skipping chirp %d\n", chirp.ID)
+	}
+}
+
+// Run fetches previews until ctx is done.
+func (p *PreviewWorker) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case id := <-p.queue:
+			p.fetch(ctx, id)
+		}
+	}
+}
+
+func (p *PreviewWorker) fetch(ctx context.Context, id int) {
+	chirp, err := p.db.GetChirp(id)
+	if err != nil {
+		// Deleted or hidden while it was queued.
+		return
+	}
+	url := model.LinkURL(chirp.Body)
+	if url == "" {
+		return
+	}
+
+	fetched, err := p.fetcher.Fetch(ctx, url)
+	if errors.Is(err, preview.ErrNoPreview) {
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching preview of %s: %s\n", url, err)
+		return
+	}
+
+	err = p.db.SetChirpPreview(id, model.LinkPreview{
+		URL:         url,
+		Title:       fetched.Title,
+		Description: fetched.Description,
+		Image:       fetched.Image,
+		SiteName:    fetched.SiteName,
+	})
+	if err != nil {
+		log.Printf("Error saving preview of chirp %d: %s\n", id, err)
+	}
+}
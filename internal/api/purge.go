@@ -0,0 +1,82 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+type PurgeRespBody struct {
+	Purged int `json:"purged"`
+}
+
+// HandleRestoreChirp undoes the deletion of one of the caller's chirps, if
+// it is still within the restore window.
+func (cfg ApiConfig) HandleRestoreChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	chirp, err := cfg.DB.GetDeletedChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if userID != chirp.AuthorID {
+		respondWithError(w, http.StatusForbidden, "Forbidden request")
+		return
+	}
+	if time.Since(*chirp.DeletedAt) > cfg.ChirpRestoreWindow {
+		respondWithError(w, http.StatusForbidden, "Chirp can no longer be restored")
+		return
+	}
+
+	restored, err := cfg.DB.RestoreChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't restore chirp")
+		return
+	}
+	cfg.respondWithChirp(w, http.StatusOK, restored, userID)
+}
+
+// HandlePurgeChirps purges the deleted chirps whose restore window has
+// passed without waiting for the next RunPurger run.
+func (cfg ApiConfig) HandlePurgeChirps(w http.ResponseWriter, r *http.Request) {
+	purged, err := cfg.DB.PurgeDeletedChirps(time.Now().Add(-cfg.ChirpRestoreWindow))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't purge chirps")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, PurgeRespBody{Purged: purged})
+}
+
+// RunPurger purges, every interval until ctx is done, the deleted chirps
+// whose restore window has passed.
+func (cfg ApiConfig) RunPurger(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		purged, err := cfg.DB.PurgeDeletedChirps(time.Now().Add(-cfg.ChirpRestoreWindow))
+		if err != nil {
+			log.Printf("Error purging deleted chirps: %s\n", err)
+			continue
+		}
+		if purged > 0 {
+			log.Printf("Purged %d deleted chirps\n", purged)
+		}
+	}
+}
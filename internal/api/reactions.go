@@ -0,0 +1,50 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+func (cfg ApiConfig) HandleLikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleReaction(w, r, cfg.DB.LikeChirp)
+}
+
+func (cfg ApiConfig) HandleUnlikeChirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleReaction(w, r, cfg.DB.UnlikeChirp)
+}
+
+func (cfg ApiConfig) HandleRechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleReaction(w, r, cfg.DB.Rechirp)
+}
+
+func (cfg ApiConfig) HandleUndoRechirp(w http.ResponseWriter, r *http.Request) {
+	cfg.handleReaction(w, r, cfg.DB.UndoRechirp)
+}
+
+// handleReaction applies a like or rechirp change for the caller and responds
+// with the updated chirp. The change is idempotent.
+func (cfg ApiConfig) handleReaction(w http.ResponseWriter, r *http.Request, react func(chirpID int, userID int) (model.Chirp, error)) {
+	userID := callerID(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	if _, err := cfg.DB.GetChirp(id); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	chirp, err := react(id, userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp")
+		return
+	}
+
+	cfg.respondWithChirp(w, http.StatusOK, chirp, userID)
+}
@@ -0,0 +1,102 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+const maxReportReasonLength = 500
+
+type ReportReqBody struct {
+	Reason string `json:"reason"`
+}
+
+type ReviewReqBody struct {
+	Note string `json:"note"`
+}
+
+func (cfg ApiConfig) HandleReportChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	reqBody := ReportReqBody{}
+	if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && !errors.Is(err, io.EOF) {
+		msg := fmt.Sprintf("Error decoding request body: %s", err)
+		respondWithError(w, http.StatusBadRequest, msg)
+		return
+	}
+	if len(reqBody.Reason) > maxReportReasonLength {
+		respondWithError(w, http.StatusBadRequest, "Reason is too long")
+		return
+	}
+
+	if _, err := cfg.DB.GetChirp(id); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	report, err := cfg.DB.ReportChirp(id, userID, reqBody.Reason)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't report chirp")
+		return
+	}
+	respondWithJSON(w, http.StatusCreated, report)
+}
+
+func (cfg ApiConfig) HandleGetReviewQueue(w http.ResponseWriter, r *http.Request) {
+	queue, err := cfg.DB.GetReviewQueue()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve review queue")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, queue)
+}
+
+// HandleReviewChirp returns the handler for a moderator action on the chirp
+// named in the URL. The request body may carry a note for the audit log.
+func (cfg ApiConfig) HandleReviewChirp(action model.ReviewAction) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		moderatorID := callerID(r)
+
+		id, err := strconv.Atoi(chi.URLParam(r, "id"))
+		if err != nil {
+			respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+			return
+		}
+
+		reqBody := ReviewReqBody{}
+		if err := json.NewDecoder(r.Body).Decode(&reqBody); err != nil && !errors.Is(err, io.EOF) {
+			msg := fmt.Sprintf("Error decoding request body: %s", err)
+			respondWithError(w, http.StatusBadRequest, msg)
+			return
+		}
+
+		entry, err := cfg.DB.ReviewChirp(id, moderatorID, action, reqBody.Note)
+		if err != nil {
+			respondWithError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		respondWithJSON(w, http.StatusOK, entry)
+	}
+}
+
+func (cfg ApiConfig) HandleGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	entries, err := cfg.DB.GetAuditLog()
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve audit log")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, entries)
+}
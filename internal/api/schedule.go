@@ -0,0 +1,170 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type PendingChirpReqBody struct {
+	Body      string     `json:"body"`
+	PublishAt *time.Time `json:"publish_at"`
+	Draft     bool       `json:"draft"`
+}
+
+// createPendingChirp saves a chirp posted with publish_at or draft, which
+// has passed the checks for a new chirp.
+func (cfg ApiConfig) createPendingChirp(w http.ResponseWriter, pending model.PendingChirp) {
+	if !validatePublishAt(w, pending.PublishAt) {
+		return
+	}
+
+	saved, err := cfg.DB.CreatePendingChirp(pending)
+	if errors.Is(err, model.ErrInvalidMedia) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't create chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusCreated, saved)
+}
+
+// validatePublishAt checks that a requested publication time is in the
+// future. It writes the error response and returns false if it isn't.
+func validatePublishAt(w http.ResponseWriter, publishAt *time.Time) bool {
+	if publishAt != nil && !publishAt.After(time.Now()) {
+		respondWithError(w, http.StatusBadRequest, "publish_at must be in the future")
+		return false
+	}
+	return true
+}
+
+// HandleGetPendingChirps lists the caller's drafts and scheduled chirps.
+func (cfg ApiConfig) HandleGetPendingChirps(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	pending, err := cfg.DB.GetPendingChirps(userID)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, pending)
+}
+
+// getOwnPendingChirp loads the pending chirp named in the URL, checking
+// that the caller wrote it. It writes the error response and returns false
+// otherwise.
+func (cfg ApiConfig) getOwnPendingChirp(w http.ResponseWriter, r *http.Request, userID int) (model.PendingChirp, bool) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return model.PendingChirp{}, false
+	}
+
+	pending, err := cfg.DB.GetPendingChirp(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return model.PendingChirp{}, false
+	}
+	if pending.AuthorID != userID {
+		respondWithError(w, http.StatusForbidden, "Forbidden request")
+		return model.PendingChirp{}, false
+	}
+	return pending, true
+}
+
+// HandlePutPendingChirp replaces the body and schedule of a pending chirp.
+// Clearing draft without giving publish_at publishes the chirp with the
+// scheduler's next run.
+func (cfg ApiConfig) HandlePutPendingChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	pending, ok := cfg.getOwnPendingChirp(w, r, userID)
+	if !ok {
+		return
+	}
+
+	reqBody := PendingChirpReqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqBody)
+	if err != nil {
+		msg := fmt.Sprintf("Error decoding request body: %s", err)
+		respondWithError(w, http.StatusInternalServerError, msg)
+		return
+	}
+
+	if !cfg.validateChirpBody(w, userID, reqBody.Body) || !validatePublishAt(w, reqBody.PublishAt) {
+		return
+	}
+	verdict := cfg.Moderator.Moderate(reqBody.Body)
+	if verdict.Rejected {
+		respondWithError(w, http.StatusBadRequest, "Chirp was rejected by moderation")
+		return
+	}
+
+	pending.Body = verdict.Body
+	pending.Flagged = verdict.Flagged
+	pending.Draft = reqBody.Draft
+	pending.PublishAt = reqBody.PublishAt
+	updated, err := cfg.DB.UpdatePendingChirp(pending)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't update chirp")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, updated)
+}
+
+// HandleDeletePendingChirp cancels a draft or scheduled chirp.
+func (cfg ApiConfig) HandleDeletePendingChirp(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	pending, ok := cfg.getOwnPendingChirp(w, r, userID)
+	if !ok {
+		return
+	}
+
+	if err := cfg.DB.DeletePendingChirp(pending.ID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// RunScheduler publishes the pending chirps that have fallen due, every
+// interval until ctx is done.
+func (cfg ApiConfig) RunScheduler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		published, err := cfg.DB.PublishDueChirps(time.Now())
+		if err != nil {
+			log.Printf("Error publishing scheduled chirps: %s\n", err)
+			continue
+		}
+		for _, chirp := range published {
+			cfg.Previews.Enqueue(chirp)
+		}
+		if len(published) > 0 {
+			log.Printf("Published %d scheduled chirps\n", len(published))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+func (cfg ApiConfig) HandleSearchChirps(w http.ResponseWriter, r *http.Request) {
+	q, err := parseChirpQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	text := r.URL.Query().Get("q")
+	if text == "" {
+		respondWithError(w, http.StatusBadRequest, "Missing search query")
+		return
+	}
+
+	// Results are ordered by relevance rather than ID, so the cursor holds
+	// the offset of the next page instead of the last chirp ID.
+	search := model.SearchQuery{
+		Text:     text,
+		AuthorID: q.AuthorID,
+		Offset:   q.AfterID,
+		Limit:    q.Limit + 1,
+	}
+	chirps, err := cfg.DB.SearchChirps(search)
+	if errors.Is(err, model.ErrEmptySearchQuery) {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't search chirps")
+		return
+	}
+
+	if len(chirps) > q.Limit {
+		chirps = chirps[:q.Limit]
+		next := *r.URL
+		values := next.Query()
+		values.Set("cursor", encodeCursor(search.Offset+q.Limit))
+		next.RawQuery = values.Encode()
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"next\"", next.RequestURI()))
+	}
+
+	cfg.respondWithChirps(w, http.StatusOK, chirps, callerID(r))
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+// maxDeviceLength caps the device label of a session, in bytes.
+const maxDeviceLength = 100
+
+type SessionRespBody struct {
+	model.Session
+	// Current marks the session the request was made with.
+	Current bool `json:"current"`
+}
+
+// startSession starts a session for userID and returns its first refresh
+// token.
+func (cfg ApiConfig) startSession(userID int, device string) (string, model.Session, error) {
+	if len(device) > maxDeviceLength {
+		cut := maxDeviceLength
+		for cut > 0 && !utf8.RuneStart(device[cut]) {
+			cut--
+		}
+		device = device[:cut]
+	}
+
+	token, hash, err := model.NewRefreshToken()
+	if err != nil {
+		return "", model.Session{}, err
+	}
+	session, err := cfg.DB.CreateSession(userID, device, hash, time.Now().Add(cfg.RefreshTokenTTL))
+	if err != nil {
+		return "", model.Session{}, err
+	}
+	return token, session, nil
+}
+
+// HandleGetSessions lists the caller's active sessions.
+func (cfg ApiConfig) HandleGetSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := PrincipalFromContext(r.Context())
+
+	sessions, err := cfg.DB.GetSessions(principal.UserID, time.Now())
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve sessions")
+		return
+	}
+
+	respBody := make([]SessionRespBody, 0, len(sessions))
+	for _, session := range sessions {
+		respBody = append(respBody, SessionRespBody{
+			Session: session,
+			Current: session.ID == principal.SessionID,
+		})
+	}
+	respondWithJSON(w, http.StatusOK, respBody)
+}
+
+// HandleDeleteSession signs the caller out of one of their sessions. Access
+// tokens already issued for it stay valid until they expire.
+func (cfg ApiConfig) HandleDeleteSession(w http.ResponseWriter, r *http.Request) {
+	userID := callerID(r)
+
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid session ID")
+		return
+	}
+
+	session, err := cfg.DB.GetSession(id)
+	if err != nil || session.UserID != userID {
+		// Other users' sessions are reported as missing, not forbidden.
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+	if err := cfg.DB.DeleteSession(id); err != nil {
+		respondWithError(w, http.StatusNotFound, "Session not found")
+		return
+	}
+
+	respondWithJSON(w, http.StatusOK, struct{}{})
+}
+
+// RunSessionPruner deletes expired sessions and refresh tokens every
+// interval until ctx is done.
+func (cfg ApiConfig) RunSessionPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		pruned, err := cfg.DB.PruneSessions(time.Now())
+		if err != nil {
+			log.Printf("Error pruning sessions: %s\n", err)
+			continue
+		}
+		if pruned > 0 {
+			log.Printf("Pruned %d expired sessions\n", pruned)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	defaultTrendingWindow = 24 * time.Hour
+	defaultTrendingLimit  = 10
+)
+
+func (cfg ApiConfig) HandleGetTagChirps(w http.ResponseWriter, r *http.Request) {
+	tag := model.NormalizeTag(chi.URLParam(r, "tag"))
+	if tag == "" {
+		respondWithError(w, http.StatusBadRequest, "Invalid tag")
+		return
+	}
+
+	cfg.respondWithFeed(w, r, func(q model.ChirpQuery) ([]model.Chirp, error) {
+		return cfg.DB.GetChirpsByTag(tag, q)
+	})
+}
+
+func (cfg ApiConfig) HandleGetMentions(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid user ID")
+		return
+	}
+	if _, err := cfg.DB.GetUser(userID); err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	cfg.respondWithFeed(w, r, func(q model.ChirpQuery) ([]model.Chirp, error) {
+		return cfg.DB.GetMentions(userID, q)
+	})
+}
+
+// respondWithFeed serves a page of chirps from fetch, newest first unless
+// the request asks otherwise.
+func (cfg ApiConfig) respondWithFeed(w http.ResponseWriter, r *http.Request, fetch func(model.ChirpQuery) ([]model.Chirp, error)) {
+	q, err := parseChirpQuery(r)
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if r.URL.Query().Get("sort") == "" {
+		q.Order = "desc"
+	}
+
+	chirps, err := fetchPage(w, r, q, fetch)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve chirps")
+		return
+	}
+	cfg.respondWithChirps(w, http.StatusOK, chirps, callerID(r))
+}
+
+// HandleGetTrendingTags lists the hashtags used by the most chirps created
+// within the window query parameter (a duration such as "6h", default 24h).
+func (cfg ApiConfig) HandleGetTrendingTags(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	window := defaultTrendingWindow
+	if s := query.Get("window"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil || d <= 0 {
+			respondWithError(w, http.StatusBadRequest, "Invalid window")
+			return
+		}
+		window = d
+	}
+
+	limit := defaultTrendingLimit
+	if s := query.Get("limit"); s != "" {
+		l, err := strconv.Atoi(s)
+		if err != nil || l < 1 || l > maxPageSize {
+			respondWithError(w, http.StatusBadRequest, fmt.Sprintf("limit must be between 1 and %d", maxPageSize))
+			return
+		}
+		limit = l
+	}
+
+	tags, err := cfg.DB.GetTrendingTags(time.Now().Add(-window), limit)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve trending tags")
+		return
+	}
+	respondWithJSON(w, http.StatusOK, tags)
+}
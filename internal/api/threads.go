@@ -0,0 +1,71 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/go-chi/chi/v5"
+)
+
+type ThreadRespBody struct {
+	Ancestors []ChirpRespBody    `json:"ancestors"`
+	Chirp     ThreadNodeRespBody `json:"chirp"`
+}
+
+type ThreadNodeRespBody struct {
+	ChirpRespBody
+	Replies []ThreadNodeRespBody `json:"replies"`
+}
+
+func (cfg ApiConfig) HandleGetThread(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respondWithError(w, http.StatusBadRequest, "Invalid chirp ID")
+		return
+	}
+
+	thread, err := cfg.DB.GetThread(id)
+	if err != nil {
+		respondWithError(w, http.StatusNotFound, err.Error())
+		return
+	}
+
+	chirps := append([]model.Chirp{}, thread.Ancestors...)
+	var collect func(node model.ThreadNode)
+	collect = func(node model.ThreadNode) {
+		chirps = append(chirps, node.Chirp)
+		for _, reply := range node.Replies {
+			collect(reply)
+		}
+	}
+	collect(thread.Root)
+
+	respBodies, err := cfg.chirpRespBodies(chirps, callerID(r))
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't retrieve thread")
+		return
+	}
+	byID := map[int]ChirpRespBody{}
+	for _, respBody := range respBodies {
+		byID[respBody.ID] = respBody
+	}
+
+	var build func(node model.ThreadNode) ThreadNodeRespBody
+	build = func(node model.ThreadNode) ThreadNodeRespBody {
+		nodeRespBody := ThreadNodeRespBody{
+			ChirpRespBody: byID[node.Chirp.ID],
+			Replies:       make([]ThreadNodeRespBody, 0, len(node.Replies)),
+		}
+		for _, reply := range node.Replies {
+			nodeRespBody.Replies = append(nodeRespBody.Replies, build(reply))
+		}
+		return nodeRespBody
+	}
+
+	respBody := ThreadRespBody{
+		Ancestors: respBodies[:len(thread.Ancestors)],
+		Chirp:     build(thread.Root),
+	}
+	respondWithJSON(w, http.StatusOK, respBody)
+}
@@ -1,77 +1,74 @@
 package api
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"strconv"
-	"strings"
+	"time"
 
 	"github.com/christopherplain/chirpy/internal/model"
 )
 
 type RefreshRespBody struct {
-	Token string `json:"token"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
 }
 
+// HandleRefresh exchanges a refresh token for an access token and a new
+// refresh token. The old refresh token can't be used again: presenting it
+// a second time ends the session.
 func (cfg ApiConfig) HandleRefresh(w http.ResponseWriter, r *http.Request) {
-	tokenString := strings.Split(r.Header.Get("Authorization"), " ")[1]
-	token, err := model.ValidateJWT(tokenString, cfg.JwtSecret)
+	oldToken, err := bearerToken(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
-		return
-	}
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil || issuer != "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
-		return
-	}
-	isRevoked, err := cfg.DB.IsTokenRevoked(tokenString)
-	if err != nil || isRevoked {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+		respondUnauthorized(w, err)
 		return
 	}
 
-	idString, err := token.Claims.GetSubject()
+	newToken, newHash, err := model.NewRefreshToken()
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
-	id, err := strconv.Atoi(idString)
+	now := time.Now()
+	session, err := cfg.DB.RefreshSession(model.HashRefreshToken(oldToken), newHash, now, now.Add(cfg.RefreshTokenTTL))
+	if errors.Is(err, model.ErrRefreshTokenReused) {
+		log.Printf("Refresh token reused, its session was ended\n")
+	}
+	if errors.Is(err, model.ErrInvalidRefreshToken) || errors.Is(err, model.ErrRefreshTokenReused) {
+		respondUnauthorized(w, err)
+		return
+	}
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	newToken, err := model.GenerateAccessToken(cfg.JwtSecret, id)
+	accessToken, err := model.GenerateAccessToken(cfg.Keys, session.UserID, session.ID)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
 	respBody := RefreshRespBody{
-		Token: newToken,
+		Token:        accessToken,
+		RefreshToken: newToken,
 	}
 	respondWithJSON(w, http.StatusOK, respBody)
 }
 
+// HandleRevoke ends the session the refresh token belongs to.
 func (cfg ApiConfig) HandleRevoke(w http.ResponseWriter, r *http.Request) {
-	tokenString := strings.Split(r.Header.Get("Authorization"), " ")[1]
-	token, err := model.ValidateJWT(tokenString, cfg.JwtSecret)
+	token, err := bearerToken(r)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
-		return
-	}
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil || issuer != "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+		respondUnauthorized(w, err)
 		return
 	}
-	isRevoked, err := cfg.DB.IsTokenRevoked(tokenString)
-	if err != nil || isRevoked {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+
+	err = cfg.DB.DeleteSessionByToken(model.HashRefreshToken(token))
+	if errors.Is(err, model.ErrInvalidRefreshToken) {
+		respondUnauthorized(w, err)
 		return
 	}
-
-	err = cfg.DB.RevokeToken(tokenString)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, err.Error())
 		return
@@ -2,10 +2,9 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
 
 	"github.com/christopherplain/chirpy/internal/model"
 )
@@ -13,12 +12,18 @@ import (
 type UserReqBody struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
+	Handle   string `json:"handle"`
+	// Device labels the session started by logging in. It defaults to the
+	// User-Agent.
+	Device string `json:"device"`
 }
 
 type UserRespBody struct {
 	ID           int    `json:"id"`
 	Email        string `json:"email"`
 	IsChirpyRed  bool   `json:"is_chirpy_red"`
+	Handle       string `json:"handle,omitempty"`
+	IsAdmin      bool   `json:"is_admin,omitempty"`
 	Token        string `json:"token,omitempty"`
 	RefreshToken string `json:"refresh_token,omitempty"`
 }
@@ -39,20 +44,34 @@ func (cfg ApiConfig) HandleUserLogin(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	device := reqBody.Device
+	if device == "" {
+		device = r.UserAgent()
+	}
+	cfg.respondWithLogin(w, user, device)
+}
+
+// respondWithLogin starts a session for user on device and responds with
+// the user and the session's tokens.
+func (cfg ApiConfig) respondWithLogin(w http.ResponseWriter, user model.User, device string) {
 	respBody := UserRespBody{
 		ID:          user.ID,
 		Email:       user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		IsAdmin:     user.IsAdmin,
 	}
 
-	token, err := model.GenerateAccessToken(cfg.JwtSecret, user.ID)
-	if err == nil {
-		respBody.Token = token
+	refreshToken, session, err := cfg.startSession(user.ID, device)
+	if err != nil {
+		respondWithError(w, http.StatusInternalServerError, "Couldn't start session")
+		return
 	}
+	respBody.RefreshToken = refreshToken
 
-	token, err = model.GenerateRefreshToken(cfg.JwtSecret, user.ID)
+	token, err := model.GenerateAccessToken(cfg.Keys, user.ID, session.ID)
 	if err == nil {
-		respBody.RefreshToken = token
+		respBody.Token = token
 	}
 
 	respondWithJSON(w, http.StatusOK, respBody)
@@ -78,44 +97,38 @@ func (cfg ApiConfig) HandlePostUser(w http.ResponseWriter, r *http.Request) {
 		ID:          savedUser.ID,
 		Email:       savedUser.Email,
 		IsChirpyRed: savedUser.IsChirpyRed,
+		Handle:      savedUser.Handle,
+		IsAdmin:     savedUser.IsAdmin,
 	}
 	respondWithJSON(w, http.StatusCreated, respBody)
 }
 
 func (cfg ApiConfig) HandlePutUser(w http.ResponseWriter, r *http.Request) {
-	tokenString := strings.Split(r.Header.Get("Authorization"), " ")[1]
-	token, err := model.ValidateJWT(tokenString, cfg.JwtSecret)
+	id := callerID(r)
+
+	reqBody := UserReqBody{}
+	decoder := json.NewDecoder(r.Body)
+	err := decoder.Decode(&reqBody)
 	if err != nil {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
-		return
-	}
-	issuer, err := token.Claims.GetIssuer()
-	if err != nil || issuer == "chirpy-refresh" {
-		respondWithError(w, http.StatusUnauthorized, "Token is invalid or expired")
+		msg := fmt.Sprintf("Error decoding request body: %s", err)
+		respondWithError(w, http.StatusInternalServerError, msg)
 		return
 	}
 
-	idString, err := token.Claims.GetSubject()
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+	if reqBody.Handle != "" && !model.ValidateHandle(reqBody.Handle) {
+		respondWithError(w, http.StatusBadRequest, "Handle must be 1 to 30 letters, digits or underscores")
 		return
 	}
-	id, err := strconv.Atoi(idString)
-	if err != nil {
-		respondWithError(w, http.StatusInternalServerError, "Unable to update user")
+
+	user, err := cfg.DB.UpdateUser(id, reqBody.Email, reqBody.Password, reqBody.Handle, nil)
+	if errors.Is(err, model.ErrHandleTaken) {
+		respondWithError(w, http.StatusConflict, "Handle is already taken")
 		return
 	}
-
-	reqBody := UserReqBody{}
-	decoder := json.NewDecoder(r.Body)
-	err = decoder.Decode(&reqBody)
-	if err != nil {
-		msg := fmt.Sprintf("Error decoding request body: %s", err)
-		respondWithError(w, http.StatusInternalServerError, msg)
+	if errors.Is(err, model.ErrEmailTaken) {
+		respondWithError(w, http.StatusConflict, "Email is already taken")
 		return
 	}
-
-	user, err := cfg.DB.UpdateUser(id, reqBody.Email, reqBody.Password, nil)
 	if err != nil {
 		respondWithError(w, http.StatusInternalServerError, "Couldn't update user")
 		return
@@ -125,6 +138,8 @@ func (cfg ApiConfig) HandlePutUser(w http.ResponseWriter, r *http.Request) {
 		ID:          user.ID,
 		Email:       user.Email,
 		IsChirpyRed: user.IsChirpyRed,
+		Handle:      user.Handle,
+		IsAdmin:     user.IsAdmin,
 	}
 	respondWithJSON(w, http.StatusOK, respBody)
 }
@@ -15,9 +15,11 @@ type PolkaReqBody struct {
 }
 
 func (cfg ApiConfig) HandlePolkaWebhook(w http.ResponseWriter, r *http.Request) {
-	authHeader := strings.Split(r.Header.Get("Authorization"), " ")
-	if len(authHeader) < 2 || authHeader[1] != cfg.PolkaKey {
+	_, key, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+	if !ok || key != cfg.PolkaKey {
+		w.Header().Set("WWW-Authenticate", `ApiKey realm="polka"`)
 		respondWithError(w, http.StatusUnauthorized, "Not authorized")
+		return
 	}
 
 	reqBody := PolkaReqBody{}
@@ -31,7 +33,7 @@ func (cfg ApiConfig) HandlePolkaWebhook(w http.ResponseWriter, r *http.Request)
 
 	if reqBody.Event == "user.upgraded" {
 		isChirpyRed := true
-		_, err = cfg.DB.UpdateUser(reqBody.Data.UserID, "", "", &isChirpyRed)
+		_, err = cfg.DB.UpdateUser(reqBody.Data.UserID, "", "", "", &isChirpyRed)
 		if err != nil {
 			respondWithError(w, http.StatusNotFound, "User not found")
 			return
@@ -0,0 +1,80 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Generate writes a new private key for alg ("EdDSA" or "RS256") to dir
+// and returns its ID. IDs start with a timestamp, so the new key sorts after
+// the existing ones and signs new tokens once the ring is reloaded.
+func Generate(dir string, alg string) (string, error) {
+	var private interface{}
+	var err error
+	switch alg {
+	case "EdDSA":
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	case "RS256":
+		private, err = rsa.GenerateKey(rand.Reader, minRSABits)
+	default:
+		return "", fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	if err != nil {
+		return "", err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	suffix := make([]byte, 3)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", err
+	}
+	id := time.Now().UTC().Format("20060102T150405Z") + "-" + hex.EncodeToString(suffix)
+	file, err := os.OpenFile(filepath.Join(dir, id+".pem"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o600)
+	if err != nil {
+		return "", err
+	}
+	if err := pem.Encode(file, &pem.Block{Type: "PRIVATE KEY", Bytes: der}); err != nil {
+		file.Close()
+		return "", err
+	}
+	return id, file.Close()
+}
+
+// Retire replaces the private key with ID id in dir by its public key, so
+// it stops signing tokens but still verifies those it signed.
+func Retire(dir string, id string) error {
+	path := filepath.Join(dir, id+".pem")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	key, err := ParseKey(id, data)
+	if err != nil {
+		return err
+	}
+	der, err := x509.MarshalPKIXPublicKey(key.Public)
+	if err != nil {
+		return err
+	}
+
+	tmp := path + ".tmp"
+	err = os.WriteFile(tmp, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), 0o600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,238 @@
+// Package keys manages the keys Chirpy signs its tokens with.
+package keys
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSABits is the smallest RSA key accepted.
+const minRSABits = 2048
+
+// ErrUnknownKey is returned when a token names a key that isn't in the ring.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// Key is a key in a Ring. Retired keys have no private half and are only
+// used to verify tokens signed before they were retired.
+type Key struct {
+	// ID is the kid of the key: the name of its file without ".pem".
+	ID      string
+	Method  jwt.SigningMethod
+	Private crypto.Signer
+	Public  crypto.PublicKey
+}
+
+// Ring is the set of keys tokens are signed and verified with. Tokens are
+// signed with the private key whose ID sorts last, so a new key, named to
+// sort after the others, takes over when the ring is reloaded while the
+// older keys go on verifying the tokens they signed.
+//
+// Without a key directory the ring signs with HS256 and the shared secret.
+// With one, the secret, if set, still verifies HS256 tokens that have no kid,
+// so tokens issued before switching keep working until they expire.
+type Ring struct {
+	dir    string
+	secret []byte
+
+	mu      sync.RWMutex
+	keys    map[string]Key
+	signing *Key
+}
+
+// NewRing loads the keys in dir, or uses only secret if dir is empty.
+func NewRing(dir string, secret string) (*Ring, error) {
+	r := &Ring{dir: dir, keys: map[string]Key{}}
+	if secret != "" {
+		r.secret = []byte(secret)
+	}
+	if dir == "" {
+		return r, nil
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload rereads the key directory. If it can't be loaded the previous keys
+// stay in effect.
+func (r *Ring) Reload() error {
+	if r.dir == "" {
+		return nil
+	}
+	keys, err := LoadDir(r.dir)
+	if err != nil {
+		return err
+	}
+
+	var signing *Key
+	ids := make([]string, 0, len(keys))
+	for id := range keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	for _, id := range ids {
+		if key := keys[id]; key.Private != nil {
+			signing = &key
+		}
+	}
+	if signing == nil {
+		return fmt.Errorf("no private key in %s", r.dir)
+	}
+
+	r.mu.Lock()
+	r.keys = keys
+	r.signing = signing
+	r.mu.Unlock()
+	return nil
+}
+
+// SigningKeyID returns the ID of the key new tokens are signed with, or ""
+// when they are signed with the shared secret.
+func (r *Ring) SigningKeyID() string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.signing == nil {
+		return ""
+	}
+	return r.signing.ID
+}
+
+// Sign returns the signed token for claims, with the ID of the key in its
+// kid header.
+func (r *Ring) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	signing := r.signing
+	r.mu.RUnlock()
+
+	if signing == nil {
+		return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(r.secret)
+	}
+	token := jwt.NewWithClaims(signing.Method, claims)
+	token.Header["kid"] = signing.ID
+	return token.SignedString(signing.Private)
+}
+
+// Keyfunc returns the key to verify token with. The token's algorithm must
+// be the one of the key its kid names.
+func (r *Ring) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if r.secret == nil || token.Method.Alg() != jwt.SigningMethodHS256.Alg() {
+			return nil, ErrUnknownKey
+		}
+		return r.secret, nil
+	}
+
+	r.mu.RLock()
+	key, ok := r.keys[kid]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("key %s is for %s, not %s", kid, key.Method.Alg(), token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// Methods are the algorithms tokens may be signed with.
+func (r *Ring) Methods() []string {
+	return []string{
+		jwt.SigningMethodHS256.Alg(),
+		jwt.SigningMethodRS256.Alg(),
+		jwt.SigningMethodEdDSA.Alg(),
+	}
+}
+
+// Keys returns the keys in the ring, sorted by ID. The shared secret isn't
+// included.
+func (r *Ring) Keys() []Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	keys := make([]Key, 0, len(r.keys))
+	for _, key := range r.keys {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i].ID < keys[j].ID })
+	return keys
+}
+
+// LoadDir reads the keys in the .pem files in dir, keyed by ID. Each file
+// holds an RSA or Ed25519 private key, or for a retired key just the
+// public key.
+func LoadDir(dir string) (map[string]Key, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	keys := map[string]Key{}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+		key, err := ParseKey(id, data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		keys[id] = key
+	}
+	return keys, nil
+}
+
+// ParseKey parses a PEM-encoded key.
+func ParseKey(id string, data []byte) (Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return Key{}, errors.New("no PEM data")
+	}
+
+	var parsed interface{}
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return Key{}, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return Key{}, err
+	}
+
+	key := Key{ID: id}
+	if signer, ok := parsed.(crypto.Signer); ok {
+		key.Private = signer
+		parsed = signer.Public()
+	}
+	switch public := parsed.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSABits {
+			return Key{}, fmt.Errorf("RSA key is smaller than %d bits", minRSABits)
+		}
+		key.Method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.Method = jwt.SigningMethodEdDSA
+	default:
+		return Key{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+	key.Public = parsed
+	return key, nil
+}
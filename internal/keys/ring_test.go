@@ -0,0 +1,248 @@
+package keys
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// generateAs generates a key for alg in dir and renames it to id, so tests
+// control which key sorts last.
+func generateAs(t *testing.T, dir string, alg string, id string) {
+	t.Helper()
+	generated, err := Generate(dir, alg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(filepath.Join(dir, generated+".pem"), filepath.Join(dir, id+".pem")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSign(t *testing.T, r *Ring) string {
+	t.Helper()
+	token, err := r.Sign(jwt.RegisteredClaims{Subject: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// verify parses token with r and returns its kid.
+func verify(r *Ring, token string) (string, error) {
+	parsed, err := jwt.Parse(token, r.Keyfunc, jwt.WithValidMethods(r.Methods()))
+	if err != nil {
+		return "", err
+	}
+	kid, _ := parsed.Header["kid"].(string)
+	return kid, nil
+}
+
+func TestRingRotation(t *testing.T) {
+	dir := t.TempDir()
+	generateAs(t, dir, "EdDSA", "a")
+	r, err := NewRing(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := r.SigningKeyID(); id != "a" {
+		t.Fatalf("SigningKeyID = %q, want a", id)
+	}
+	old := mustSign(t, r)
+	if kid, err := verify(r, old); err != nil || kid != "a" {
+		t.Fatalf("verify = %q, %v", kid, err)
+	}
+
+	// The new key takes over only once the ring is reloaded.
+	generateAs(t, dir, "EdDSA", "b")
+	if id := r.SigningKeyID(); id != "a" {
+		t.Errorf("SigningKeyID before reloading = %q, want a", id)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if kid, err := verify(r, mustSign(t, r)); err != nil || kid != "b" {
+		t.Errorf("new token: kid %q, %v; want b", kid, err)
+	}
+	if _, err := verify(r, old); err != nil {
+		t.Errorf("token signed before the rotation: %s", err)
+	}
+
+	// A retired key still verifies what it signed.
+	if err := Retire(dir, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verify(r, old); err != nil {
+		t.Errorf("token signed by a retired key: %s", err)
+	}
+	for _, key := range r.Keys() {
+		if key.ID == "a" && key.Private != nil {
+			t.Error("the retired key still has its private half")
+		}
+	}
+}
+
+func TestRingReloadErrors(t *testing.T) {
+	dir := t.TempDir()
+	generateAs(t, dir, "EdDSA", "a")
+	r, err := NewRing(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A broken file leaves the keys as they were.
+	if err := os.WriteFile(filepath.Join(dir, "b.pem"), []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload of a broken key succeeded")
+	}
+	if id := r.SigningKeyID(); id != "a" {
+		t.Errorf("SigningKeyID after a failed reload = %q, want a", id)
+	}
+	if err := os.Remove(filepath.Join(dir, "b.pem")); err != nil {
+		t.Fatal(err)
+	}
+
+	// So does retiring the last private key.
+	if err := Retire(dir, "a"); err != nil {
+		t.Fatal(err)
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload without a private key succeeded")
+	}
+	if _, err := verify(r, mustSign(t, r)); err != nil {
+		t.Errorf("signing after a failed reload: %s", err)
+	}
+	if _, err := NewRing(dir, ""); err == nil {
+		t.Error("NewRing without a private key succeeded")
+	}
+
+	if _, err := NewRing(t.TempDir(), ""); err == nil {
+		t.Error("NewRing of an empty directory succeeded")
+	}
+}
+
+func TestRingKeyfuncRejects(t *testing.T) {
+	dir := t.TempDir()
+	generateAs(t, dir, "EdDSA", "a")
+	r, err := NewRing(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs256 := func(kid string, secret string) string {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "1"})
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	other := t.TempDir()
+	generateAs(t, other, "EdDSA", "z")
+	stranger, err := NewRing(other, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verify(r, mustSign(t, stranger)); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("unknown kid: got %v, want ErrUnknownKey", err)
+	}
+	// An HS256 token naming a public key mustn't be checked against it.
+	if _, err := verify(r, hs256("a", "a")); err == nil {
+		t.Error("HS256 token with the kid of an EdDSA key verified")
+	}
+	if _, err := verify(r, hs256("", "secret")); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("HS256 token without a secret: got %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestRingSecret(t *testing.T) {
+	secretOnly, err := NewRing("", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := secretOnly.SigningKeyID(); id != "" {
+		t.Errorf("SigningKeyID = %q, want none", id)
+	}
+	legacy := mustSign(t, secretOnly)
+	if kid, err := verify(secretOnly, legacy); err != nil || kid != "" {
+		t.Fatalf("verify = %q, %v", kid, err)
+	}
+
+	// After switching to keys, the secret still verifies the old tokens but
+	// no longer signs.
+	dir := t.TempDir()
+	generateAs(t, dir, "EdDSA", "a")
+	r, err := NewRing(dir, "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := verify(r, legacy); err != nil {
+		t.Errorf("token signed with the secret: %s", err)
+	}
+	if kid, err := verify(r, mustSign(t, r)); err != nil || kid != "a" {
+		t.Errorf("new token: kid %q, %v; want a", kid, err)
+	}
+}
+
+func TestRingJWKS(t *testing.T) {
+	dir := t.TempDir()
+	generateAs(t, dir, "EdDSA", "a")
+	generateAs(t, dir, "RS256", "b")
+	if err := Retire(dir, "a"); err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewRing(dir, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id := r.SigningKeyID(); id != "b" {
+		t.Fatalf("SigningKeyID = %q, want b", id)
+	}
+
+	set := r.JWKS()
+	if len(set.Keys) != 2 {
+		t.Fatalf("JWKS has %d keys, want 2", len(set.Keys))
+	}
+	keys := r.Keys()
+	ed, rsaKey := set.Keys[0], set.Keys[1]
+	if ed.Kid != "a" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" || ed.Use != "sig" {
+		t.Errorf("Ed25519 JWK = %+v", ed)
+	}
+	if x := base64.RawURLEncoding.EncodeToString(keys[0].Public.(ed25519.PublicKey)); ed.X != x {
+		t.Errorf("x = %s, want %s", ed.X, x)
+	}
+	if rsaKey.Kid != "b" || rsaKey.Kty != "RSA" || rsaKey.Alg != "RS256" || rsaKey.E != "AQAB" {
+		t.Errorf("RSA JWK = %+v", rsaKey)
+	}
+	if n := base64.RawURLEncoding.EncodeToString(keys[1].Public.(*rsa.PublicKey).N.Bytes()); rsaKey.N != n {
+		t.Error("n doesn't match the public key")
+	}
+}
+
+func TestParseKeyRejectsSmallRSA(t *testing.T) {
+	private, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(private)})
+	if _, err := ParseKey("small", data); err == nil {
+		t.Error("ParseKey accepted a 1024-bit RSA key")
+	}
+}
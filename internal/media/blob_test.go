@@ -0,0 +1,105 @@
+package media
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestNewKey(t *testing.T) {
+	a, err := NewKey(".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := NewKey(".png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a == b {
+		t.Errorf("NewKey returned %q twice", a)
+	}
+	if !keyRegexp.MatchString(a) {
+		t.Errorf("NewKey returned %q, which LocalStore refuses", a)
+	}
+}
+
+func TestLocalStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "media")
+	store, err := NewLocalStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := NewKey(".jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := store.Put(key, strings.NewReader("image data")); err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Open(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(r)
+	r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "image data" {
+		t.Errorf("Open returned %q", data)
+	}
+
+	// Only the blob is left in the directory, not the temporary file.
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 || entries[0].Name() != key {
+		t.Errorf("the directory holds %v, want just %s", entries, key)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Open(key); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Open after Delete: got %v, want ErrNotExist", err)
+	}
+	// Deleting a missing blob is not an error.
+	if err := store.Delete(key); err != nil {
+		t.Errorf("second Delete: %s", err)
+	}
+}
+
+func TestLocalStoreRejectsKeys(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewLocalStore(filepath.Join(dir, "media"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "secret.txt"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, key := range []string{
+		"../secret.txt",
+		"0123456789abcdef0123456789abcdef.jpg/../../secret.txt",
+		"/etc/passwd",
+		"notakey.jpg",
+		"0123456789ABCDEF0123456789ABCDEF.jpg",
+		"",
+	} {
+		if _, err := store.Open(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Open(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Put(key, strings.NewReader("x")); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Put(%q): got %v, want ErrInvalidKey", key, err)
+		}
+		if err := store.Delete(key); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Delete(%q): got %v, want ErrInvalidKey", key, err)
+		}
+	}
+}
@@ -0,0 +1,215 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// ErrUnsupportedType is returned for uploads that aren't a supported image
+// format.
+var ErrUnsupportedType = errors.New("unsupported media type")
+
+// ErrMalformed is returned for images that can't be parsed.
+var ErrMalformed = errors.New("malformed image")
+
+// Extensions maps the supported content types to file extensions.
+var Extensions = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+// Sanitize sniffs the type of an uploaded image from its content, ignoring
+// whatever type the client claimed, and removes metadata such as EXIF
+// (which can include the location a photo was taken) from it.
+func Sanitize(data []byte) ([]byte, string, error) {
+	contentType := http.DetectContentType(data)
+	var err error
+	switch contentType {
+	case "image/jpeg":
+		data, err = stripJPEG(data)
+	case "image/png":
+		data, err = stripPNG(data)
+	case "image/gif":
+		data, err = stripGIF(data)
+	default:
+		return nil, "", fmt.Errorf("%w: %s", ErrUnsupportedType, contentType)
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return data, contentType, nil
+}
+
+// stripJPEG drops the APP1 (EXIF and XMP), APP13 (IPTC) and comment
+// segments from a JPEG. Fill bytes before markers are dropped too.
+// Everything from the start of scan on is copied unchanged.
+func stripJPEG(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:2])
+
+	for i := 2; ; {
+		if i >= len(data) || data[i] != 0xFF {
+			return nil, ErrMalformed
+		}
+		for i+1 < len(data) && data[i+1] == 0xFF {
+			i++
+		}
+		if i+4 > len(data) {
+			return nil, ErrMalformed
+		}
+		marker := data[i+1]
+		if marker == 0xDA {
+			out.Write(data[i:])
+			return out.Bytes(), nil
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		end := i + 2 + length
+		if length < 2 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		switch marker {
+		case 0xE1, 0xED, 0xFE:
+		default:
+			out.Write(data[i:end])
+		}
+		i = end
+	}
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+// pngMetadataChunks are the PNG chunks holding metadata rather than image
+// data.
+var pngMetadataChunks = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(pngSignature)
+
+	for i := len(pngSignature); i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrMalformed
+		}
+		length := int(binary.BigEndian.Uint32(data[i:]))
+		chunkType := string(data[i+4 : i+8])
+		end := i + 12 + length
+		if length < 0 || end > len(data) {
+			return nil, ErrMalformed
+		}
+		if !pngMetadataChunks[chunkType] {
+			out.Write(data[i:end])
+		}
+		i = end
+		if chunkType == "IEND" {
+			break
+		}
+	}
+	return out.Bytes(), nil
+}
+
+// gifLoopExtensions are the application extensions that make an animated GIF
+// loop. Every other application extension is metadata.
+var gifLoopExtensions = map[string]bool{
+	"NETSCAPE2.0": true,
+	"ANIMEXTS1.0": true,
+}
+
+// stripGIF drops the comment and application extensions from a GIF, except
+// those that make it loop.
+func stripGIF(data []byte) ([]byte, error) {
+	// The header is followed by the 7 byte logical screen descriptor.
+	i := 13
+	if len(data) < i {
+		return nil, ErrMalformed
+	}
+	i += gifColorTableSize(data[10])
+	if i > len(data) {
+		return nil, ErrMalformed
+	}
+	out := bytes.NewBuffer(make([]byte, 0, len(data)))
+	out.Write(data[:i])
+
+	for {
+		if i >= len(data) {
+			return nil, ErrMalformed
+		}
+		switch data[i] {
+		case 0x3B: // trailer
+			out.WriteByte(0x3B)
+			return out.Bytes(), nil
+		case 0x21: // extension
+			if i+2 > len(data) {
+				return nil, ErrMalformed
+			}
+			end, err := gifSubBlocksEnd(data, i+2)
+			if err != nil {
+				return nil, err
+			}
+			label := data[i+1]
+			keep := label != 0xFE && label != 0xFF
+			if label == 0xFF && i+14 <= end && data[i+2] == 11 {
+				keep = gifLoopExtensions[string(data[i+3:i+14])]
+			}
+			if keep {
+				out.Write(data[i:end])
+			}
+			i = end
+		case 0x2C: // image descriptor
+			start := i
+			i += 10
+			if i > len(data) {
+				return nil, ErrMalformed
+			}
+			// The LZW minimum code size comes before the image data.
+			i += gifColorTableSize(data[i-1]) + 1
+			end, err := gifSubBlocksEnd(data, i)
+			if err != nil {
+				return nil, err
+			}
+			out.Write(data[start:end])
+			i = end
+		default:
+			return nil, ErrMalformed
+		}
+	}
+}
+
+// gifColorTableSize returns the size of the color table described by the
+// packed fields of a logical screen or image descriptor.
+func gifColorTableSize(packed byte) int {
+	if packed&0x80 == 0 {
+		return 0
+	}
+	return 3 << (packed&0x07 + 1)
+}
+
+// gifSubBlocksEnd returns the offset just past the sequence of data
+// sub-blocks starting at i, including its terminating empty block.
+func gifSubBlocksEnd(data []byte, i int) (int, error) {
+	for {
+		if i >= len(data) {
+			return 0, ErrMalformed
+		}
+		size := int(data[i])
+		i += 1 + size
+		if size == 0 {
+			return i, nil
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package media
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+func testImage() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for x := 0; x < 8; x++ {
+		for y := 0; y < 8; y++ {
+			img.Set(x, y, color.RGBA{uint8(x * 32), uint8(y * 32), 128, 255})
+		}
+	}
+	return img
+}
+
+// jpegSegment returns a JPEG marker segment holding payload.
+func jpegSegment(marker byte, payload string) []byte {
+	segment := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(segment[2:], uint16(len(payload)+2))
+	return append(segment, payload...)
+}
+
+// testJPEG encodes a JPEG and inserts segments right after its SOI marker,
+// where cameras put their metadata.
+func testJPEG(t *testing.T, segments ...[]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := jpeg.Encode(buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	out := append([]byte{}, data[:2]...)
+	for _, segment := range segments {
+		out = append(out, segment...)
+	}
+	return append(out, data[2:]...)
+}
+
+// pngChunk returns a PNG chunk of the given type holding payload.
+func pngChunk(chunkType string, payload string) []byte {
+	chunk := make([]byte, 8, 12+len(payload))
+	binary.BigEndian.PutUint32(chunk, uint32(len(payload)))
+	copy(chunk[4:], chunkType)
+	chunk = append(chunk, payload...)
+	return binary.BigEndian.AppendUint32(chunk, crc32.ChecksumIEEE(chunk[4:]))
+}
+
+// testPNG encodes a PNG and inserts chunks right after its IHDR chunk.
+func testPNG(t *testing.T, chunks ...[]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, testImage()); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// The signature is followed by the 13 byte IHDR chunk.
+	ihdrEnd := len(pngSignature) + 12 + 13
+	out := append([]byte{}, data[:ihdrEnd]...)
+	for _, chunk := range chunks {
+		out = append(out, chunk...)
+	}
+	return append(out, data[ihdrEnd:]...)
+}
+
+func TestSanitizeJPEG(t *testing.T) {
+	data := testJPEG(t,
+		jpegSegment(0xE0, "JFIF\x00\x01\x01\x00\x00\x01\x00\x01\x00\x00"),
+		jpegSegment(0xE1, "Exif\x00\x00GPS 41.40338, 2.17403"),
+		jpegSegment(0xE1, "http://ns.adobe.com/xap/1.0/\x00<x:xmpmeta>secret</x:xmpmeta>"),
+		jpegSegment(0xED, "Photoshop 3.0\x00IPTC byline"),
+		jpegSegment(0xFE, "taken at home"),
+		// Any number of fill bytes may come before a marker.
+		append([]byte{0xFF, 0xFF}, jpegSegment(0xE1, "Exif\x00\x00GPS after fill bytes")...),
+	)
+
+	clean, contentType, err := Sanitize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/jpeg" {
+		t.Errorf("content type = %q, want image/jpeg", contentType)
+	}
+	for _, secret := range []string{"GPS", "xmpmeta", "IPTC", "taken at home"} {
+		if bytes.Contains(clean, []byte(secret)) {
+			t.Errorf("%q survived sanitizing", secret)
+		}
+	}
+	if !bytes.Contains(clean, []byte("JFIF")) {
+		t.Error("the JFIF segment was dropped")
+	}
+	if _, err := jpeg.Decode(bytes.NewReader(clean)); err != nil {
+		t.Errorf("the sanitized JPEG doesn't decode: %s", err)
+	}
+}
+
+func TestSanitizePNG(t *testing.T) {
+	data := testPNG(t,
+		pngChunk("tEXt", "Comment\x00taken at home"),
+		pngChunk("eXIf", "MM\x00*GPS"),
+		pngChunk("iTXt", "XML:com.adobe.xmp\x00\x00\x00\x00\x00<x:xmpmeta/>"),
+		pngChunk("tIME", "\x07\xe8\x01\x02\x03\x04\x05"),
+	)
+
+	clean, contentType, err := Sanitize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/png" {
+		t.Errorf("content type = %q, want image/png", contentType)
+	}
+	for _, chunkType := range []string{"tEXt", "eXIf", "iTXt", "tIME", "taken at home"} {
+		if bytes.Contains(clean, []byte(chunkType)) {
+			t.Errorf("%q survived sanitizing", chunkType)
+		}
+	}
+	if _, err := png.Decode(bytes.NewReader(clean)); err != nil {
+		t.Errorf("the sanitized PNG doesn't decode: %s", err)
+	}
+}
+
+// gifExtension returns a GIF extension block with the given label holding
+// blocks as its data sub-blocks.
+func gifExtension(label byte, blocks ...string) []byte {
+	extension := []byte{0x21, label}
+	for _, block := range blocks {
+		extension = append(extension, byte(len(block)))
+		extension = append(extension, block...)
+	}
+	return append(extension, 0)
+}
+
+// testGIF encodes a GIF and inserts extensions right before its first image,
+// where encoders put their metadata.
+func testGIF(t *testing.T, extensions ...[]byte) []byte {
+	t.Helper()
+	buf := &bytes.Buffer{}
+	if err := gif.Encode(buf, testImage(), nil); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	headerEnd := 13 + gifColorTableSize(data[10])
+	out := append([]byte{}, data[:headerEnd]...)
+	for _, extension := range extensions {
+		out = append(out, extension...)
+	}
+	return append(out, data[headerEnd:]...)
+}
+
+func TestSanitizeGIF(t *testing.T) {
+	data := testGIF(t,
+		gifExtension(0xFF, "NETSCAPE2.0", "\x01\x00\x00"),
+		gifExtension(0xFE, "taken at home"),
+		gifExtension(0xFF, "XMP DataXMP", "<x:xmpmeta>secret</x:xmpmeta>"),
+	)
+
+	clean, contentType, err := Sanitize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if contentType != "image/gif" {
+		t.Errorf("content type = %q, want image/gif", contentType)
+	}
+	for _, secret := range []string{"taken at home", "XMP", "xmpmeta"} {
+		if bytes.Contains(clean, []byte(secret)) {
+			t.Errorf("%q survived sanitizing", secret)
+		}
+	}
+	decoded, err := gif.DecodeAll(bytes.NewReader(clean))
+	if err != nil {
+		t.Fatalf("the sanitized GIF doesn't decode: %s", err)
+	}
+	if decoded.LoopCount != 0 {
+		t.Errorf("LoopCount = %d, want 0: the looping extension was dropped", decoded.LoopCount)
+	}
+}
+
+func TestSanitizeUnsupported(t *testing.T) {
+	for name, data := range map[string][]byte{
+		"text":  []byte("just some text"),
+		"html":  []byte("<html><body>hi</body></html>"),
+		"pdf":   []byte("%PDF-1.4\n"),
+		"empty": {},
+	} {
+		if _, _, err := Sanitize(data); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("%s: got %v, want ErrUnsupportedType", name, err)
+		}
+	}
+}
+
+func TestSanitizeMalformed(t *testing.T) {
+	jpegData := testJPEG(t)
+	pngData := testPNG(t)
+	gifData := testGIF(t)
+	for name, data := range map[string][]byte{
+		"truncated JPEG":          jpegData[:20],
+		"JPEG segment overruns":   append(append([]byte{}, jpegData[:2]...), 0xFF, 0xE1, 0xFF, 0xFF, 'E', 'x'),
+		"JPEG segment too short":  append(append([]byte{}, jpegData[:2]...), 0xFF, 0xE1, 0x00, 0x01, 0xFF, 0xDA),
+		"JPEG ends in fill bytes": append(append([]byte{}, jpegData[:2]...), 0xFF, 0xFF, 0xFF),
+		"truncated PNG":           pngData[:len(pngData)-5],
+		"truncated GIF":           gifData[:len(gifData)-5],
+		"GIF extension overruns":  append(append([]byte{}, gifData[:13+gifColorTableSize(gifData[10])]...), 0x21, 0xFE, 0x20, 'h', 'i'),
+	} {
+		if _, _, err := Sanitize(data); !errors.Is(err, ErrMalformed) {
+			t.Errorf("%s: got %v, want ErrMalformed", name, err)
+		}
+	}
+}
@@ -1,111 +1,287 @@
 package model
 
 import (
-	"errors"
 	"fmt"
 	"sort"
-	"strings"
+	"time"
 )
 
 type Chirp struct {
-	ID       int    `json:"id"`
-	Body     string `json:"body"`
-	AuthorID int    `json:"author_id"`
+	ID           int       `json:"id"`
+	Body         string    `json:"body"`
+	AuthorID     int       `json:"author_id"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+	LikeCount    int       `json:"like_count"`
+	RechirpCount int       `json:"rechirp_count"`
+	InReplyToID  int       `json:"in_reply_to_id,omitempty"`
+	// Flagged is set when moderation marked the chirp for review.
+	Flagged bool `json:"flagged,omitempty"`
+	// Hidden is set when a moderator hid the chirp. Hidden chirps are left
+	// out of every listing and only appear in threads without their body.
+	Hidden bool `json:"hidden,omitempty"`
+	// Tags are the hashtags in the body, normalized with NormalizeTag.
+	Tags []string `json:"tags,omitempty"`
+	// Mentions are the IDs of the users the body @mentions.
+	Mentions []int `json:"mentions,omitempty"`
+	// Attachments are the media attached to the chirp, in the order given.
+	Attachments []Attachment `json:"attachments,omitempty"`
+	// Preview describes the page the chirp links to, once it has been
+	// fetched.
+	Preview *LinkPreview `json:"preview,omitempty"`
+	// DeletedAt is set when the chirp is deleted. Deleted chirps are left out
+	// of everything but threads, where they appear without their content,
+	// and can be restored until they are purged.
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	// Purged is set on tombstones: purged chirps that are kept, without
+	// their content, because other chirps reply to them.
+	Purged bool `json:"purged,omitempty"`
 }
 
-func (db *DB) CreateChirp(body string, authorID int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
+// ChirpParams holds the fields supplied when creating a chirp.
+type ChirpParams struct {
+	Body     string
+	AuthorID int
+	// InReplyToID, if not zero, is the chirp this one replies to.
+	InReplyToID int
+	// Flagged marks the chirp for review by a moderator.
+	Flagged bool
+	// MediaIDs are uploads by the author to attach to the chirp.
+	MediaIDs []int
+	// CreatedAt backdates an imported chirp. Zero means now.
+	CreatedAt time.Time
+}
+
+// ChirpRevision is a body a chirp had before it was edited.
+type ChirpRevision struct {
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (db *DB) CreateChirp(params ChirpParams) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		c, err := dbStructure.createChirp(params, 0, chirpTime(params))
+		chirp = c
+		return err
+	})
 	if err != nil {
 		return Chirp{}, err
 	}
 
-	badWords := map[string]struct{}{
-		"kerfuffle": {},
-		"sharbert":  {},
-		"fornax":    {},
+	return chirp, nil
+}
+
+// chirpTime returns the creation time for a new chirp.
+func chirpTime(params ChirpParams) time.Time {
+	if params.CreatedAt.IsZero() {
+		return time.Now().UTC()
 	}
-	body = cleanBody(body, badWords)
+	return params.CreatedAt.UTC()
+}
 
-	id := len(dbStructure.Chirps) + 1
-	chirp := Chirp{
-		ID:       id,
-		Body:     body,
-		AuthorID: authorID,
+// createChirp implements CreateChirp. pendingID is the pending chirp being
+// published, if any, whose media the new chirp may carry.
+func (dbStructure *dbStructure) createChirp(params ChirpParams, pendingID int, now time.Time) (Chirp, error) {
+	if params.InReplyToID != 0 {
+		if _, ok := dbStructure.liveChirp(params.InReplyToID); !ok {
+			return Chirp{}, fmt.Errorf("Chirp ID %d not found", params.InReplyToID)
+		}
 	}
-	dbStructure.Chirps[id] = chirp
 
-	err = db.writeDB(dbStructure)
+	attachments, err := dbStructure.attachments(params.AuthorID, params.MediaIDs, pendingID)
 	if err != nil {
 		return Chirp{}, err
 	}
 
+	id := dbStructure.nextID(chirpSequence)
+	tags, mentions := extractEntities(params.Body, dbStructure.resolveMention)
+	chirp := Chirp{
+		ID:          id,
+		Body:        params.Body,
+		AuthorID:    params.AuthorID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		InReplyToID: params.InReplyToID,
+		Flagged:     params.Flagged,
+		Tags:        tags,
+		Mentions:    mentions,
+		Attachments: attachments,
+	}
+	for _, attachment := range attachments {
+		media := dbStructure.Media[attachment.ID]
+		media.ChirpID = id
+		media.PendingID = 0
+		setKey(dbStructure, dbStructure.Media, attachment.ID, media)
+	}
+	dbStructure.putChirp(chirp)
 	return chirp, nil
 }
 
+// DeleteChirp deletes a chirp, keeping it so its author can restore it
+// until PurgeDeletedChirps removes it for good.
 func (db *DB) DeleteChirp(id int) error {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return err
-	}
+	now := time.Now().UTC()
+	return db.Update(func(dbStructure *dbStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok || chirp.DeletedAt != nil {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		chirp.DeletedAt = &now
+		dbStructure.putChirp(chirp)
+		return nil
+	})
+}
+
+// UpdateChirp replaces the body of a chirp, keeping the previous body in the
+// chirp's revision history. flagged replaces the chirp's moderation flag, as
+// it was set for the old body.
+func (db *DB) UpdateChirp(id int, body string, flagged bool) (Chirp, error) {
+	now := time.Now().UTC()
 
-	if _, ok := dbStructure.Chirps[id]; ok {
-		delete(dbStructure.Chirps, id)
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.liveChirp(id)
+		if !ok {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		revision := ChirpRevision{
+			Body:      c.Body,
+			CreatedAt: c.UpdatedAt,
+		}
+		setKey(dbStructure, dbStructure.ChirpRevisions, id, append(dbStructure.ChirpRevisions[id], revision))
+
+		if LinkURL(body) != LinkURL(c.Body) {
+			c.Preview = nil
+		}
+		c.Body = body
+		c.Flagged = flagged
+		c.Tags, c.Mentions = extractEntities(body, dbStructure.resolveMention)
+		c.UpdatedAt = now
+		dbStructure.putChirp(c)
+		chirp = c
 		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
 	}
 
-	return fmt.Errorf("Chirp ID %d not found", id)
+	return chirp, nil
+}
+
+// GetChirpHistory returns the previous bodies of a chirp, oldest first.
+func (db *DB) GetChirpHistory(id int) ([]ChirpRevision, error) {
+	revisions := []ChirpRevision{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.liveChirp(id); !ok {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		revisions = append(revisions, dbStructure.ChirpRevisions[id]...)
+		return nil
+	})
+	return revisions, err
 }
 
 func (db *DB) GetChirp(id int) (Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return Chirp{}, err
-	}
+	chirp := Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.liveChirp(id)
+		if !ok {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		chirp = c
+		return nil
+	})
+	return chirp, err
+}
 
-	if chirp, ok := dbStructure.Chirps[id]; ok {
-		return chirp, nil
+// liveChirp returns the chirp with the given ID unless it doesn't exist, is
+// a tombstone or was hidden by a moderator.
+func (dbStructure *dbStructure) liveChirp(id int) (Chirp, bool) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok || chirp.DeletedAt != nil || chirp.Hidden {
+		return Chirp{}, false
 	}
+	return chirp, true
+}
 
-	return Chirp{}, fmt.Errorf("Chirp ID %d not found", id)
+// ChirpQuery selects a page of chirps.
+type ChirpQuery struct {
+	AuthorID *int
+	// Order is "asc" or "desc" by chirp ID.
+	Order string
+	// AfterID continues from a previous page: only chirps that come after
+	// this ID in the requested order are returned. Zero starts at the
+	// beginning.
+	AfterID int
+	// Since and Until bound the creation time to [Since, Until). Zero
+	// values leave that side unbounded.
+	Since time.Time
+	Until time.Time
+	// Limit caps the number of chirps returned. Zero means no limit.
+	Limit int
 }
 
-func (db *DB) GetChirps(authorID *int, order string) ([]Chirp, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return nil, err
+func (q ChirpQuery) matches(chirp Chirp) bool {
+	if chirp.DeletedAt != nil || chirp.Hidden {
+		return false
 	}
-
-	chirps := make([]Chirp, 0, len(dbStructure.Chirps))
-	for _, chirp := range dbStructure.Chirps {
-		if authorID != nil && chirp.AuthorID != *authorID {
-			continue
-		}
-		chirps = append(chirps, chirp)
+	if q.AuthorID != nil && chirp.AuthorID != *q.AuthorID {
+		return false
+	}
+	if !q.Since.IsZero() && chirp.CreatedAt.Before(q.Since) {
+		return false
 	}
+	if !q.Until.IsZero() && !chirp.CreatedAt.Before(q.Until) {
+		return false
+	}
+	return true
+}
 
-	lessFunc := func(i, j int) bool { return chirps[i].ID < chirps[j].ID }
-	if order == "desc" {
-		lessFunc = func(i, j int) bool { return chirps[i].ID > chirps[j].ID }
+func (db *DB) GetChirps(q ChirpQuery) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		chirps = dbStructure.queryChirps(q, nil)
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	sort.Slice(chirps, lessFunc)
 
 	return chirps, nil
 }
 
-func ValidateChirp(body string) error {
-	if len(body) > 140 {
-		return errors.New("Chirp is too long")
-	}
-	return nil
+// queryChirps walks the chirps in the order q asks for, starting after
+// q.AfterID, and collects those matching q and, if set, match.
+func (dbStructure *dbStructure) queryChirps(q ChirpQuery, match func(Chirp) bool) []Chirp {
+	return dbStructure.queryChirpIDs(dbStructure.index.ids, q, match)
 }
 
-func cleanBody(body string, badWords map[string]struct{}) string {
-	words := strings.Split(body, " ")
-	for i, word := range words {
-		if _, ok := badWords[strings.ToLower(word)]; ok {
-			words[i] = "****"
+// queryChirpIDs is queryChirps restricted to the chirps in ids, which must be
+// sorted in ascending order.
+func (dbStructure *dbStructure) queryChirpIDs(ids []int, q ChirpQuery, match func(Chirp) bool) []Chirp {
+	chirps := []Chirp{}
+	next := func(i int) int { return i + 1 }
+	i := 0
+	if q.AfterID > 0 {
+		i = sort.SearchInts(ids, q.AfterID+1)
+	}
+	if q.Order == "desc" {
+		next = func(i int) int { return i - 1 }
+		i = len(ids) - 1
+		if q.AfterID > 0 {
+			i = sort.SearchInts(ids, q.AfterID) - 1
+		}
+	}
+
+	for ; i >= 0 && i < len(ids); i = next(i) {
+		if q.Limit > 0 && len(chirps) == q.Limit {
+			break
+		}
+		chirp := dbStructure.Chirps[ids[i]]
+		if q.matches(chirp) && (match == nil || match(chirp)) {
+			chirps = append(chirps, chirp)
 		}
 	}
-	cleanedBody := strings.Join(words, " ")
-	return cleanedBody
+	return chirps
 }
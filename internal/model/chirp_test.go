@@ -0,0 +1,98 @@
+package model
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// chirpIDs returns the IDs of chirps, in order.
+func chirpIDs(chirps []Chirp) []int {
+	ids := make([]int, len(chirps))
+	for i, chirp := range chirps {
+		ids[i] = chirp.ID
+	}
+	return ids
+}
+
+func sameIDs(got []int, want []int) bool {
+	if len(got) != len(want) {
+		return false
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestStoreGetChirpsPages(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+		ids := []int{}
+		for i := 0; i < 6; i++ {
+			author := alice.ID
+			if i%2 == 1 {
+				author = bob.ID
+			}
+			chirp, err := store.CreateChirp(ChirpParams{Body: fmt.Sprintf("chirp %d", i), AuthorID: author})
+			if err != nil {
+				t.Fatal(err)
+			}
+			ids = append(ids, chirp.ID)
+		}
+
+		tests := []struct {
+			name string
+			q    ChirpQuery
+			want []int
+		}{
+			{"all", ChirpQuery{}, ids},
+			{"first page", ChirpQuery{Limit: 2}, ids[:2]},
+			{"next page", ChirpQuery{AfterID: ids[1], Limit: 2}, ids[2:4]},
+			{"last page", ChirpQuery{AfterID: ids[3], Limit: 4}, ids[4:]},
+			{"past the end", ChirpQuery{AfterID: ids[5]}, []int{}},
+			{"newest first", ChirpQuery{Order: "desc", Limit: 2}, []int{ids[5], ids[4]}},
+			{"newest first, next page", ChirpQuery{Order: "desc", AfterID: ids[4], Limit: 2}, []int{ids[3], ids[2]}},
+			{"by author", ChirpQuery{AuthorID: &bob.ID}, []int{ids[1], ids[3], ids[5]}},
+			{"by author, next page", ChirpQuery{AuthorID: &bob.ID, AfterID: ids[1], Limit: 1}, []int{ids[3]}},
+			{"since the future", ChirpQuery{Since: time.Now().Add(time.Hour)}, []int{}},
+			{"until the past", ChirpQuery{Until: time.Now().Add(-time.Hour)}, []int{}},
+		}
+		for _, tt := range tests {
+			chirps, err := store.GetChirps(tt.q)
+			if err != nil {
+				t.Fatalf("%s: %s", tt.name, err)
+			}
+			if got := chirpIDs(chirps); !sameIDs(got, tt.want) {
+				t.Errorf("%s: got chirps %v, want %v", tt.name, got, tt.want)
+			}
+		}
+	})
+}
+
+func TestStoreGetChirpsTimeRange(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		chirps := []Chirp{}
+		for i := 0; i < 3; i++ {
+			chirp, err := store.CreateChirp(ChirpParams{Body: fmt.Sprintf("chirp %d", i), AuthorID: alice.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			chirps = append(chirps, chirp)
+			time.Sleep(2 * time.Millisecond)
+		}
+
+		// Since is inclusive and Until exclusive.
+		got, err := store.GetChirps(ChirpQuery{Since: chirps[1].CreatedAt, Until: chirps[2].CreatedAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ids := chirpIDs(got); !sameIDs(ids, []int{chirps[1].ID}) {
+			t.Errorf("got chirps %v, want [%d]", ids, chirps[1].ID)
+		}
+	})
+}
@@ -3,43 +3,324 @@ package model
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
 	"sync"
+	"time"
 )
 
+// SyncPolicy controls when changes made through Update are written to disk.
+type SyncPolicy int
+
+const (
+	// SyncAlways writes the file before every Update returns.
+	SyncAlways SyncPolicy = iota
+	// SyncInterval writes pending changes every DBConfig.SyncInterval.
+	SyncInterval
+	// SyncOnClose writes pending changes only when the database is closed.
+	SyncOnClose
+)
+
+func ParseSyncPolicy(s string) (SyncPolicy, error) {
+	switch s {
+	case "always":
+		return SyncAlways, nil
+	case "interval":
+		return SyncInterval, nil
+	case "shutdown":
+		return SyncOnClose, nil
+	}
+	return SyncAlways, fmt.Errorf("unknown sync policy %q", s)
+}
+
+type DBConfig struct {
+	SyncPolicy   SyncPolicy
+	SyncInterval time.Duration
+}
+
+// DB is a Store backed by a JSON file. The decoded file is kept in memory and
+// all reads are served from it; writes are persisted according to the
+// configured SyncPolicy.
 type DB struct {
 	path string
+	cfg  DBConfig
 	mu   *sync.RWMutex
+	data dbStructure
+
+	// flushMu orders file writes so an older snapshot never lands on disk
+	// after a newer one. It is always acquired before mu.
+	flushMu *sync.Mutex
+	dirty   bool
+	done    chan struct{}
+	wg      sync.WaitGroup
 }
 
 type dbStructure struct {
-	Chirps         map[int]Chirp     `json:"chirps"`
-	Users          map[int]User      `json:"users"`
-	UsersEmailToID map[string]int    `json:"users_email_to_id"`
-	RevokedTokens  map[string]string `json:"revoked_tokens"`
+	SchemaVersion   int                          `json:"schema_version"`
+	Chirps          map[int]Chirp                `json:"chirps"`
+	ChirpRevisions  map[int][]ChirpRevision      `json:"chirp_revisions"`
+	Users           map[int]User                 `json:"users"`
+	UsersEmailToID  map[string]int               `json:"users_email_to_id"`
+	UsersHandleToID map[string]int               `json:"users_handle_to_id"` // keyed by lowercased handle
+	Follows         map[int]map[int]time.Time    `json:"follows"`
+	Likes           map[int]map[int]time.Time    `json:"likes"`
+	Rechirps        map[int]map[int]time.Time    `json:"rechirps"`
+	Reports         map[int][]Report             `json:"reports"`
+	AuditLog        []AuditEntry                 `json:"audit_log"`
+	Media           map[int]Media                `json:"media"`
+	PendingChirps   map[int]PendingChirp         `json:"pending_chirps"`
+	Sessions        map[int]Session              `json:"sessions"`
+	RefreshTokens   map[string]RefreshToken      `json:"refresh_tokens"` // keyed by token hash
+	OAuthClients    map[string]OAuthClient       `json:"oauth_clients"`
+	AuthCodes       map[string]AuthorizationCode `json:"authorization_codes"` // keyed by code hash
+	Identities      map[string]ExternalIdentity  `json:"external_identities"` // keyed by identityKey
+	Sequences       map[string]int               `json:"sequences"`
+
+	index chirpIndex
+	// undo holds the steps that reverse the changes made so far by the
+	// running Update, in the order they were made. It is nil outside
+	// Update.
+	undo []func()
 }
 
-func NewDB(path string) (*DB, error) {
+// Sequence names used with nextID.
+const (
+	chirpSequence   = "chirps"
+	userSequence    = "users"
+	reportSequence  = "reports"
+	auditSequence   = "audit"
+	mediaSequence   = "media"
+	pendingSequence = "pending"
+	sessionSequence = "sessions"
+)
+
+// nextID advances and returns the named sequence. IDs handed out by a sequence
+// are never reused, even after the entity holding them is deleted.
+func (dbStructure *dbStructure) nextID(sequence string) int {
+	setKey(dbStructure, dbStructure.Sequences, sequence, dbStructure.Sequences[sequence]+1)
+	return dbStructure.Sequences[sequence]
+}
+
+// seedSequences makes sure each sequence starts after the highest ID
+// currently in use, for databases written before sequences existed.
+func seedSequences(dbStructure *dbStructure) {
+	if dbStructure.Sequences == nil {
+		dbStructure.Sequences = map[string]int{}
+	}
+	for id := range dbStructure.Chirps {
+		if id > dbStructure.Sequences[chirpSequence] {
+			dbStructure.Sequences[chirpSequence] = id
+		}
+	}
+	for id := range dbStructure.Users {
+		if id > dbStructure.Sequences[userSequence] {
+			dbStructure.Sequences[userSequence] = id
+		}
+	}
+}
+
+func NewDB(path string, cfg DBConfig) (*DB, error) {
+	if cfg.SyncPolicy == SyncInterval && cfg.SyncInterval <= 0 {
+		return nil, errors.New("sync interval must be positive")
+	}
+
 	db := &DB{
-		path: path,
-		mu:   &sync.RWMutex{},
+		path:    path,
+		cfg:     cfg,
+		mu:      &sync.RWMutex{},
+		flushMu: &sync.Mutex{},
+		done:    make(chan struct{}),
+	}
+	if err := db.ensureDB(); err != nil {
+		return nil, err
+	}
+
+	report, err := MigrateDB(path, false)
+	if err != nil {
+		return nil, err
 	}
-	err := db.ensureDB()
-	return db, err
+	if len(report.Applied) > 0 {
+		log.Println(report)
+	}
+
+	data, err := db.readFile()
+	if err != nil {
+		return nil, err
+	}
+	db.data = data
+	db.data.buildIndex()
+
+	if cfg.SyncPolicy == SyncInterval {
+		db.wg.Add(1)
+		go db.flushLoop()
+	}
+	return db, nil
+}
+
+// Close stops the background flusher, if any, and writes pending changes.
+func (db *DB) Close() error {
+	select {
+	case <-db.done:
+		return nil
+	default:
+		close(db.done)
+	}
+	db.wg.Wait()
+	return db.Flush()
 }
 
 func ResetDB(path string) error {
 	return os.Remove(path)
 }
 
+// View runs fn with read access to the in-memory database. fn must not modify
+// the structure or retain references to its maps after returning.
+func (db *DB) View(fn func(*dbStructure) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	return fn(&db.data)
+}
+
+// Update runs fn as a single read-modify-write transaction, holding the write
+// lock throughout. If fn or the write fails, fn's changes are undone, so an
+// error from Update means nothing changed. fn must make its changes through
+// setKey, deleteKey and the other helpers that record how to undo them.
+// With SyncAlways the file has been written by the time Update returns;
+// otherwise the change is persisted by the next Flush.
+func (db *DB) Update(fn func(*dbStructure) error) error {
+	if db.cfg.SyncPolicy == SyncAlways {
+		db.flushMu.Lock()
+		defer db.flushMu.Unlock()
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	db.data.undo = []func(){}
+	err := fn(&db.data)
+	if err == nil && db.cfg.SyncPolicy == SyncAlways {
+		err = db.writeFile(db.data)
+	}
+	undo := db.data.undo
+	db.data.undo = nil
+	if err != nil {
+		for i := len(undo) - 1; i >= 0; i-- {
+			undo[i]()
+		}
+		return err
+	}
+	if db.cfg.SyncPolicy != SyncAlways {
+		db.dirty = true
+	}
+	return nil
+}
+
+// onUndo registers fn to reverse a change made during an Update if the
+// update fails. Outside an Update it does nothing.
+func (dbStructure *dbStructure) onUndo(fn func()) {
+	if dbStructure.undo != nil {
+		dbStructure.undo = append(dbStructure.undo, fn)
+	}
+}
+
+// saveKey records the current entry for key in m, so it is put back if the
+// update fails.
+func saveKey[K comparable, V any](dbStructure *dbStructure, m map[K]V, key K) {
+	old, ok := m[key]
+	dbStructure.onUndo(func() {
+		if ok {
+			m[key] = old
+		} else {
+			delete(m, key)
+		}
+	})
+}
+
+// setKey sets m[key] to value, undoably.
+func setKey[K comparable, V any](dbStructure *dbStructure, m map[K]V, key K, value V) {
+	saveKey(dbStructure, m, key)
+	m[key] = value
+}
+
+// deleteKey deletes key from m, undoably.
+func deleteKey[K comparable, V any](dbStructure *dbStructure, m map[K]V, key K) {
+	if _, ok := m[key]; !ok {
+		return
+	}
+	saveKey(dbStructure, m, key)
+	delete(m, key)
+}
+
+// Flush writes any changes not yet persisted to disk.
+func (db *DB) Flush() error {
+	db.flushMu.Lock()
+	defer db.flushMu.Unlock()
+
+	db.mu.Lock()
+	if !db.dirty {
+		db.mu.Unlock()
+		return nil
+	}
+	data, err := json.Marshal(db.data)
+	if err == nil {
+		db.dirty = false
+	}
+	db.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	if err := writeFileAtomic(db.path, data); err != nil {
+		db.mu.Lock()
+		db.dirty = true
+		db.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+func (db *DB) flushLoop() {
+	defer db.wg.Done()
+
+	ticker := time.NewTicker(db.cfg.SyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := db.Flush(); err != nil {
+				log.Printf("Error flushing database: %s\n", err)
+			}
+		case <-db.done:
+			return
+		}
+	}
+}
+
 func (db *DB) createDB() error {
 	dbStructure := dbStructure{
-		Chirps:         map[int]Chirp{},
-		Users:          map[int]User{},
-		UsersEmailToID: map[string]int{},
-		RevokedTokens:  map[string]string{},
+		SchemaVersion:   latestSchemaVersion(),
+		Chirps:          map[int]Chirp{},
+		ChirpRevisions:  map[int][]ChirpRevision{},
+		Users:           map[int]User{},
+		UsersEmailToID:  map[string]int{},
+		UsersHandleToID: map[string]int{},
+		Follows:         map[int]map[int]time.Time{},
+		Likes:           map[int]map[int]time.Time{},
+		Rechirps:        map[int]map[int]time.Time{},
+		Reports:         map[int][]Report{},
+		AuditLog:        []AuditEntry{},
+		Media:           map[int]Media{},
+		PendingChirps:   map[int]PendingChirp{},
+		Sessions:        map[int]Session{},
+		RefreshTokens:   map[string]RefreshToken{},
+		OAuthClients:    map[string]OAuthClient{},
+		AuthCodes:       map[string]AuthorizationCode{},
+		Identities:      map[string]ExternalIdentity{},
+		Sequences:       map[string]int{},
 	}
-	return db.writeDB(dbStructure)
+	return db.writeFile(dbStructure)
 }
 
 func (db *DB) ensureDB() error {
@@ -50,10 +331,7 @@ func (db *DB) ensureDB() error {
 	return err
 }
 
-func (db *DB) loadDB() (dbStructure, error) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
+func (db *DB) readFile() (dbStructure, error) {
 	dbStructure := dbStructure{}
 	data, err := os.ReadFile(db.path)
 	if errors.Is(err, os.ErrNotExist) {
@@ -65,14 +343,47 @@ func (db *DB) loadDB() (dbStructure, error) {
 	return dbStructure, err
 }
 
-func (db *DB) writeDB(dbStructure dbStructure) error {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
+func (db *DB) writeFile(dbStructure dbStructure) error {
 	data, err := json.Marshal(dbStructure)
 	if err != nil {
 		return err
 	}
 
-	return os.WriteFile(db.path, data, 0600)
+	return writeFileAtomic(db.path, data)
+}
+
+// writeFileAtomic replaces path with data so that readers, and the file left
+// behind after a crash, only ever see the old or the new contents. The data is
+// written to a temporary file in the same directory, fsynced and renamed over
+// path, then the directory is fsynced so the rename itself is durable.
+func writeFileAtomic(path string, data []byte) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpPath := tmp.Name()
+	defer os.Remove(tmpPath)
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
 }
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// The benchmarks compare the in-memory DB under each SyncPolicy with
+// "reread", which decodes the file for every call the way the store did
+// before it kept its data in memory.
+
+var benchSizes = []int{100, 1000, 10000}
+
+var benchPolicies = []struct {
+	name string
+	cfg  DBConfig
+}{
+	{"always", DBConfig{SyncPolicy: SyncAlways}},
+	{"interval", DBConfig{SyncPolicy: SyncInterval, SyncInterval: time.Second}},
+	{"shutdown", DBConfig{SyncPolicy: SyncOnClose}},
+}
+
+// seedBenchDB writes a database holding n chirps by one user and returns
+// its path and the user's ID.
+func seedBenchDB(b *testing.B, n int) (string, int) {
+	b.Helper()
+	path := filepath.Join(b.TempDir(), "database.json")
+	db, err := NewDB(path, DBConfig{SyncPolicy: SyncOnClose})
+	if err != nil {
+		b.Fatal(err)
+	}
+	user, err := db.CreateUser("alice@example.com", "password")
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		_, err := db.CreateChirp(ChirpParams{Body: fmt.Sprintf("chirp number %d #bench", i), AuthorID: user.ID})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	if err := db.Close(); err != nil {
+		b.Fatal(err)
+	}
+	return path, user.ID
+}
+
+// rereadDB returns a DB for the reread baseline, which only uses its file
+// helpers and so skips loading the file.
+func rereadDB(path string) *DB {
+	return &DB{path: path}
+}
+
+// runBench runs fn against a database of each size, opened under each
+// policy, and against the reread baseline.
+func runBench(b *testing.B, baseline func(b *testing.B, db *DB, userID int, n int), fn func(b *testing.B, db *DB, userID int, n int)) {
+	for _, n := range benchSizes {
+		b.Run(fmt.Sprintf("n=%d/reread", n), func(b *testing.B) {
+			path, userID := seedBenchDB(b, n)
+			b.ResetTimer()
+			baseline(b, rereadDB(path), userID, n)
+		})
+		for _, policy := range benchPolicies {
+			b.Run(fmt.Sprintf("n=%d/%s", n, policy.name), func(b *testing.B) {
+				path, userID := seedBenchDB(b, n)
+				db, err := NewDB(path, policy.cfg)
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer db.Close()
+				b.ResetTimer()
+				fn(b, db, userID, n)
+			})
+		}
+	}
+}
+
+func BenchmarkGetChirps(b *testing.B) {
+	runBench(b,
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				data, err := db.readFile()
+				if err != nil {
+					b.Fatal(err)
+				}
+				data.buildIndex()
+				if got := len(data.index.ids); got != n {
+					b.Fatalf("got %d chirps, want %d", got, n)
+				}
+			}
+		},
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				chirps, err := db.GetChirps(ChirpQuery{})
+				if err != nil {
+					b.Fatal(err)
+				}
+				if len(chirps) != n {
+					b.Fatalf("got %d chirps, want %d", len(chirps), n)
+				}
+			}
+		},
+	)
+}
+
+func BenchmarkGetChirp(b *testing.B) {
+	runBench(b,
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				data, err := db.readFile()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if _, ok := data.Chirps[i%n+1]; !ok {
+					b.Fatalf("chirp %d not found", i%n+1)
+				}
+			}
+		},
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.GetChirp(i%n + 1); err != nil {
+					b.Fatal(err)
+				}
+			}
+		},
+	)
+}
+
+func BenchmarkCreateChirp(b *testing.B) {
+	runBench(b,
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				data, err := db.readFile()
+				if err != nil {
+					b.Fatal(err)
+				}
+				data.buildIndex()
+				params := ChirpParams{Body: "another chirp", AuthorID: userID}
+				if _, err := data.createChirp(params, 0, time.Now().UTC()); err != nil {
+					b.Fatal(err)
+				}
+				if err := db.writeFile(data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		},
+		func(b *testing.B, db *DB, userID int, n int) {
+			for i := 0; i < b.N; i++ {
+				if _, err := db.CreateChirp(ChirpParams{Body: "another chirp", AuthorID: userID}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		},
+	)
+}
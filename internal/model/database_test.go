@@ -0,0 +1,262 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestDB(t *testing.T, cfg DBConfig) (*DB, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db, path
+}
+
+// TestUpdateConcurrentWrites fires many writes at once and checks that none
+// of them is lost, in memory or on disk. Run it with -race.
+func TestUpdateConcurrentWrites(t *testing.T) {
+	const writes = 300
+	db, path := newTestDB(t, DBConfig{})
+	user, err := db.CreateUser("alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	errs := make(chan error, writes)
+	ids := make(chan int, writes)
+	for i := 0; i < writes; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			chirp, err := db.CreateChirp(ChirpParams{Body: fmt.Sprintf("chirp %d", i), AuthorID: user.ID})
+			if err != nil {
+				errs <- err
+				return
+			}
+			ids <- chirp.ID
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+	close(ids)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	seen := map[int]bool{}
+	for id := range ids {
+		if seen[id] {
+			t.Fatalf("chirp ID %d handed out twice", id)
+		}
+		seen[id] = true
+	}
+	if len(seen) != writes {
+		t.Fatalf("got %d chirp IDs, want %d", len(seen), writes)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	reopened, err := NewDB(path, DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	chirps, err := reopened.GetChirps(ChirpQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != writes {
+		t.Errorf("the file holds %d chirps, want %d", len(chirps), writes)
+	}
+}
+
+// TestUpdateRollsBackFailedWrite checks that a change Update couldn't write
+// is gone afterwards, rather than being saved by the next write.
+func TestUpdateRollsBackFailedWrite(t *testing.T) {
+	db, path := newTestDB(t, DBConfig{})
+	alice, err := db.CreateUser("alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Writes go through a temporary file named after the database. With a
+	// name this long the temporary file's name is too long for the file
+	// system, so every write fails while the database can still be read.
+	longPath := filepath.Join(filepath.Dir(path), strings.Repeat("d", 245))
+	if err := os.Rename(path, longPath); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDB(longPath, DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := db.CreateUser("bob@example.com", "password"); err == nil {
+		t.Fatal("CreateUser succeeded although the file can't be written")
+	}
+	if _, err := db.AuthenticateUser("bob@example.com", "password"); err == nil {
+		t.Error("the user whose creation failed exists")
+	}
+	if _, err := db.GetUser(alice.ID + 1); err == nil {
+		t.Error("the ID of the user whose creation failed is taken")
+	}
+	if _, err := db.AuthenticateUser("alice@example.com", "password"); err != nil {
+		t.Errorf("earlier changes were rolled back too: %s", err)
+	}
+	// Nothing is left to write.
+	if err := db.Close(); err != nil {
+		t.Errorf("Close: %s", err)
+	}
+}
+
+// fileHas reports whether the database file at path mentions s.
+func fileHas(t *testing.T, path string, s string) bool {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return strings.Contains(string(data), s)
+}
+
+func TestSyncInterval(t *testing.T) {
+	db, path := newTestDB(t, DBConfig{SyncPolicy: SyncInterval, SyncInterval: 10 * time.Millisecond})
+	defer db.Close()
+	if _, err := db.CreateUser("alice@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !fileHas(t, path, "alice@example.com") {
+		if time.Now().After(deadline) {
+			t.Fatal("the change wasn't flushed")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestSyncOnClose(t *testing.T) {
+	db, path := newTestDB(t, DBConfig{SyncPolicy: SyncOnClose})
+	if _, err := db.CreateUser("alice@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+	if fileHas(t, path, "alice@example.com") {
+		t.Fatal("the change was written before Close")
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !fileHas(t, path, "alice@example.com") {
+		t.Fatal("Close didn't write the change")
+	}
+	if err := db.Close(); err != nil {
+		t.Errorf("second Close: %s", err)
+	}
+}
+
+// TestFlushFailureKeepsChanges checks that changes a Flush couldn't write
+// are written by the next one.
+func TestFlushFailureKeepsChanges(t *testing.T) {
+	db, path := newTestDB(t, DBConfig{SyncPolicy: SyncOnClose})
+	if _, err := db.CreateUser("alice@example.com", "password"); err != nil {
+		t.Fatal(err)
+	}
+
+	// As in TestUpdateRollsBackFailedWrite, a name this long can't be
+	// written to.
+	db.path = filepath.Join(filepath.Dir(path), strings.Repeat("d", 245))
+	if err := db.Flush(); err == nil {
+		t.Fatal("Flush succeeded although the file can't be written")
+	}
+	if !db.dirty {
+		t.Fatal("the failed Flush left the database marked clean")
+	}
+
+	db.path = path
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !fileHas(t, path, "alice@example.com") {
+		t.Fatal("the change was lost after the failed Flush")
+	}
+}
+
+// TestUpdateUndoesFailedFn checks that the changes made by an update that
+// then fails are undone, in memory and in the index, under a policy where
+// the file can't be used to roll back.
+func TestUpdateUndoesFailedFn(t *testing.T) {
+	db, path := newTestDB(t, DBConfig{SyncPolicy: SyncOnClose})
+	alice, err := db.CreateUser("alice@example.com", "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	kept, err := db.CreateChirp(ChirpParams{Body: "kept #go", AuthorID: alice.ID})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errFailed := errors.New("failed")
+	err = db.Update(func(dbStructure *dbStructure) error {
+		bob := User{ID: dbStructure.nextID(userSequence), Email: "bob@example.com"}
+		setKey(dbStructure, dbStructure.Users, bob.ID, bob)
+		setKey(dbStructure, dbStructure.UsersEmailToID, bob.Email, bob.ID)
+		dbStructure.putChirp(Chirp{ID: dbStructure.nextID(chirpSequence), Body: "gone #go", AuthorID: alice.ID, Tags: []string{"go"}})
+		edited := dbStructure.Chirps[kept.ID]
+		edited.Body = "edited"
+		dbStructure.putChirp(edited)
+		setKey(dbStructure, dbStructure.Follows, alice.ID, map[int]time.Time{bob.ID: time.Now()})
+		dbStructure.appendAudit(AuditEntry{Action: "approve"})
+		return errFailed
+	})
+	if !errors.Is(err, errFailed) {
+		t.Fatalf("Update: got %v, want the error fn returned", err)
+	}
+
+	if _, err := db.AuthenticateUser("bob@example.com", "password"); err == nil {
+		t.Error("the user added by the failed update exists")
+	}
+	if user, err := db.CreateUser("carol@example.com", "password"); err != nil || user.ID != alice.ID+1 {
+		t.Errorf("CreateUser = %+v, %v; want the ID the failed update took back", user, err)
+	}
+	chirps, err := db.GetChirps(ChirpQuery{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chirps) != 1 || chirps[0].Body != "kept #go" {
+		t.Errorf("GetChirps = %+v, want only the chirp as it was", chirps)
+	}
+	if tagged, _ := db.GetChirpsByTag("go", ChirpQuery{}); len(tagged) != 1 {
+		t.Errorf("the tag index lists %d chirps, want 1", len(tagged))
+	}
+	if found, _ := db.SearchChirps(SearchQuery{Text: "edited"}); len(found) != 0 {
+		t.Errorf("the search index finds the undone edit: %+v", found)
+	}
+	if following, _ := db.GetFollowing(alice.ID); len(following) != 0 {
+		t.Errorf("the follow added by the failed update exists: %+v", following)
+	}
+	if entries, _ := db.GetAuditLog(); len(entries) != 0 {
+		t.Errorf("the audit entry added by the failed update exists: %+v", entries)
+	}
+
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if fileHas(t, path, "bob@example.com") || fileHas(t, path, "edited") {
+		t.Error("Close wrote changes of the failed update")
+	}
+}
@@ -0,0 +1,146 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/cases"
+)
+
+var (
+	hashtagRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_&#])#([\p{L}\p{N}_]+)`)
+	mentionRegexp = regexp.MustCompile(`(?:^|[^\p{L}\p{N}_@])@([A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}|[A-Za-z0-9_]+)`)
+	handleRegexp  = regexp.MustCompile(`^[A-Za-z0-9_]{1,30}$`)
+)
+
+// TagCount is the number of recent chirps using a hashtag.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int    `json:"count"`
+}
+
+// NormalizeTag returns the form hashtags are stored and looked up in: without
+// the leading # and case-folded.
+func NormalizeTag(tag string) string {
+	return cases.Fold().String(strings.TrimPrefix(tag, "#"))
+}
+
+// ValidateHandle checks a handle can be used in @mentions.
+func ValidateHandle(handle string) bool {
+	return handleRegexp.MatchString(handle)
+}
+
+// extractEntities returns the distinct hashtags in body and the IDs of the
+// users it mentions, in order of first appearance. A mention is either
+// @handle or @email; resolve maps the text after the @ to a user ID, and
+// mentions it can't resolve are dropped.
+func extractEntities(body string, resolve func(mention string) (int, bool)) ([]string, []int) {
+	var tags []string
+	seenTags := map[string]bool{}
+	for _, match := range hashtagRegexp.FindAllStringSubmatch(body, -1) {
+		tag := NormalizeTag(match[1])
+		// Like other microblogs, a tag needs at least one letter: "#1" is
+		// not a tag.
+		if seenTags[tag] || strings.IndexFunc(tag, unicode.IsLetter) < 0 {
+			continue
+		}
+		seenTags[tag] = true
+		tags = append(tags, tag)
+	}
+
+	var mentions []int
+	seenMentions := map[int]bool{}
+	for _, match := range mentionRegexp.FindAllStringSubmatch(body, -1) {
+		id, ok := resolve(match[1])
+		if !ok || seenMentions[id] {
+			continue
+		}
+		seenMentions[id] = true
+		mentions = append(mentions, id)
+	}
+
+	return tags, mentions
+}
+
+// resolveMention looks up the user named by an @mention.
+func (dbStructure *dbStructure) resolveMention(mention string) (int, bool) {
+	if strings.Contains(mention, "@") {
+		id, ok := dbStructure.UsersEmailToID[mention]
+		return id, ok
+	}
+	id, ok := dbStructure.UsersHandleToID[strings.ToLower(mention)]
+	return id, ok
+}
+
+// GetChirpsByTag returns the chirps using a hashtag.
+func (db *DB) GetChirpsByTag(tag string, q ChirpQuery) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		chirps = dbStructure.queryChirpIDs(dbStructure.index.tags[NormalizeTag(tag)], q, nil)
+		return nil
+	})
+	return chirps, err
+}
+
+// GetMentions returns the chirps mentioning a user.
+func (db *DB) GetMentions(userID int, q ChirpQuery) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", userID)
+		}
+		chirps = dbStructure.queryChirpIDs(dbStructure.index.mentions[userID], q, nil)
+		return nil
+	})
+	return chirps, err
+}
+
+// GetTrendingTags counts the hashtags used by chirps created at or after
+// since and returns the limit most used, most used first.
+func (db *DB) GetTrendingTags(since time.Time, limit int) ([]TagCount, error) {
+	counts := map[string]int{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		ids := dbStructure.index.ids
+		// IDs are handed out in creation order, so walk back from the
+		// newest chirp until the window is left behind.
+		for i := len(ids) - 1; i >= 0; i-- {
+			chirp := dbStructure.Chirps[ids[i]]
+			if chirp.CreatedAt.Before(since) {
+				break
+			}
+			if chirp.DeletedAt != nil || chirp.Hidden {
+				continue
+			}
+			for _, tag := range chirp.Tags {
+				counts[tag]++
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return topTags(counts, limit), nil
+}
+
+func topTags(counts map[string]int, limit int) []TagCount {
+	tags := make([]TagCount, 0, len(counts))
+	for tag, count := range counts {
+		tags = append(tags, TagCount{Tag: tag, Count: count})
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if tags[i].Count != tags[j].Count {
+			return tags[i].Count > tags[j].Count
+		}
+		return tags[i].Tag < tags[j].Tag
+	})
+	if limit > 0 && len(tags) > limit {
+		tags = tags[:limit]
+	}
+	return tags
+}
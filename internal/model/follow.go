@@ -0,0 +1,82 @@
+package model
+
+import (
+	"fmt"
+	"sort"
+	"time"
+)
+
+func (db *DB) FollowUser(followerID int, followeeID int) error {
+	now := time.Now().UTC()
+	return db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Users[followeeID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", followeeID)
+		}
+		if _, ok := dbStructure.Follows[followerID][followeeID]; ok {
+			return nil
+		}
+		if dbStructure.Follows[followerID] == nil {
+			setKey(dbStructure, dbStructure.Follows, followerID, map[int]time.Time{})
+		}
+		setKey(dbStructure, dbStructure.Follows[followerID], followeeID, now)
+		return nil
+	})
+}
+
+func (db *DB) UnfollowUser(followerID int, followeeID int) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		deleteKey(dbStructure, dbStructure.Follows[followerID], followeeID)
+		if len(dbStructure.Follows[followerID]) == 0 {
+			deleteKey(dbStructure, dbStructure.Follows, followerID)
+		}
+		return nil
+	})
+}
+
+// GetFollowers returns the users following userID, ordered by ID.
+func (db *DB) GetFollowers(userID int) ([]User, error) {
+	users := []User{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", userID)
+		}
+		for followerID, followees := range dbStructure.Follows {
+			if _, ok := followees[userID]; ok {
+				users = append(users, dbStructure.Users[followerID])
+			}
+		}
+		return nil
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, err
+}
+
+// GetFollowing returns the users userID follows, ordered by ID.
+func (db *DB) GetFollowing(userID int) ([]User, error) {
+	users := []User{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", userID)
+		}
+		for followeeID := range dbStructure.Follows[userID] {
+			users = append(users, dbStructure.Users[followeeID])
+		}
+		return nil
+	})
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	return users, err
+}
+
+// GetTimeline returns the chirps written by the users userID follows.
+func (db *DB) GetTimeline(userID int, q ChirpQuery) ([]Chirp, error) {
+	chirps := []Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		following := dbStructure.Follows[userID]
+		chirps = dbStructure.queryChirps(q, func(chirp Chirp) bool {
+			_, ok := following[chirp.AuthorID]
+			return ok
+		})
+		return nil
+	})
+	return chirps, err
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrNoVerifiedEmail is returned when an external account that isn't linked
+// to a user yet comes without a verified email address to link or create
+// one by.
+var ErrNoVerifiedEmail = errors.New("no verified email address")
+
+// ExternalIdentity links an account at an external OpenID Connect provider,
+// identified by the provider's issuer and the account's subject, to the
+// user who signs in with it.
+type ExternalIdentity struct {
+	Issuer    string    `json:"issuer"`
+	Subject   string    `json:"subject"`
+	UserID    int       `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// identityKey is the key of an external identity in dbStructure.
+func identityKey(issuer string, subject string) string {
+	return issuer + " " + subject
+}
+
+// SignInExternalUser returns the user linked to the account subject at
+// issuer. An account that isn't linked yet is linked to the user with the
+// address email, who is created, without a password, if there is none.
+// email must have been verified by the provider; pass "" if it wasn't, and
+// unlinked accounts get ErrNoVerifiedEmail.
+//
+// Chirpy doesn't verify the addresses users sign up with, so a user with a
+// password may have been set up by someone else ahead of the address's
+// owner. Linking clears the password and ends the user's sessions and
+// pending authorization codes, leaving the owner the only way in.
+func (db *DB) SignInExternalUser(issuer string, subject string, email string) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		key := identityKey(issuer, subject)
+		if identity, ok := dbStructure.Identities[key]; ok {
+			u, ok := dbStructure.Users[identity.UserID]
+			if !ok {
+				return fmt.Errorf("unable to fetch user with ID %d", identity.UserID)
+			}
+			user = u
+			return nil
+		}
+		if email == "" {
+			return ErrNoVerifiedEmail
+		}
+
+		if id, ok := dbStructure.UsersEmailToID[email]; ok {
+			user = dbStructure.Users[id]
+			if user.Password != "" {
+				user.Password = ""
+				setKey(dbStructure, dbStructure.Users, id, user)
+				dbStructure.signOutUser(id)
+			}
+		} else {
+			user = User{ID: dbStructure.nextID(userSequence), Email: email}
+			setKey(dbStructure, dbStructure.Users, user.ID, user)
+			setKey(dbStructure, dbStructure.UsersEmailToID, email, user.ID)
+		}
+		setKey(dbStructure, dbStructure.Identities, key, ExternalIdentity{
+			Issuer:    issuer,
+			Subject:   subject,
+			UserID:    user.ID,
+			CreatedAt: time.Now().UTC(),
+		})
+		return nil
+	})
+	if err != nil {
+		return User{}, err
+	}
+	return user, nil
+}
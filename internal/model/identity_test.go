@@ -0,0 +1,105 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreSignInExternalUserProvisions(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		if _, err := store.SignInExternalUser("https://idp.example", "sub-1", ""); !errors.Is(err, ErrNoVerifiedEmail) {
+			t.Fatalf("sign-in without a verified email: got %v, want ErrNoVerifiedEmail", err)
+		}
+
+		user, err := store.SignInExternalUser("https://idp.example", "sub-1", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Email != "alice@example.com" || user.Password != "" {
+			t.Errorf("provisioned user = %+v, want alice@example.com without a password", user)
+		}
+
+		// Once linked the account signs in as the same user, whatever its
+		// email address is by now.
+		for _, email := range []string{"alice@example.org", ""} {
+			again, err := store.SignInExternalUser("https://idp.example", "sub-1", email)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again.ID != user.ID {
+				t.Errorf("sign-in with email %q returned user %d, want %d", email, again.ID, user.ID)
+			}
+		}
+
+		// The same subject at another provider is another account.
+		other, err := store.SignInExternalUser("https://other.example", "sub-1", "bob@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if other.ID == user.ID {
+			t.Error("the subject at another provider signed in as alice")
+		}
+	})
+}
+
+func TestStoreSignInExternalUserLinksPasswordless(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		user, err := store.SignInExternalUser("https://idp.example", "sub-1", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		linked, err := store.SignInExternalUser("https://other.example", "sub-2", "alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if linked.ID != user.ID {
+			t.Errorf("second provider linked to user %d, want %d", linked.ID, user.ID)
+		}
+	})
+}
+
+// TestStoreSignInExternalUserPreHijack checks that someone who signed up
+// with another person's address loses the account when its owner signs in
+// with their provider.
+func TestStoreSignInExternalUserPreHijack(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		squatted := mustCreateUser(t, store, "victim@example.com")
+		now := time.Now()
+		session, err := store.CreateSession(squatted.ID, "attacker", "attacker-hash", now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user, err := store.SignInExternalUser("https://idp.example", "victim", "victim@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != squatted.ID {
+			t.Fatalf("linked to user %d, want %d", user.ID, squatted.ID)
+		}
+		if user.Password != "" {
+			t.Error("the returned user still has a password")
+		}
+		if _, err := store.AuthenticateUser("victim@example.com", "password"); err == nil {
+			t.Error("the password set before linking still works")
+		}
+		if _, err := store.GetSession(session.ID); err == nil {
+			t.Error("the session started before linking survived")
+		}
+		if _, err := store.RefreshSession("attacker-hash", "next-hash", now, now.Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refreshing the session started before linking: got %v, want ErrInvalidRefreshToken", err)
+		}
+
+		// Passwords set after linking belong to the owner and are kept.
+		if _, err := store.UpdateUser(user.ID, "", "new password", "", nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.SignInExternalUser("https://idp.example", "victim", "victim@example.com"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.AuthenticateUser("victim@example.com", "new password"); err != nil {
+			t.Errorf("the password set after linking was cleared: %s", err)
+		}
+	})
+}
@@ -0,0 +1,145 @@
+package model
+
+import "sort"
+
+// chirpIndex holds lookup structures derived from dbStructure.Chirps. It is
+// rebuilt when the database is loaded, kept current by putChirp and
+// removeChirp, and never persisted.
+type chirpIndex struct {
+	// ids lists every chirp ID in ascending order.
+	ids []int
+	// search is the full-text index over chirp bodies.
+	search searchIndex
+	// replies maps a chirp ID to the IDs of its direct replies, ascending.
+	replies map[int][]int
+	// tags maps a hashtag to the IDs of the chirps using it, ascending.
+	tags map[string][]int
+	// mentions maps a user ID to the IDs of the chirps mentioning them,
+	// ascending.
+	mentions map[int][]int
+}
+
+func (dbStructure *dbStructure) buildIndex() {
+	dbStructure.index = chirpIndex{
+		ids:      make([]int, 0, len(dbStructure.Chirps)),
+		search:   newSearchIndex(),
+		replies:  map[int][]int{},
+		tags:     map[string][]int{},
+		mentions: map[int][]int{},
+	}
+	for id, chirp := range dbStructure.Chirps {
+		dbStructure.index.ids = append(dbStructure.index.ids, id)
+		dbStructure.index.search.add(id, chirp.Body)
+		if chirp.InReplyToID != 0 {
+			dbStructure.index.replies[chirp.InReplyToID] = append(dbStructure.index.replies[chirp.InReplyToID], id)
+		}
+		for _, tag := range chirp.Tags {
+			dbStructure.index.tags[tag] = append(dbStructure.index.tags[tag], id)
+		}
+		for _, userID := range chirp.Mentions {
+			dbStructure.index.mentions[userID] = append(dbStructure.index.mentions[userID], id)
+		}
+	}
+	sort.Ints(dbStructure.index.ids)
+	for _, replies := range dbStructure.index.replies {
+		sort.Ints(replies)
+	}
+	for _, ids := range dbStructure.index.tags {
+		sort.Ints(ids)
+	}
+	for _, ids := range dbStructure.index.mentions {
+		sort.Ints(ids)
+	}
+}
+
+// putChirp stores a new or changed chirp and updates the index, undoably.
+func (dbStructure *dbStructure) putChirp(chirp Chirp) {
+	old, ok := dbStructure.Chirps[chirp.ID]
+	dbStructure.onUndo(func() {
+		if ok {
+			dbStructure.putChirp(old)
+		} else {
+			dbStructure.removeChirp(chirp.ID)
+		}
+	})
+	if !ok {
+		dbStructure.index.ids = insertID(dbStructure.index.ids, chirp.ID)
+		if chirp.InReplyToID != 0 {
+			replies := dbStructure.index.replies
+			replies[chirp.InReplyToID] = insertID(replies[chirp.InReplyToID], chirp.ID)
+		}
+	}
+	if !ok || old.Body != chirp.Body {
+		if ok {
+			dbStructure.index.search.remove(old.ID, old.Body)
+		}
+		dbStructure.index.search.add(chirp.ID, chirp.Body)
+	}
+	if ok {
+		dbStructure.unindexEntities(old)
+	}
+	dbStructure.indexEntities(chirp)
+	dbStructure.Chirps[chirp.ID] = chirp
+}
+
+// removeChirp deletes a chirp and its index entries, undoably.
+func (dbStructure *dbStructure) removeChirp(id int) {
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok {
+		return
+	}
+	dbStructure.onUndo(func() { dbStructure.putChirp(chirp) })
+	dbStructure.index.search.remove(id, chirp.Body)
+	dbStructure.unindexEntities(chirp)
+	dbStructure.index.ids = removeID(dbStructure.index.ids, id)
+	if chirp.InReplyToID != 0 {
+		replies := dbStructure.index.replies
+		replies[chirp.InReplyToID] = removeID(replies[chirp.InReplyToID], id)
+		if len(replies[chirp.InReplyToID]) == 0 {
+			delete(replies, chirp.InReplyToID)
+		}
+	}
+	delete(dbStructure.Chirps, id)
+}
+
+func (dbStructure *dbStructure) indexEntities(chirp Chirp) {
+	for _, tag := range chirp.Tags {
+		dbStructure.index.tags[tag] = insertID(dbStructure.index.tags[tag], chirp.ID)
+	}
+	for _, userID := range chirp.Mentions {
+		dbStructure.index.mentions[userID] = insertID(dbStructure.index.mentions[userID], chirp.ID)
+	}
+}
+
+func (dbStructure *dbStructure) unindexEntities(chirp Chirp) {
+	for _, tag := range chirp.Tags {
+		dbStructure.index.tags[tag] = removeID(dbStructure.index.tags[tag], chirp.ID)
+		if len(dbStructure.index.tags[tag]) == 0 {
+			delete(dbStructure.index.tags, tag)
+		}
+	}
+	for _, userID := range chirp.Mentions {
+		dbStructure.index.mentions[userID] = removeID(dbStructure.index.mentions[userID], chirp.ID)
+		if len(dbStructure.index.mentions[userID]) == 0 {
+			delete(dbStructure.index.mentions, userID)
+		}
+	}
+}
+
+// insertID adds id to the sorted slice ids.
+func insertID(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	ids = append(ids, 0)
+	copy(ids[i+1:], ids[i:])
+	ids[i] = id
+	return ids
+}
+
+// removeID deletes id from the sorted slice ids.
+func removeID(ids []int, id int) []int {
+	i := sort.SearchInts(ids, id)
+	if i == len(ids) || ids[i] != id {
+		return ids
+	}
+	return append(ids[:i], ids[i+1:]...)
+}
@@ -0,0 +1,54 @@
+package model
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/rivo/uniseg"
+)
+
+// URLLength is what a link counts as towards a chirp's length, however long
+// the URL is.
+const URLLength = 23
+
+var urlRegexp = regexp.MustCompile(`https?://[^\s]+`)
+
+// ChirpLimits are the maximum chirp lengths for each account tier.
+type ChirpLimits struct {
+	Default   int
+	ChirpyRed int
+}
+
+// DefaultChirpLimits are used unless the deployment configures its own.
+var DefaultChirpLimits = ChirpLimits{
+	Default:   140,
+	ChirpyRed: 280,
+}
+
+// MaxLength returns the longest chirp user may post.
+func (l ChirpLimits) MaxLength(user User) int {
+	if user.IsChirpyRed {
+		return l.ChirpyRed
+	}
+	return l.Default
+}
+
+// ChirpLength returns the length of body as users see it: the number of
+// grapheme clusters, so an emoji made of several code points counts once,
+// with each URL counting as URLLength.
+func ChirpLength(body string) int {
+	length := 0
+	last := 0
+	for _, match := range urlRegexp.FindAllStringIndex(body, -1) {
+		length += uniseg.GraphemeClusterCount(body[last:match[0]]) + URLLength
+		last = match[1]
+	}
+	return length + uniseg.GraphemeClusterCount(body[last:])
+}
+
+func ValidateChirp(body string, maxLength int) error {
+	if length := ChirpLength(body); length > maxLength {
+		return fmt.Errorf("Chirp is too long (%d characters, the limit is %d)", length, maxLength)
+	}
+	return nil
+}
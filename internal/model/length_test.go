@@ -0,0 +1,54 @@
+package model
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestChirpLength(t *testing.T) {
+	tests := []struct {
+		body string
+		want int
+	}{
+		{"", 0},
+		{"hello", 5},
+		{"h\u00e9llo", 5},
+		{"he\u0301llo", 5},
+		{"こんにちは", 5},
+		{"👍", 1},
+		{"👍🏽", 1},
+		{"👨‍👩‍👧‍👦", 1},
+		{"🇳🇿", 1},
+		{"see https://example.com/a/very/long/path/that/goes/on?and=on", 4 + URLLength},
+		{"http://a.io", URLLength},
+		{"two http://a.io and https://b.io", 4 + URLLength + 5 + URLLength},
+		{"not a link: example.com", 23},
+	}
+	for _, tt := range tests {
+		if got := ChirpLength(tt.body); got != tt.want {
+			t.Errorf("ChirpLength(%q) = %d, want %d", tt.body, got, tt.want)
+		}
+	}
+}
+
+func TestValidateChirp(t *testing.T) {
+	if err := ValidateChirp(strings.Repeat("👍", 140), 140); err != nil {
+		t.Errorf("140 emoji: %s", err)
+	}
+	if err := ValidateChirp(strings.Repeat("a", 141), 140); err == nil {
+		t.Error("141 characters were accepted")
+	}
+	if err := ValidateChirp(strings.Repeat("a", 117)+"https://example.com/"+strings.Repeat("x", 200), 140); err != nil {
+		t.Errorf("a long URL counted in full: %s", err)
+	}
+}
+
+func TestChirpLimitsMaxLength(t *testing.T) {
+	limits := ChirpLimits{Default: 140, ChirpyRed: 280}
+	if got := limits.MaxLength(User{}); got != 140 {
+		t.Errorf("MaxLength = %d, want 140", got)
+	}
+	if got := limits.MaxLength(User{IsChirpyRed: true}); got != 280 {
+		t.Errorf("MaxLength for Chirpy Red = %d, want 280", got)
+	}
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// MaxAttachments is the most media a chirp can carry.
+const MaxAttachments = 4
+
+// ErrInvalidMedia is returned when a chirp names media that doesn't exist,
+// belongs to someone else or is already attached to another chirp.
+var ErrInvalidMedia = errors.New("invalid media")
+
+// Media is an uploaded file. Its content lives in a blob store under Key.
+type Media struct {
+	ID          int       `json:"id"`
+	OwnerID     int       `json:"owner_id"`
+	Key         string    `json:"key"`
+	ContentType string    `json:"content_type"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	// ChirpID is the chirp the media is attached to, or zero.
+	ChirpID int `json:"chirp_id,omitempty"`
+	// PendingID is the pending chirp that will carry the media once it is
+	// published, or zero.
+	PendingID int `json:"pending_id,omitempty"`
+}
+
+// Attachment is media as it appears on a chirp.
+type Attachment struct {
+	ID          int    `json:"id"`
+	Key         string `json:"key"`
+	ContentType string `json:"content_type"`
+}
+
+// CreateMedia records an upload. ID, CreatedAt, ChirpID and PendingID are
+// set by the store.
+func (db *DB) CreateMedia(media Media) (Media, error) {
+	media.CreatedAt = time.Now().UTC()
+	media.ChirpID = 0
+	media.PendingID = 0
+	err := db.Update(func(dbStructure *dbStructure) error {
+		media.ID = dbStructure.nextID(mediaSequence)
+		setKey(dbStructure, dbStructure.Media, media.ID, media)
+		return nil
+	})
+	return media, err
+}
+
+// PruneMedia deletes the records of media that was uploaded before cutoff
+// and isn't attached to a chirp, either because it never was or because its
+// chirp was deleted. Media waiting on a pending chirp is kept. It returns
+// the pruned media so their blobs can be removed.
+func (db *DB) PruneMedia(cutoff time.Time) ([]Media, error) {
+	pruned := []Media{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		for id, media := range dbStructure.Media {
+			if media.ChirpID == 0 && media.PendingID == 0 && media.CreatedAt.Before(cutoff) {
+				pruned = append(pruned, media)
+				deleteKey(dbStructure, dbStructure.Media, id)
+			}
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+// attachments checks that a new chirp by ownerID can carry the media in ids
+// and returns them as attachments. Media reserved by a pending chirp can only
+// be used when publishing that chirp, as pendingID.
+func (dbStructure *dbStructure) attachments(ownerID int, ids []int, pendingID int) ([]Attachment, error) {
+	if len(ids) > MaxAttachments {
+		return nil, fmt.Errorf("%w: a chirp can have at most %d attachments", ErrInvalidMedia, MaxAttachments)
+	}
+	var attachments []Attachment
+	seen := map[int]bool{}
+	for _, id := range ids {
+		media, ok := dbStructure.Media[id]
+		if !ok || media.OwnerID != ownerID || media.ChirpID != 0 || media.PendingID != pendingID || seen[id] {
+			return nil, fmt.Errorf("%w: media ID %d can't be attached", ErrInvalidMedia, id)
+		}
+		seen[id] = true
+		attachments = append(attachments, Attachment{
+			ID:          media.ID,
+			Key:         media.Key,
+			ContentType: media.ContentType,
+		})
+	}
+	return attachments, nil
+}
+
+// reserveMedia sets aside the media in ids, which attachments has checked,
+// for a pending chirp. A pendingID of zero releases them.
+func (dbStructure *dbStructure) reserveMedia(ids []int, pendingID int) {
+	for _, id := range ids {
+		if media, ok := dbStructure.Media[id]; ok {
+			media.PendingID = pendingID
+			setKey(dbStructure, dbStructure.Media, id, media)
+		}
+	}
+}
+
+// detachMedia releases the media of a deleted chirp for PruneMedia.
+func (dbStructure *dbStructure) detachMedia(chirp Chirp) {
+	for _, attachment := range chirp.Attachments {
+		if media, ok := dbStructure.Media[attachment.ID]; ok {
+			media.ChirpID = 0
+			setKey(dbStructure, dbStructure.Media, attachment.ID, media)
+		}
+	}
+}
@@ -0,0 +1,249 @@
+package model
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"time"
+)
+
+type migration struct {
+	name string
+	up   func(*dbStructure) error
+}
+
+// migrations upgrade a database.json file written by an older version of
+// Chirpy. Applying migrations[i] moves the schema from version i to i+1.
+// Append new migrations; never edit or reorder existing ones.
+var migrations = []migration{
+	{
+		name: "seed ID sequences",
+		up: func(dbStructure *dbStructure) error {
+			seedSequences(dbStructure)
+			return nil
+		},
+	},
+	{
+		name: "add chirp timestamps and revisions",
+		up: func(dbStructure *dbStructure) error {
+			// Creation times were never recorded, so existing chirps are
+			// stamped with the time of the migration.
+			now := time.Now().UTC()
+			for id, chirp := range dbStructure.Chirps {
+				chirp.CreatedAt = now
+				chirp.UpdatedAt = now
+				dbStructure.Chirps[id] = chirp
+			}
+			dbStructure.ChirpRevisions = map[int][]ChirpRevision{}
+			return nil
+		},
+	},
+	{
+		name: "add follows",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Follows = map[int]map[int]time.Time{}
+			return nil
+		},
+	},
+	{
+		name: "add likes and rechirps",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Likes = map[int]map[int]time.Time{}
+			dbStructure.Rechirps = map[int]map[int]time.Time{}
+			return nil
+		},
+	},
+	{
+		name: "add handles, hashtags and mentions",
+		up: func(dbStructure *dbStructure) error {
+			// No user has a handle yet, so only @email mentions in
+			// existing chirps resolve.
+			dbStructure.UsersHandleToID = map[string]int{}
+			for id, chirp := range dbStructure.Chirps {
+				chirp.Tags, chirp.Mentions = extractEntities(chirp.Body, dbStructure.resolveMention)
+				dbStructure.Chirps[id] = chirp
+			}
+			return nil
+		},
+	},
+	{
+		name: "add reports and audit log",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Reports = map[int][]Report{}
+			dbStructure.AuditLog = []AuditEntry{}
+			return nil
+		},
+	},
+	{
+		name: "add media",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Media = map[int]Media{}
+			return nil
+		},
+	},
+	{
+		name: "add scheduled chirps and drafts",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.PendingChirps = map[int]PendingChirp{}
+			return nil
+		},
+	},
+	{
+		// Deleted chirps used to be purged straight away.
+		name: "add soft delete",
+		up: func(dbStructure *dbStructure) error {
+			for id, chirp := range dbStructure.Chirps {
+				if chirp.DeletedAt != nil {
+					chirp.Purged = true
+					dbStructure.Chirps[id] = chirp
+				}
+			}
+			return nil
+		},
+	},
+	{
+		// Refresh tokens used to be JWTs checked against a list of revoked
+		// tokens. Users signed in with one have to sign in again.
+		name: "add sessions",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Sessions = map[int]Session{}
+			dbStructure.RefreshTokens = map[string]RefreshToken{}
+			return nil
+		},
+	},
+	{
+		name: "add oauth clients",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.OAuthClients = map[string]OAuthClient{}
+			dbStructure.AuthCodes = map[string]AuthorizationCode{}
+			return nil
+		},
+	},
+	{
+		name: "add external identities",
+		up: func(dbStructure *dbStructure) error {
+			dbStructure.Identities = map[string]ExternalIdentity{}
+			return nil
+		},
+	},
+	{
+		// Changing a user's email used to leave the old address mapped to
+		// them, and could take over another user's address. Each address
+		// now maps to a user who has it, the one it mapped to if possible.
+		name: "rebuild email index",
+		up: func(dbStructure *dbStructure) error {
+			emailToID := map[string]int{}
+			for email, id := range dbStructure.UsersEmailToID {
+				if user, ok := dbStructure.Users[id]; ok && user.Email == email {
+					emailToID[email] = id
+				}
+			}
+			ids := []int{}
+			for id := range dbStructure.Users {
+				ids = append(ids, id)
+			}
+			sort.Ints(ids)
+			for _, id := range ids {
+				email := dbStructure.Users[id].Email
+				if _, ok := emailToID[email]; !ok {
+					emailToID[email] = id
+				}
+			}
+			dbStructure.UsersEmailToID = emailToID
+			return nil
+		},
+	},
+	{
+		// Review deletes have always purged the chirp.
+		name: "record purges in the audit log",
+		up: func(dbStructure *dbStructure) error {
+			for i, entry := range dbStructure.AuditLog {
+				if entry.Action == ReviewDelete {
+					dbStructure.AuditLog[i].Purged = true
+				}
+			}
+			return nil
+		},
+	},
+}
+
+func latestSchemaVersion() int {
+	return len(migrations)
+}
+
+// MigrationReport describes the outcome of migrating a database.
+type MigrationReport struct {
+	Path        string
+	FromVersion int
+	ToVersion   int
+	Applied     []string
+	Backup      string
+	DryRun      bool
+}
+
+func (r MigrationReport) String() string {
+	if r.FromVersion == r.ToVersion {
+		return fmt.Sprintf("%s: schema version %d is up to date", r.Path, r.FromVersion)
+	}
+
+	verb := "applied"
+	if r.DryRun {
+		verb = "would apply"
+	}
+	s := fmt.Sprintf("%s: schema version %d -> %d", r.Path, r.FromVersion, r.ToVersion)
+	for _, name := range r.Applied {
+		s += fmt.Sprintf("\n  %s: %s", verb, name)
+	}
+	if r.Backup != "" {
+		s += fmt.Sprintf("\n  backup: %s", r.Backup)
+	}
+	return s
+}
+
+// MigrateDB brings the JSON database at path up to the latest schema version.
+// The file as it was before migrating is copied to a backup next to it. With
+// dryRun the migrations are run in memory only and nothing is written.
+func MigrateDB(path string, dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{Path: path, DryRun: dryRun}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return report, err
+	}
+	dbStructure := dbStructure{}
+	if err := json.Unmarshal(data, &dbStructure); err != nil {
+		return report, err
+	}
+
+	report.FromVersion = dbStructure.SchemaVersion
+	report.ToVersion = dbStructure.SchemaVersion
+	if dbStructure.SchemaVersion > latestSchemaVersion() {
+		return report, fmt.Errorf("schema version %d is newer than the latest supported version %d", dbStructure.SchemaVersion, latestSchemaVersion())
+	}
+
+	for _, m := range migrations[dbStructure.SchemaVersion:] {
+		if err := m.up(&dbStructure); err != nil {
+			return report, fmt.Errorf("migration %q: %w", m.name, err)
+		}
+		dbStructure.SchemaVersion++
+		report.ToVersion = dbStructure.SchemaVersion
+		report.Applied = append(report.Applied, m.name)
+	}
+
+	if dryRun || len(report.Applied) == 0 {
+		return report, nil
+	}
+
+	backup := fmt.Sprintf("%s.v%d.bak", path, report.FromVersion)
+	if err := writeFileAtomic(backup, data); err != nil {
+		return report, err
+	}
+	report.Backup = backup
+
+	migrated, err := json.Marshal(dbStructure)
+	if err != nil {
+		return report, err
+	}
+	return report, writeFileAtomic(path, migrated)
+}
@@ -0,0 +1,79 @@
+package model
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// TestMigrateRebuildsEmailIndex migrates a database in which the email index
+// was left wrong by email changes made before they were checked.
+func TestMigrateRebuildsEmailIndex(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "database.json")
+	db, err := NewDB(path, DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Alice (1) changed address from alice@old.example, and Mallory (2)
+	// took the address of Bob (3), who could no longer log in.
+	structure := dbStructure{}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(data, &structure); err != nil {
+		t.Fatal(err)
+	}
+	for i, m := range migrations {
+		if m.name == "rebuild email index" {
+			structure.SchemaVersion = i
+		}
+	}
+	structure.Users = map[int]User{
+		1: {ID: 1, Email: "alice@example.com"},
+		2: {ID: 2, Email: "bob@example.com"},
+		3: {ID: 3, Email: "bob@example.com"},
+	}
+	structure.UsersEmailToID = map[string]int{
+		"alice@old.example": 1,
+		"alice@example.com": 1,
+		"bob@example.com":   2,
+	}
+	data, err = json.Marshal(structure)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateDB(path, false); err != nil {
+		t.Fatal(err)
+	}
+	db, err = NewDB(path, DBConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	err = db.View(func(migrated *dbStructure) error {
+		want := map[string]int{"alice@example.com": 1, "bob@example.com": 2}
+		if len(migrated.UsersEmailToID) != len(want) {
+			t.Errorf("UsersEmailToID = %v, want %v", migrated.UsersEmailToID, want)
+		}
+		for email, id := range want {
+			if migrated.UsersEmailToID[email] != id {
+				t.Errorf("UsersEmailToID = %v, want %v", migrated.UsersEmailToID, want)
+				break
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
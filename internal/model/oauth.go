@@ -0,0 +1,189 @@
+package model
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// Scopes an OAuth client can be granted.
+const (
+	ScopeOpenID      = "openid"
+	ScopeProfile     = "profile"
+	ScopeEmail       = "email"
+	ScopeChirpsRead  = "chirps:read"
+	ScopeChirpsWrite = "chirps:write"
+)
+
+// SupportedScopes are the scopes clients can request, in the order they are
+// listed on the consent page.
+var SupportedScopes = []string{ScopeOpenID, ScopeProfile, ScopeEmail, ScopeChirpsRead, ScopeChirpsWrite}
+
+// ErrInvalidAuthorizationCode is returned for authorization codes that are
+// unknown, expired or already used.
+var ErrInvalidAuthorizationCode = errors.New("invalid authorization code")
+
+// NewOAuthClientID returns a random client ID.
+func NewOAuthClientID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// NewOAuthSecret returns a random client secret or authorization code and
+// the hash to store it under. They are made like refresh tokens.
+func NewOAuthSecret() (secret string, hash string, err error) {
+	return NewRefreshToken()
+}
+
+// HashOAuthSecret returns the hash a client secret or authorization code is
+// stored under.
+func HashOAuthSecret(secret string) string {
+	return HashRefreshToken(secret)
+}
+
+// OAuthClient is an application registered to sign users in with Chirpy.
+type OAuthClient struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	// SecretHash is the hash of the client secret. It is empty for public
+	// clients, such as single-page and native apps, which can't keep a
+	// secret and rely on PKCE alone.
+	SecretHash   string    `json:"secret_hash,omitempty"`
+	RedirectURIs []string  `json:"redirect_uris"`
+	Scopes       []string  `json:"scopes"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// AuthorizationCode is an authorization code as stored. Only a hash of the
+// code is kept, and it can be exchanged for tokens once.
+type AuthorizationCode struct {
+	Hash        string `json:"hash"`
+	ClientID    string `json:"client_id"`
+	UserID      int    `json:"user_id"`
+	RedirectURI string `json:"redirect_uri"`
+	// Scope is the space-separated list of scopes the user consented to.
+	Scope string `json:"scope"`
+	// CodeChallenge is the S256 PKCE challenge the code verifier must match.
+	CodeChallenge string    `json:"code_challenge"`
+	Nonce         string    `json:"nonce,omitempty"`
+	AuthTime      time.Time `json:"auth_time"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+// CreateOAuthClient registers client under client.ID, which the caller
+// chooses.
+func (db *DB) CreateOAuthClient(client OAuthClient) (OAuthClient, error) {
+	client.CreatedAt = time.Now().UTC()
+	err := db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.OAuthClients[client.ID]; ok {
+			return fmt.Errorf("OAuth client %s already exists", client.ID)
+		}
+		setKey(dbStructure, dbStructure.OAuthClients, client.ID, client)
+		return nil
+	})
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	return client, nil
+}
+
+func (db *DB) GetOAuthClient(id string) (OAuthClient, error) {
+	client := OAuthClient{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.OAuthClients[id]
+		if !ok {
+			return fmt.Errorf("OAuth client %s not found", id)
+		}
+		client = c
+		return nil
+	})
+	return client, err
+}
+
+// GetOAuthClients returns the registered clients, oldest first.
+func (db *DB) GetOAuthClients() ([]OAuthClient, error) {
+	clients := []OAuthClient{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		for _, client := range dbStructure.OAuthClients {
+			clients = append(clients, client)
+		}
+		return nil
+	})
+	sort.Slice(clients, func(i, j int) bool {
+		if !clients[i].CreatedAt.Equal(clients[j].CreatedAt) {
+			return clients[i].CreatedAt.Before(clients[j].CreatedAt)
+		}
+		return clients[i].ID < clients[j].ID
+	})
+	return clients, err
+}
+
+// DeleteOAuthClient unregisters a client along with its unused
+// authorization codes. Access tokens already issued to it stay valid until
+// they expire.
+func (db *DB) DeleteOAuthClient(id string) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.OAuthClients[id]; !ok {
+			return fmt.Errorf("OAuth client %s not found", id)
+		}
+		deleteKey(dbStructure, dbStructure.OAuthClients, id)
+		for hash, code := range dbStructure.AuthCodes {
+			if code.ClientID == id {
+				deleteKey(dbStructure, dbStructure.AuthCodes, hash)
+			}
+		}
+		return nil
+	})
+}
+
+// CreateAuthorizationCode stores code. Codes that expired before now are
+// deleted on the way, since most codes are used within seconds and the rest
+// never are.
+func (db *DB) CreateAuthorizationCode(code AuthorizationCode, now time.Time) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.OAuthClients[code.ClientID]; !ok {
+			return fmt.Errorf("OAuth client %s not found", code.ClientID)
+		}
+		if _, ok := dbStructure.Users[code.UserID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", code.UserID)
+		}
+		for hash, c := range dbStructure.AuthCodes {
+			if !c.ExpiresAt.After(now) {
+				deleteKey(dbStructure, dbStructure.AuthCodes, hash)
+			}
+		}
+		code.AuthTime = code.AuthTime.UTC()
+		code.ExpiresAt = code.ExpiresAt.UTC()
+		setKey(dbStructure, dbStructure.AuthCodes, code.Hash, code)
+		return nil
+	})
+}
+
+// ConsumeAuthorizationCode deletes the authorization code with hash hash and
+// returns it, or ErrInvalidAuthorizationCode if it doesn't exist or expired
+// before now.
+func (db *DB) ConsumeAuthorizationCode(hash string, now time.Time) (AuthorizationCode, error) {
+	code := AuthorizationCode{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.AuthCodes[hash]
+		if !ok {
+			return ErrInvalidAuthorizationCode
+		}
+		deleteKey(dbStructure, dbStructure.AuthCodes, hash)
+		code = c
+		return nil
+	})
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+	if !code.ExpiresAt.After(now) {
+		return AuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	return code, nil
+}
@@ -0,0 +1,39 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LinkPreview describes the page a chirp links to.
+type LinkPreview struct {
+	URL         string `json:"url"`
+	Title       string `json:"title,omitempty"`
+	Description string `json:"description,omitempty"`
+	Image       string `json:"image,omitempty"`
+	SiteName    string `json:"site_name,omitempty"`
+}
+
+// LinkURL returns the first link in body, which is the one previewed, or ""
+// if there is none. Punctuation ending a sentence is not part of the link.
+func LinkURL(body string) string {
+	return strings.TrimRight(urlRegexp.FindString(body), `.,:;!?'")]`)
+}
+
+// SetChirpPreview stores the preview of a chirp's link. Previews are fetched
+// in the background, so the chirp may have been edited to link elsewhere, or
+// deleted, in the meantime; the preview is then dropped.
+func (db *DB) SetChirpPreview(id int, preview LinkPreview) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok || chirp.DeletedAt != nil {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		if LinkURL(chirp.Body) != preview.URL {
+			return nil
+		}
+		chirp.Preview = &preview
+		dbStructure.putChirp(chirp)
+		return nil
+	})
+}
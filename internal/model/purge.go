@@ -0,0 +1,107 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"time"
+)
+
+// GetDeletedChirp returns a chirp that was deleted but not yet purged.
+func (db *DB) GetDeletedChirp(id int) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.Chirps[id]
+		if !ok || c.DeletedAt == nil || c.Purged {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		chirp = c
+		return nil
+	})
+	return chirp, err
+}
+
+// RestoreChirp undoes DeleteChirp for a chirp that hasn't been purged.
+func (db *DB) RestoreChirp(id int) (Chirp, error) {
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.Chirps[id]
+		if !ok || c.DeletedAt == nil || c.Purged {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+		c.DeletedAt = nil
+		dbStructure.putChirp(c)
+		chirp = c
+		return nil
+	})
+	return chirp, err
+}
+
+// PurgeDeletedChirps permanently removes the chirps deleted before cutoff,
+// as purgeChirp does, and returns how many there were.
+func (db *DB) PurgeDeletedChirps(cutoff time.Time) (int, error) {
+	purged := 0
+	err := db.Update(func(dbStructure *dbStructure) error {
+		for _, id := range append([]int{}, dbStructure.index.ids...) {
+			chirp, ok := dbStructure.Chirps[id]
+			if !ok || chirp.DeletedAt == nil || chirp.Purged || !chirp.DeletedAt.Before(cutoff) {
+				continue
+			}
+			// Chirps purged before this one can't be taken back, so one
+			// that fails is skipped rather than failing the whole run.
+			if err := dbStructure.purgeChirp(id); err != nil {
+				log.Printf("Error purging chirp %d: %s\n", id, err)
+				continue
+			}
+			purged++
+		}
+		return nil
+	})
+	return purged, err
+}
+
+// purgeChirp permanently removes a chirp along with its likes, rechirps,
+// reports and history. A chirp that has replies is turned into a tombstone
+// instead, so the conversation stays connected. Unlike most lookups it finds
+// deleted and hidden chirps, so moderators can purge hidden ones directly.
+func (dbStructure *dbStructure) purgeChirp(id int) error {
+	now := time.Now().UTC()
+	chirp, ok := dbStructure.Chirps[id]
+	if !ok || chirp.Purged {
+		return fmt.Errorf("Chirp ID %d not found", id)
+	}
+	deleteKey(dbStructure, dbStructure.ChirpRevisions, id)
+	deleteKey(dbStructure, dbStructure.Likes, id)
+	deleteKey(dbStructure, dbStructure.Rechirps, id)
+	deleteKey(dbStructure, dbStructure.Reports, id)
+	dbStructure.detachMedia(chirp)
+
+	if len(dbStructure.index.replies[id]) > 0 {
+		chirp.Body = ""
+		chirp.Tags = nil
+		chirp.Mentions = nil
+		chirp.Attachments = nil
+		chirp.Preview = nil
+		chirp.Flagged = false
+		chirp.Hidden = false
+		chirp.LikeCount = 0
+		chirp.RechirpCount = 0
+		if chirp.DeletedAt == nil {
+			chirp.DeletedAt = &now
+		}
+		chirp.Purged = true
+		dbStructure.putChirp(chirp)
+		return nil
+	}
+
+	dbStructure.removeChirp(id)
+	// A tombstone is only kept while it has replies.
+	for parentID := chirp.InReplyToID; parentID != 0; {
+		parent := dbStructure.Chirps[parentID]
+		if !parent.Purged || len(dbStructure.index.replies[parentID]) > 0 {
+			break
+		}
+		dbStructure.removeChirp(parentID)
+		parentID = parent.InReplyToID
+	}
+	return nil
+}
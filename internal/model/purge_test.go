@@ -0,0 +1,159 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestStoreSoftDelete(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		chirp, err := store.CreateChirp(ChirpParams{Body: "oops", AuthorID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeleteChirp(chirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetChirp(chirp.ID); err == nil {
+			t.Error("GetChirp found a deleted chirp")
+		}
+		chirps, err := store.GetChirps(ChirpQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) != 0 {
+			t.Errorf("GetChirps lists a deleted chirp: %+v", chirps)
+		}
+		if err := store.DeleteChirp(chirp.ID); err == nil {
+			t.Error("deleting a chirp twice succeeded")
+		}
+
+		deleted, err := store.GetDeletedChirp(chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if deleted.DeletedAt == nil || deleted.Body != "oops" {
+			t.Errorf("GetDeletedChirp = %+v", deleted)
+		}
+
+		restored, err := store.RestoreChirp(chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if restored.DeletedAt != nil {
+			t.Error("the restored chirp still has DeletedAt")
+		}
+		if got, err := store.GetChirp(chirp.ID); err != nil || got.Body != "oops" {
+			t.Errorf("GetChirp after restoring = %+v, %v", got, err)
+		}
+		if _, err := store.RestoreChirp(chirp.ID); err == nil {
+			t.Error("restoring a chirp that isn't deleted succeeded")
+		}
+		if _, err := store.GetDeletedChirp(chirp.ID); err == nil {
+			t.Error("GetDeletedChirp found a restored chirp")
+		}
+	})
+}
+
+func TestStorePurgeDeletedChirps(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		create := func(body string) Chirp {
+			t.Helper()
+			chirp, err := store.CreateChirp(ChirpParams{Body: body, AuthorID: alice.ID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return chirp
+		}
+		kept := create("kept")
+		deleted := create("deleted")
+		if err := store.DeleteChirp(deleted.ID); err != nil {
+			t.Fatal(err)
+		}
+
+		// Chirps deleted after the cutoff are still in their restore window.
+		purged, err := store.PurgeDeletedChirps(time.Now().Add(-time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 0 {
+			t.Fatalf("purged %d chirps still in their restore window", purged)
+		}
+		if _, err := store.GetDeletedChirp(deleted.ID); err != nil {
+			t.Fatalf("the chirp in its restore window is gone: %s", err)
+		}
+
+		purged, err = store.PurgeDeletedChirps(time.Now().Add(time.Second))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if purged != 1 {
+			t.Fatalf("purged %d chirps, want 1", purged)
+		}
+		if _, err := store.GetDeletedChirp(deleted.ID); err == nil {
+			t.Error("GetDeletedChirp found a purged chirp")
+		}
+		if _, err := store.RestoreChirp(deleted.ID); err == nil {
+			t.Error("RestoreChirp brought back a purged chirp")
+		}
+		if _, err := store.GetChirp(kept.ID); err != nil {
+			t.Errorf("the chirp that wasn't deleted was purged: %s", err)
+		}
+
+		// Nothing is left to purge.
+		if purged, err := store.PurgeDeletedChirps(time.Now().Add(time.Second)); err != nil || purged != 0 {
+			t.Errorf("second purge: %d, %v", purged, err)
+		}
+	})
+}
+
+func TestStorePurgeKeepsTombstones(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		parent, err := store.CreateChirp(ChirpParams{Body: "parent", AuthorID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply, err := store.CreateChirp(ChirpParams{Body: "reply", AuthorID: alice.ID, InReplyToID: parent.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := store.DeleteChirp(parent.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.PurgeDeletedChirps(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+
+		// The purged parent stays in the thread as a tombstone, without its
+		// content, while it has a reply.
+		thread, err := store.GetThread(reply.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(thread.Ancestors) != 1 || thread.Ancestors[0].ID != parent.ID {
+			t.Fatalf("Ancestors = %+v, want the tombstone of %d", thread.Ancestors, parent.ID)
+		}
+		if thread.Ancestors[0].Body != "" {
+			t.Errorf("the tombstone kept its body %q", thread.Ancestors[0].Body)
+		}
+		if _, err := store.RestoreChirp(parent.ID); err == nil {
+			t.Error("RestoreChirp brought back a tombstone")
+		}
+
+		// Once the reply is purged too, the tombstone goes with it.
+		if err := store.DeleteChirp(reply.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.PurgeDeletedChirps(time.Now().Add(time.Second)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetThread(parent.ID); err == nil {
+			t.Error("the tombstone outlived its last reply")
+		}
+	})
+}
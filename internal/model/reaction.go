@@ -0,0 +1,94 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// reactionKind names the ways a user can react to a chirp. Each kind is
+// recorded at most once per user and chirp.
+type reactionKind int
+
+const (
+	reactionLike reactionKind = iota
+	reactionRechirp
+)
+
+func (db *DB) LikeChirp(chirpID int, userID int) (Chirp, error) {
+	return db.setReaction(reactionLike, chirpID, userID, true)
+}
+
+func (db *DB) UnlikeChirp(chirpID int, userID int) (Chirp, error) {
+	return db.setReaction(reactionLike, chirpID, userID, false)
+}
+
+func (db *DB) Rechirp(chirpID int, userID int) (Chirp, error) {
+	return db.setReaction(reactionRechirp, chirpID, userID, true)
+}
+
+func (db *DB) UndoRechirp(chirpID int, userID int) (Chirp, error) {
+	return db.setReaction(reactionRechirp, chirpID, userID, false)
+}
+
+// GetLikedChirps reports which of chirpIDs userID has liked.
+func (db *DB) GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error) {
+	liked := map[int]bool{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		for _, id := range chirpIDs {
+			if _, ok := dbStructure.Likes[id][userID]; ok {
+				liked[id] = true
+			}
+		}
+		return nil
+	})
+	return liked, err
+}
+
+// setReaction adds or removes a reaction and keeps the chirp's count of that
+// reaction in step. Setting a reaction to its current state is a no-op.
+func (db *DB) setReaction(kind reactionKind, chirpID int, userID int, on bool) (Chirp, error) {
+	now := time.Now().UTC()
+
+	chirp := Chirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		c, ok := dbStructure.liveChirp(chirpID)
+		if !ok {
+			return fmt.Errorf("Chirp ID %d not found", chirpID)
+		}
+		chirp = c
+
+		reactions := dbStructure.Likes
+		count := &c.LikeCount
+		if kind == reactionRechirp {
+			reactions = dbStructure.Rechirps
+			count = &c.RechirpCount
+		}
+
+		_, has := reactions[chirpID][userID]
+		if has == on {
+			return nil
+		}
+		if on {
+			if reactions[chirpID] == nil {
+				setKey(dbStructure, reactions, chirpID, map[int]time.Time{})
+			}
+			setKey(dbStructure, reactions[chirpID], userID, now)
+			*count++
+		} else {
+			deleteKey(dbStructure, reactions[chirpID], userID)
+			if len(reactions[chirpID]) == 0 {
+				deleteKey(dbStructure, reactions, chirpID)
+			}
+			*count--
+		}
+
+		dbStructure.putChirp(c)
+		chirp = c
+		return nil
+	})
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, nil
+}
@@ -0,0 +1,164 @@
+package model
+
+import (
+	"fmt"
+	"time"
+)
+
+// Report is a user's complaint about a chirp, open until a moderator
+// reviews the chirp.
+type Report struct {
+	ID         int       `json:"id"`
+	ChirpID    int       `json:"chirp_id"`
+	ReporterID int       `json:"reporter_id"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// ReviewItem is a chirp waiting for a moderator: either it was flagged by
+// the moderation pipeline or users reported it.
+type ReviewItem struct {
+	Chirp   Chirp    `json:"chirp"`
+	Reports []Report `json:"reports"`
+}
+
+// ReviewAction is a moderator's decision about a chirp.
+type ReviewAction string
+
+const (
+	// ReviewApprove keeps the chirp, or makes a hidden chirp visible again.
+	ReviewApprove ReviewAction = "approve"
+	// ReviewHide takes the chirp out of every listing without deleting it.
+	// Hidden chirps can still be reported, which puts them back in the
+	// review queue.
+	ReviewHide ReviewAction = "hide"
+	// ReviewDelete purges the chirp straight away, as PurgeDeletedChirps
+	// does once the restore window is over, so its author can't restore
+	// it.
+	ReviewDelete ReviewAction = "delete"
+)
+
+// AuditEntry records a moderator's action.
+type AuditEntry struct {
+	ID          int          `json:"id"`
+	ModeratorID int          `json:"moderator_id"`
+	ChirpID     int          `json:"chirp_id"`
+	Action      ReviewAction `json:"action"`
+	Note        string       `json:"note,omitempty"`
+	// ChirpBody is the body when the action was taken, so the entry still
+	// says what was removed after a delete.
+	ChirpBody string `json:"chirp_body"`
+	// Purged is set when the action purged the chirp rather than leaving it
+	// restorable.
+	Purged    bool      `json:"purged,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ReportChirp files a report about a chirp, which may be hidden but not
+// deleted. A user has at most one open report per chirp; reporting again
+// returns the existing report.
+func (db *DB) ReportChirp(chirpID int, reporterID int, reason string) (Report, error) {
+	now := time.Now().UTC()
+	report := Report{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		if chirp, ok := dbStructure.Chirps[chirpID]; !ok || chirp.DeletedAt != nil {
+			return fmt.Errorf("Chirp ID %d not found", chirpID)
+		}
+		for _, r := range dbStructure.Reports[chirpID] {
+			if r.ReporterID == reporterID {
+				report = r
+				return nil
+			}
+		}
+
+		report = Report{
+			ID:         dbStructure.nextID(reportSequence),
+			ChirpID:    chirpID,
+			ReporterID: reporterID,
+			Reason:     reason,
+			CreatedAt:  now,
+		}
+		setKey(dbStructure, dbStructure.Reports, chirpID, append(dbStructure.Reports[chirpID], report))
+		return nil
+	})
+	return report, err
+}
+
+// GetReviewQueue returns the chirps waiting for review, oldest first,
+// including hidden chirps that were reported again.
+func (db *DB) GetReviewQueue() ([]ReviewItem, error) {
+	queue := []ReviewItem{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		for _, id := range dbStructure.index.ids {
+			chirp := dbStructure.Chirps[id]
+			reports := dbStructure.Reports[id]
+			if chirp.DeletedAt != nil || (!chirp.Flagged && len(reports) == 0) {
+				continue
+			}
+			queue = append(queue, ReviewItem{
+				Chirp:   chirp,
+				Reports: append([]Report{}, reports...),
+			})
+		}
+		return nil
+	})
+	return queue, err
+}
+
+// ReviewChirp applies a moderator's decision to a chirp, closes its reports
+// and clears its flag, and records the action in the audit log.
+func (db *DB) ReviewChirp(chirpID int, moderatorID int, action ReviewAction, note string) (AuditEntry, error) {
+	now := time.Now().UTC()
+	entry := AuditEntry{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		chirp, ok := dbStructure.Chirps[chirpID]
+		if !ok || chirp.DeletedAt != nil {
+			return fmt.Errorf("Chirp ID %d not found", chirpID)
+		}
+
+		switch action {
+		case ReviewApprove, ReviewHide:
+			chirp.Flagged = false
+			chirp.Hidden = action == ReviewHide
+			dbStructure.putChirp(chirp)
+			deleteKey(dbStructure, dbStructure.Reports, chirpID)
+		case ReviewDelete:
+			if err := dbStructure.purgeChirp(chirpID); err != nil {
+				return err
+			}
+		default:
+			return fmt.Errorf("unknown review action %q", action)
+		}
+
+		entry = AuditEntry{
+			ID:          dbStructure.nextID(auditSequence),
+			ModeratorID: moderatorID,
+			ChirpID:     chirpID,
+			Action:      action,
+			Note:        note,
+			ChirpBody:   chirp.Body,
+			Purged:      action == ReviewDelete,
+			CreatedAt:   now,
+		}
+		dbStructure.appendAudit(entry)
+		return nil
+	})
+	return entry, err
+}
+
+// appendAudit adds entry to the audit log, undoably.
+func (dbStructure *dbStructure) appendAudit(entry AuditEntry) {
+	auditLog := dbStructure.AuditLog
+	dbStructure.onUndo(func() { dbStructure.AuditLog = auditLog })
+	dbStructure.AuditLog = append(dbStructure.AuditLog, entry)
+}
+
+// GetAuditLog returns every moderator action, oldest first.
+func (db *DB) GetAuditLog() ([]AuditEntry, error) {
+	entries := []AuditEntry{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		entries = append(entries, dbStructure.AuditLog...)
+		return nil
+	})
+	return entries, err
+}
@@ -0,0 +1,106 @@
+package model
+
+import "testing"
+
+// queueIDs returns the IDs of the chirps in the review queue.
+func queueIDs(t *testing.T, store Store) []int {
+	t.Helper()
+	queue, err := store.GetReviewQueue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := []int{}
+	for _, item := range queue {
+		ids = append(ids, item.Chirp.ID)
+	}
+	return ids
+}
+
+func TestStoreReviewQueue(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+		flagged, err := store.CreateChirp(ChirpParams{Body: "flagged", AuthorID: alice.ID, Flagged: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reported, err := store.CreateChirp(ChirpParams{Body: "reported", AuthorID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.CreateChirp(ChirpParams{Body: "fine", AuthorID: alice.ID}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReportChirp(reported.ID, bob.ID, "rude"); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := queueIDs(t, store), []int{flagged.ID, reported.ID}; !sameIDs(got, want) {
+			t.Fatalf("queue = %v, want %v", got, want)
+		}
+
+		// A hidden chirp leaves the queue until it is reported again.
+		if _, err := store.ReviewChirp(reported.ID, bob.ID, ReviewHide, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := queueIDs(t, store), []int{flagged.ID}; !sameIDs(got, want) {
+			t.Fatalf("queue after hiding = %v, want %v", got, want)
+		}
+		if _, err := store.ReportChirp(reported.ID, bob.ID, "still rude"); err != nil {
+			t.Fatalf("reporting a hidden chirp: %s", err)
+		}
+		if got, want := queueIDs(t, store), []int{flagged.ID, reported.ID}; !sameIDs(got, want) {
+			t.Fatalf("queue after reporting again = %v, want %v", got, want)
+		}
+
+		if _, err := store.ReviewChirp(flagged.ID, bob.ID, ReviewApprove, ""); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := queueIDs(t, store), []int{reported.ID}; !sameIDs(got, want) {
+			t.Fatalf("queue after approving = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestStoreReviewDeletePurges(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+		chirp, err := store.CreateChirp(ChirpParams{Body: "spam", AuthorID: alice.ID, Flagged: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReviewChirp(chirp.ID, bob.ID, ReviewHide, "first look"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.ReviewChirp(chirp.ID, bob.ID, ReviewDelete, "spam"); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.GetDeletedChirp(chirp.ID); err == nil {
+			t.Error("GetDeletedChirp found a chirp deleted in review")
+		}
+		if _, err := store.RestoreChirp(chirp.ID); err == nil {
+			t.Error("restoring a chirp deleted in review succeeded")
+		}
+		if _, err := store.ReportChirp(chirp.ID, alice.ID, ""); err == nil {
+			t.Error("reporting a purged chirp succeeded")
+		}
+		if got := queueIDs(t, store); len(got) != 0 {
+			t.Errorf("queue after deleting = %v, want none", got)
+		}
+
+		entries, err := store.GetAuditLog()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) != 2 {
+			t.Fatalf("audit log has %d entries, want 2", len(entries))
+		}
+		if entries[0].Purged {
+			t.Error("the hide entry is marked purged")
+		}
+		if deleted := entries[1]; deleted.Action != ReviewDelete || !deleted.Purged || deleted.ChirpBody != "spam" {
+			t.Errorf("delete entry = %+v", deleted)
+		}
+	})
+}
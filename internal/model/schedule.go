@@ -0,0 +1,199 @@
+package model
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"time"
+)
+
+// PendingChirp is a chirp that hasn't been published yet: a draft, or a
+// chirp scheduled for later. It gets a chirp ID, and appears anywhere but
+// its author's pending list, only once it is published.
+type PendingChirp struct {
+	ID          int    `json:"id"`
+	AuthorID    int    `json:"author_id"`
+	Body        string `json:"body"`
+	InReplyToID int    `json:"in_reply_to_id,omitempty"`
+	MediaIDs    []int  `json:"media_ids,omitempty"`
+	Flagged     bool   `json:"flagged,omitempty"`
+	// Draft chirps are never published until the author clears Draft.
+	Draft bool `json:"draft"`
+	// PublishAt is when the chirp is due. Nil means as soon as it isn't a
+	// draft.
+	PublishAt *time.Time `json:"publish_at,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// Due reports whether the chirp should be published at now.
+func (p PendingChirp) Due(now time.Time) bool {
+	return !p.Draft && (p.PublishAt == nil || !p.PublishAt.After(now))
+}
+
+// dueAt is PublishAt, with chirps due as soon as possible first.
+func (p PendingChirp) dueAt() time.Time {
+	if p.PublishAt == nil {
+		return time.Time{}
+	}
+	return *p.PublishAt
+}
+
+func (p PendingChirp) params() ChirpParams {
+	return ChirpParams{
+		Body:        p.Body,
+		AuthorID:    p.AuthorID,
+		InReplyToID: p.InReplyToID,
+		Flagged:     p.Flagged,
+		MediaIDs:    p.MediaIDs,
+	}
+}
+
+// CreatePendingChirp saves a draft or scheduled chirp. The chirp it replies
+// to and its media are checked as for CreateChirp, and the media is set
+// aside until the chirp is published or cancelled. ID, CreatedAt and
+// UpdatedAt are set by the store.
+func (db *DB) CreatePendingChirp(pending PendingChirp) (PendingChirp, error) {
+	now := time.Now().UTC()
+	pending.CreatedAt = now
+	pending.UpdatedAt = now
+
+	err := db.Update(func(dbStructure *dbStructure) error {
+		if err := dbStructure.checkPublishable(pending); err != nil {
+			return err
+		}
+
+		pending.ID = dbStructure.nextID(pendingSequence)
+		dbStructure.reserveMedia(pending.MediaIDs, pending.ID)
+		setKey(dbStructure, dbStructure.PendingChirps, pending.ID, pending)
+		return nil
+	})
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	return pending, nil
+}
+
+func (db *DB) GetPendingChirp(id int) (PendingChirp, error) {
+	pending := PendingChirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		p, ok := dbStructure.PendingChirps[id]
+		if !ok {
+			return fmt.Errorf("Pending chirp ID %d not found", id)
+		}
+		pending = p
+		return nil
+	})
+	return pending, err
+}
+
+// GetPendingChirps returns the chirps authorID hasn't published yet, in the
+// order they were created.
+func (db *DB) GetPendingChirps(authorID int) ([]PendingChirp, error) {
+	pending := []PendingChirp{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		for _, p := range dbStructure.PendingChirps {
+			if p.AuthorID == authorID {
+				pending = append(pending, p)
+			}
+		}
+		return nil
+	})
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ID < pending[j].ID })
+	return pending, err
+}
+
+// UpdatePendingChirp replaces the body, moderation flag, draft flag and
+// publication time of the pending chirp with pending's ID. Its other fields
+// are ignored.
+func (db *DB) UpdatePendingChirp(pending PendingChirp) (PendingChirp, error) {
+	updated := PendingChirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		p, ok := dbStructure.PendingChirps[pending.ID]
+		if !ok {
+			return fmt.Errorf("Pending chirp ID %d not found", pending.ID)
+		}
+		p.Body = pending.Body
+		p.Flagged = pending.Flagged
+		p.Draft = pending.Draft
+		p.PublishAt = pending.PublishAt
+		p.UpdatedAt = time.Now().UTC()
+		setKey(dbStructure, dbStructure.PendingChirps, p.ID, p)
+		updated = p
+		return nil
+	})
+	return updated, err
+}
+
+// DeletePendingChirp cancels a pending chirp, releasing its media.
+func (db *DB) DeletePendingChirp(id int) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		pending, ok := dbStructure.PendingChirps[id]
+		if !ok {
+			return fmt.Errorf("Pending chirp ID %d not found", id)
+		}
+		dbStructure.reserveMedia(pending.MediaIDs, 0)
+		deleteKey(dbStructure, dbStructure.PendingChirps, id)
+		return nil
+	})
+}
+
+// PublishDueChirps publishes the pending chirps that are due at now, in the
+// order they fell due, and returns the new chirps. A chirp that can no
+// longer be published, such as a reply to a chirp deleted in the meantime,
+// is turned back into a draft for its author to deal with.
+func (db *DB) PublishDueChirps(now time.Time) ([]Chirp, error) {
+	published := []Chirp{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		due := []PendingChirp{}
+		for _, pending := range dbStructure.PendingChirps {
+			if pending.Due(now) {
+				due = append(due, pending)
+			}
+		}
+		sort.Slice(due, func(i, j int) bool {
+			if !due[i].dueAt().Equal(due[j].dueAt()) {
+				return due[i].dueAt().Before(due[j].dueAt())
+			}
+			return due[i].ID < due[j].ID
+		})
+
+		// Nothing in here fails: earlier chirps are already published by the
+		// time a later one is found unpublishable, and Update can't take
+		// them back.
+		for _, pending := range due {
+			err := dbStructure.checkPublishable(pending)
+			if err == nil {
+				var chirp Chirp
+				chirp, err = dbStructure.createChirp(pending.params(), pending.ID, now.UTC())
+				if err == nil {
+					deleteKey(dbStructure, dbStructure.PendingChirps, pending.ID)
+					published = append(published, chirp)
+					continue
+				}
+			}
+			log.Printf("Can't publish pending chirp %d, keeping it as a draft: %s\n", pending.ID, err)
+			pending.Draft = true
+			pending.UpdatedAt = now.UTC()
+			setKey(dbStructure, dbStructure.PendingChirps, pending.ID, pending)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return published, nil
+}
+
+// checkPublishable returns the error createChirp would fail with for
+// pending, if any. Before pending is saved its ID is zero, so the check is
+// the one for a new chirp.
+func (dbStructure *dbStructure) checkPublishable(pending PendingChirp) error {
+	if pending.InReplyToID != 0 {
+		if _, ok := dbStructure.liveChirp(pending.InReplyToID); !ok {
+			return fmt.Errorf("Chirp ID %d not found", pending.InReplyToID)
+		}
+	}
+	_, err := dbStructure.attachments(pending.AuthorID, pending.MediaIDs, pending.ID)
+	return err
+}
@@ -0,0 +1,209 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func mustCreatePendingChirp(t *testing.T, store Store, pending PendingChirp) PendingChirp {
+	t.Helper()
+	pending, err := store.CreatePendingChirp(pending)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pending
+}
+
+func TestStorePublishDueChirps(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		now := time.Now().UTC()
+		later := now.Add(time.Hour)
+		soon := now.Add(time.Minute)
+
+		draft := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "draft", Draft: true})
+		scheduled := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "later", PublishAt: &later})
+		first := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "soon", PublishAt: &soon})
+
+		pending, err := store.GetPendingChirps(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pending) != 3 {
+			t.Fatalf("GetPendingChirps returned %d chirps, want 3", len(pending))
+		}
+		chirps, err := store.GetChirps(ChirpQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) != 0 {
+			t.Fatalf("pending chirps are listed: %+v", chirps)
+		}
+
+		published, err := store.PublishDueChirps(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 0 {
+			t.Fatalf("published %+v before anything was due", published)
+		}
+
+		// Both scheduled chirps are due; they come out in the order they
+		// fell due, not the order they were created.
+		published, err = store.PublishDueChirps(later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 2 || published[0].Body != "soon" || published[1].Body != "later" {
+			t.Fatalf("published %+v, want soon then later", published)
+		}
+		if published[0].ID >= published[1].ID {
+			t.Errorf("chirp IDs %d and %d don't follow the publication order", published[0].ID, published[1].ID)
+		}
+		if !published[1].CreatedAt.Equal(later) {
+			t.Errorf("CreatedAt = %s, want the publication time %s", published[1].CreatedAt, later)
+		}
+		for _, id := range []int{scheduled.ID, first.ID} {
+			if _, err := store.GetPendingChirp(id); err == nil {
+				t.Errorf("pending chirp %d is still pending after publishing", id)
+			}
+		}
+		chirps, err = store.GetChirps(ChirpQuery{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(chirps) != 2 {
+			t.Errorf("got %d chirps after publishing, want 2", len(chirps))
+		}
+
+		// Drafts wait until the author clears Draft.
+		if published, _ := store.PublishDueChirps(later.Add(24 * time.Hour)); len(published) != 0 {
+			t.Fatalf("published the draft: %+v", published)
+		}
+		draft.Draft = false
+		if _, err := store.UpdatePendingChirp(draft); err != nil {
+			t.Fatal(err)
+		}
+		published, err = store.PublishDueChirps(later)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 1 || published[0].Body != "draft" {
+			t.Errorf("published %+v, want the former draft", published)
+		}
+	})
+}
+
+func TestStoreUpdatePendingChirp(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		pending := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "first", Draft: true})
+
+		publishAt := time.Now().UTC().Add(time.Hour).Truncate(time.Second)
+		updated, err := store.UpdatePendingChirp(PendingChirp{ID: pending.ID, AuthorID: alice.ID + 1, Body: "second", PublishAt: &publishAt})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetPendingChirp(pending.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Body != "second" || got.Draft || got.PublishAt == nil || !got.PublishAt.Equal(publishAt) {
+			t.Errorf("GetPendingChirp = %+v", got)
+		}
+		if got.AuthorID != alice.ID || updated.AuthorID != alice.ID {
+			t.Errorf("UpdatePendingChirp changed the author to %d", got.AuthorID)
+		}
+
+		if _, err := store.UpdatePendingChirp(PendingChirp{ID: pending.ID + 100}); err == nil {
+			t.Error("UpdatePendingChirp of a missing chirp succeeded")
+		}
+
+		if err := store.DeletePendingChirp(pending.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetPendingChirp(pending.ID); err == nil {
+			t.Error("GetPendingChirp found a cancelled chirp")
+		}
+		if err := store.DeletePendingChirp(pending.ID); err == nil {
+			t.Error("DeletePendingChirp of a cancelled chirp succeeded")
+		}
+	})
+}
+
+func TestStorePendingChirpMedia(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		media, err := store.CreateMedia(Media{OwnerID: alice.ID, Key: "photo.png", ContentType: "image/png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pending := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "photo", Draft: true, MediaIDs: []int{media.ID}})
+		// The media is set aside for the pending chirp.
+		_, err = store.CreateChirp(ChirpParams{Body: "mine now", AuthorID: alice.ID, MediaIDs: []int{media.ID}})
+		if !errors.Is(err, ErrInvalidMedia) {
+			t.Fatalf("attaching reserved media: got %v, want ErrInvalidMedia", err)
+		}
+
+		pending.Draft = false
+		if _, err := store.UpdatePendingChirp(pending); err != nil {
+			t.Fatal(err)
+		}
+		published, err := store.PublishDueChirps(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 1 || len(published[0].Attachments) != 1 || published[0].Attachments[0].ID != media.ID {
+			t.Fatalf("published %+v, want a chirp carrying the media", published)
+		}
+
+		// Cancelling a pending chirp releases its media.
+		other, err := store.CreateMedia(Media{OwnerID: alice.ID, Key: "other.png", ContentType: "image/png"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		cancelled := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "cancelled", Draft: true, MediaIDs: []int{other.ID}})
+		if err := store.DeletePendingChirp(cancelled.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.CreateChirp(ChirpParams{Body: "reused", AuthorID: alice.ID, MediaIDs: []int{other.ID}}); err != nil {
+			t.Errorf("attaching media of a cancelled chirp: %s", err)
+		}
+	})
+}
+
+func TestStorePublishOrphanedReply(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		parent, err := store.CreateChirp(ChirpParams{Body: "parent", AuthorID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		reply := mustCreatePendingChirp(t, store, PendingChirp{AuthorID: alice.ID, Body: "reply", InReplyToID: parent.ID})
+		if _, err := store.CreatePendingChirp(PendingChirp{AuthorID: alice.ID, Body: "reply", InReplyToID: parent.ID + 100}); err == nil {
+			t.Error("CreatePendingChirp replying to a missing chirp succeeded")
+		}
+
+		if err := store.DeleteChirp(parent.ID); err != nil {
+			t.Fatal(err)
+		}
+		// A reply whose parent went away is kept as a draft rather than
+		// failing the whole run.
+		published, err := store.PublishDueChirps(time.Now())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(published) != 0 {
+			t.Fatalf("published %+v", published)
+		}
+		got, err := store.GetPendingChirp(reply.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.Draft {
+			t.Error("the orphaned reply wasn't turned into a draft")
+		}
+	})
+}
@@ -0,0 +1,226 @@
+package model
+
+import (
+	"errors"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+)
+
+// SearchQuery selects a page of chirps matching a full-text query.
+//
+// Text is a list of words, all of which must appear in a matching chirp.
+// Words wrapped in double quotes form a phrase that must appear in that exact
+// order. Matching ignores case and punctuation.
+type SearchQuery struct {
+	Text     string
+	AuthorID *int
+	Offset   int
+	// Limit caps the number of chirps returned. Zero means no limit.
+	Limit int
+}
+
+var ErrEmptySearchQuery = errors.New("Search query has no words")
+
+// postings maps a term to the chirps containing it and, for each chirp, the
+// positions at which the term occurs.
+type postings map[string]map[int][]int
+
+// searchIndex is the inverted index used for full-text search.
+type searchIndex struct {
+	terms   postings
+	lengths map[int]int
+	total   int
+}
+
+func newSearchIndex() searchIndex {
+	return searchIndex{
+		terms:   postings{},
+		lengths: map[int]int{},
+	}
+}
+
+func (idx *searchIndex) add(id int, body string) {
+	tokens := tokenize(body)
+	for pos, term := range tokens {
+		if idx.terms[term] == nil {
+			idx.terms[term] = map[int][]int{}
+		}
+		idx.terms[term][id] = append(idx.terms[term][id], pos)
+	}
+	idx.lengths[id] = len(tokens)
+	idx.total += len(tokens)
+}
+
+func (idx *searchIndex) remove(id int, body string) {
+	for _, term := range tokenize(body) {
+		delete(idx.terms[term], id)
+		if len(idx.terms[term]) == 0 {
+			delete(idx.terms, term)
+		}
+	}
+	idx.total -= idx.lengths[id]
+	delete(idx.lengths, id)
+}
+
+// tokenize splits text into case-folded words. Runs of letters, digits and
+// combining marks form a word; everything else separates words.
+func tokenize(text string) []string {
+	words := strings.FieldsFunc(text, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.Is(unicode.Mn, r)
+	})
+	// A Caser is not safe for concurrent use, so each call gets its own.
+	fold := cases.Fold()
+	tokens := make([]string, 0, len(words))
+	for _, word := range words {
+		tokens = append(tokens, fold.String(word))
+	}
+	return tokens
+}
+
+type parsedQuery struct {
+	// terms holds every distinct word of the query, including phrase words.
+	terms []string
+	// phrases holds the quoted phrases with more than one word.
+	phrases [][]string
+}
+
+func parseSearchQuery(text string) (parsedQuery, error) {
+	q := parsedQuery{}
+	seen := map[string]bool{}
+	addTerms := func(tokens []string) {
+		for _, token := range tokens {
+			if !seen[token] {
+				seen[token] = true
+				q.terms = append(q.terms, token)
+			}
+		}
+	}
+
+	for i, part := range strings.Split(text, `"`) {
+		tokens := tokenize(part)
+		addTerms(tokens)
+		// Odd parts were between quotes.
+		if i%2 == 1 && len(tokens) > 1 {
+			q.phrases = append(q.phrases, tokens)
+		}
+	}
+
+	if len(q.terms) == 0 {
+		return q, ErrEmptySearchQuery
+	}
+	return q, nil
+}
+
+type scoredChirp struct {
+	id    int
+	score float64
+}
+
+// rank returns the IDs of the chirps containing every query term and phrase,
+// best match first. It scores with BM25, using the term postings, chirp
+// lengths (in tokens), number of indexed chirps and average chirp length.
+func rank(q parsedQuery, terms postings, lengths map[int]int, n int, avgLength float64) []scoredChirp {
+	const k1, b = 1.2, 0.75
+
+	candidates := []int{}
+	for id := range terms[q.terms[0]] {
+		candidates = append(candidates, id)
+	}
+
+	results := []scoredChirp{}
+candidates:
+	for _, id := range candidates {
+		for _, term := range q.terms[1:] {
+			if _, ok := terms[term][id]; !ok {
+				continue candidates
+			}
+		}
+		for _, phrase := range q.phrases {
+			if !containsPhrase(terms, id, phrase) {
+				continue candidates
+			}
+		}
+
+		score := 0.0
+		for _, term := range q.terms {
+			df := float64(len(terms[term]))
+			tf := float64(len(terms[term][id]))
+			idf := math.Log(1 + (float64(n)-df+0.5)/(df+0.5))
+			norm := 1 - b
+			if avgLength > 0 {
+				norm += b * float64(lengths[id]) / avgLength
+			}
+			score += idf * tf * (k1 + 1) / (tf + k1*norm)
+		}
+		results = append(results, scoredChirp{id: id, score: score})
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].score != results[j].score {
+			return results[i].score > results[j].score
+		}
+		return results[i].id > results[j].id
+	})
+	return results
+}
+
+func containsPhrase(terms postings, id int, phrase []string) bool {
+	next := map[int]bool{}
+	for _, pos := range terms[phrase[0]][id] {
+		next[pos+1] = true
+	}
+	for _, term := range phrase[1:] {
+		found := map[int]bool{}
+		for _, pos := range terms[term][id] {
+			if next[pos] {
+				found[pos+1] = true
+			}
+		}
+		if len(found) == 0 {
+			return false
+		}
+		next = found
+	}
+	return true
+}
+
+func (db *DB) SearchChirps(q SearchQuery) ([]Chirp, error) {
+	parsed, err := parseSearchQuery(q.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	chirps := []Chirp{}
+	err = db.View(func(dbStructure *dbStructure) error {
+		idx := dbStructure.index.search
+		avgLength := 0.0
+		if len(idx.lengths) > 0 {
+			avgLength = float64(idx.total) / float64(len(idx.lengths))
+		}
+
+		skipped := 0
+		for _, result := range rank(parsed, idx.terms, idx.lengths, len(idx.lengths), avgLength) {
+			if q.Limit > 0 && len(chirps) == q.Limit {
+				break
+			}
+			chirp := dbStructure.Chirps[result.id]
+			if chirp.DeletedAt != nil || chirp.Hidden {
+				continue
+			}
+			if q.AuthorID != nil && chirp.AuthorID != *q.AuthorID {
+				continue
+			}
+			if skipped < q.Offset {
+				skipped++
+				continue
+			}
+			chirps = append(chirps, chirp)
+		}
+		return nil
+	})
+	return chirps, err
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World!", []string{"hello", "world"}},
+		{"  spaced   out  ", []string{"spaced", "out"}},
+		{"Straße STRASSE", []string{"strasse", "strasse"}},
+		{"café naïve", []string{"café", "naïve"}},
+		{"route66 is 4ever", []string{"route66", "is", "4ever"}},
+		{"!!!", []string{}},
+	}
+	for _, tt := range tests {
+		if got := tokenize(tt.text); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("tokenize(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestParseSearchQuery(t *testing.T) {
+	q, err := parseSearchQuery(`Go "gopher FOOD" go`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"go", "gopher", "food"}; !reflect.DeepEqual(q.terms, want) {
+		t.Errorf("terms = %q, want %q", q.terms, want)
+	}
+	if want := [][]string{{"gopher", "food"}}; !reflect.DeepEqual(q.phrases, want) {
+		t.Errorf("phrases = %q, want %q", q.phrases, want)
+	}
+
+	if _, err := parseSearchQuery(`"" ?!`); !errors.Is(err, ErrEmptySearchQuery) {
+		t.Errorf("got %v, want ErrEmptySearchQuery", err)
+	}
+}
+
+func TestStoreSearchChirps(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+		create := func(body string, authorID int) int {
+			t.Helper()
+			chirp, err := store.CreateChirp(ChirpParams{Body: body, AuthorID: authorID})
+			if err != nil {
+				t.Fatal(err)
+			}
+			return chirp.ID
+		}
+		search := func(q SearchQuery) []int {
+			t.Helper()
+			chirps, err := store.SearchChirps(q)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return chirpIDs(chirps)
+		}
+
+		food := create("Gophers love FOOD", alice.ID)
+		reversed := create("food for gophers, food and more food", bob.ID)
+		create("nothing to see here", alice.ID)
+
+		if got := search(SearchQuery{Text: "Food"}); !sameIDs(got, []int{reversed, food}) {
+			t.Errorf("food: got %v, want the chirp saying it three times first", got)
+		}
+		if got := search(SearchQuery{Text: `"gophers love"`}); !sameIDs(got, []int{food}) {
+			t.Errorf("phrase: got %v, want [%d]", got, food)
+		}
+		if got := search(SearchQuery{Text: `"love gophers"`}); len(got) != 0 {
+			t.Errorf("phrase in the wrong order matched %v", got)
+		}
+		if got := search(SearchQuery{Text: "gophers", AuthorID: &bob.ID}); !sameIDs(got, []int{reversed}) {
+			t.Errorf("by author: got %v, want [%d]", got, reversed)
+		}
+		if got := search(SearchQuery{Text: "food", Offset: 1, Limit: 1}); !sameIDs(got, []int{food}) {
+			t.Errorf("second page: got %v, want [%d]", got, food)
+		}
+
+		// The index follows edits and deletions.
+		if _, err := store.UpdateChirp(food, "Gophers love naps", false); err != nil {
+			t.Fatal(err)
+		}
+		if got := search(SearchQuery{Text: "food"}); !sameIDs(got, []int{reversed}) {
+			t.Errorf("after editing: got %v, want [%d]", got, reversed)
+		}
+		if got := search(SearchQuery{Text: "naps"}); !sameIDs(got, []int{food}) {
+			t.Errorf("new words after editing: got %v, want [%d]", got, food)
+		}
+		if err := store.DeleteChirp(reversed); err != nil {
+			t.Fatal(err)
+		}
+		if got := search(SearchQuery{Text: "food"}); len(got) != 0 {
+			t.Errorf("after deleting: got %v", got)
+		}
+
+		if _, err := store.SearchChirps(SearchQuery{Text: "?"}); !errors.Is(err, ErrEmptySearchQuery) {
+			t.Errorf("got %v, want ErrEmptySearchQuery", err)
+		}
+	})
+}
@@ -0,0 +1,241 @@
+package model
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+// ErrInvalidRefreshToken is returned for refresh tokens that are unknown,
+// expired or belong to a session that has ended.
+var ErrInvalidRefreshToken = errors.New("invalid refresh token")
+
+// ErrRefreshTokenReused is returned when a refresh token that has already
+// been exchanged is presented again. Someone else may hold a copy of it, so
+// its session has been ended.
+var ErrRefreshTokenReused = errors.New("refresh token reused")
+
+// Session is a device a user signed in on. Each refresh exchanges the
+// session's current refresh token for a new one; together they form the
+// session's token family.
+type Session struct {
+	ID         int       `json:"id"`
+	UserID     int       `json:"user_id"`
+	Device     string    `json:"device"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	// ExpiresAt is when the current refresh token expires, ending the
+	// session unless it is refreshed first.
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// RefreshToken is a refresh token as stored. Only a hash of the token is
+// kept.
+type RefreshToken struct {
+	Hash      string    `json:"hash"`
+	SessionID int       `json:"session_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+	// RotatedAt is set once the token has been exchanged for a new one.
+	RotatedAt *time.Time `json:"rotated_at,omitempty"`
+}
+
+// NewRefreshToken returns a random opaque refresh token and the hash to
+// store it under.
+func NewRefreshToken() (token string, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	token = hex.EncodeToString(b)
+	return token, HashRefreshToken(token), nil
+}
+
+// HashRefreshToken returns the hash a refresh token is stored under.
+func HashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateSession starts a session for userID whose first refresh token has
+// the hash tokenHash and expires at expiresAt.
+func (db *DB) CreateSession(userID int, device string, tokenHash string, expiresAt time.Time) (Session, error) {
+	now := time.Now().UTC()
+	session := Session{
+		UserID:     userID,
+		Device:     device,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt.UTC(),
+	}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Users[userID]; !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", userID)
+		}
+		session.ID = dbStructure.nextID(sessionSequence)
+		setKey(dbStructure, dbStructure.Sessions, session.ID, session)
+		setKey(dbStructure, dbStructure.RefreshTokens, tokenHash, RefreshToken{
+			Hash:      tokenHash,
+			SessionID: session.ID,
+			ExpiresAt: session.ExpiresAt,
+		})
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	return session, nil
+}
+
+// RefreshSession exchanges the refresh token with hash oldHash for one with
+// hash newHash, which expires at expiresAt, and returns the session. If the
+// old token was already exchanged, the session is ended and
+// ErrRefreshTokenReused returned.
+func (db *DB) RefreshSession(oldHash string, newHash string, now time.Time, expiresAt time.Time) (Session, error) {
+	session := Session{}
+	reused := false
+	err := db.Update(func(dbStructure *dbStructure) error {
+		token, ok := dbStructure.RefreshTokens[oldHash]
+		if !ok || !token.ExpiresAt.After(now) {
+			return ErrInvalidRefreshToken
+		}
+		s, ok := dbStructure.Sessions[token.SessionID]
+		if !ok {
+			return ErrInvalidRefreshToken
+		}
+		if token.RotatedAt != nil {
+			// Report the reuse once the session's end has been saved.
+			reused = true
+			dbStructure.deleteSession(s.ID)
+			return nil
+		}
+
+		rotatedAt := now.UTC()
+		token.RotatedAt = &rotatedAt
+		setKey(dbStructure, dbStructure.RefreshTokens, oldHash, token)
+		s.LastUsedAt = now.UTC()
+		s.ExpiresAt = expiresAt.UTC()
+		setKey(dbStructure, dbStructure.Sessions, s.ID, s)
+		setKey(dbStructure, dbStructure.RefreshTokens, newHash, RefreshToken{
+			Hash:      newHash,
+			SessionID: s.ID,
+			ExpiresAt: s.ExpiresAt,
+		})
+		session = s
+		return nil
+	})
+	if err != nil {
+		return Session{}, err
+	}
+	if reused {
+		return Session{}, ErrRefreshTokenReused
+	}
+	return session, nil
+}
+
+func (db *DB) GetSession(id int) (Session, error) {
+	session := Session{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		s, ok := dbStructure.Sessions[id]
+		if !ok {
+			return fmt.Errorf("Session ID %d not found", id)
+		}
+		session = s
+		return nil
+	})
+	return session, err
+}
+
+// GetSessions returns the sessions of userID that haven't expired by now,
+// most recently used first.
+func (db *DB) GetSessions(userID int, now time.Time) ([]Session, error) {
+	sessions := []Session{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		for _, session := range dbStructure.Sessions {
+			if session.UserID == userID && session.ExpiresAt.After(now) {
+				sessions = append(sessions, session)
+			}
+		}
+		return nil
+	})
+	sort.Slice(sessions, func(i, j int) bool {
+		if !sessions[i].LastUsedAt.Equal(sessions[j].LastUsedAt) {
+			return sessions[i].LastUsedAt.After(sessions[j].LastUsedAt)
+		}
+		return sessions[i].ID > sessions[j].ID
+	})
+	return sessions, err
+}
+
+// DeleteSession ends a session, revoking its refresh tokens.
+func (db *DB) DeleteSession(id int) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		if _, ok := dbStructure.Sessions[id]; !ok {
+			return fmt.Errorf("Session ID %d not found", id)
+		}
+		dbStructure.deleteSession(id)
+		return nil
+	})
+}
+
+// DeleteSessionByToken ends the session the refresh token with hash
+// tokenHash belongs to.
+func (db *DB) DeleteSessionByToken(tokenHash string) error {
+	return db.Update(func(dbStructure *dbStructure) error {
+		token, ok := dbStructure.RefreshTokens[tokenHash]
+		if !ok {
+			return ErrInvalidRefreshToken
+		}
+		dbStructure.deleteSession(token.SessionID)
+		return nil
+	})
+}
+
+// PruneSessions deletes the sessions and refresh tokens that expired before
+// now and returns the number of sessions deleted.
+func (db *DB) PruneSessions(now time.Time) (int, error) {
+	pruned := 0
+	err := db.Update(func(dbStructure *dbStructure) error {
+		for id, session := range dbStructure.Sessions {
+			if !session.ExpiresAt.After(now) {
+				deleteKey(dbStructure, dbStructure.Sessions, id)
+				pruned++
+			}
+		}
+		for hash, token := range dbStructure.RefreshTokens {
+			_, ok := dbStructure.Sessions[token.SessionID]
+			if !ok || !token.ExpiresAt.After(now) {
+				deleteKey(dbStructure, dbStructure.RefreshTokens, hash)
+			}
+		}
+		return nil
+	})
+	return pruned, err
+}
+
+func (dbStructure *dbStructure) deleteSession(id int) {
+	deleteKey(dbStructure, dbStructure.Sessions, id)
+	for hash, token := range dbStructure.RefreshTokens {
+		if token.SessionID == id {
+			deleteKey(dbStructure, dbStructure.RefreshTokens, hash)
+		}
+	}
+}
+
+// signOutUser ends all sessions of userID and deletes the authorization
+// codes issued for them.
+func (dbStructure *dbStructure) signOutUser(userID int) {
+	for id, session := range dbStructure.Sessions {
+		if session.UserID == userID {
+			dbStructure.deleteSession(id)
+		}
+	}
+	for hash, code := range dbStructure.AuthCodes {
+		if code.UserID == userID {
+			deleteKey(dbStructure, dbStructure.AuthCodes, hash)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package model
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestStoreRefreshSession(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		user := mustCreateUser(t, store, "alice@example.com")
+		now := time.Now()
+		session, err := store.CreateSession(user.ID, "laptop", "hash-1", now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		later := now.Add(time.Minute)
+		refreshed, err := store.RefreshSession("hash-1", "hash-2", later, later.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if refreshed.ID != session.ID {
+			t.Errorf("RefreshSession returned session %d, want %d", refreshed.ID, session.ID)
+		}
+		if !refreshed.ExpiresAt.Equal(later.Add(time.Hour).UTC()) {
+			t.Errorf("ExpiresAt = %s, want %s", refreshed.ExpiresAt, later.Add(time.Hour).UTC())
+		}
+
+		// The new token rotates on in turn.
+		if _, err := store.RefreshSession("hash-2", "hash-3", later, later.Add(time.Hour)); err != nil {
+			t.Fatalf("refreshing with the rotated token: %s", err)
+		}
+
+		// Presenting a replaced token ends the whole family.
+		if _, err := store.RefreshSession("hash-1", "hash-4", later, later.Add(time.Hour)); !errors.Is(err, ErrRefreshTokenReused) {
+			t.Fatalf("reusing a replaced token: got %v, want ErrRefreshTokenReused", err)
+		}
+		if _, err := store.GetSession(session.ID); err == nil {
+			t.Error("the session survived the token's reuse")
+		}
+		if _, err := store.RefreshSession("hash-3", "hash-5", later, later.Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refreshing with the latest token after the reuse: got %v, want ErrInvalidRefreshToken", err)
+		}
+		if _, err := store.RefreshSession("hash-4", "hash-6", later, later.Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("the token issued for the reuse works: got %v", err)
+		}
+	})
+}
+
+func TestStoreRefreshSessionExpired(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		user := mustCreateUser(t, store, "alice@example.com")
+		now := time.Now()
+		if _, err := store.CreateSession(user.ID, "laptop", "hash-1", now.Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		later := now.Add(2 * time.Hour)
+		if _, err := store.RefreshSession("hash-1", "hash-2", later, later.Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refreshing with an expired token: got %v, want ErrInvalidRefreshToken", err)
+		}
+		if _, err := store.RefreshSession("unknown", "hash-3", now, now.Add(time.Hour)); !errors.Is(err, ErrInvalidRefreshToken) {
+			t.Errorf("refreshing with an unknown token: got %v, want ErrInvalidRefreshToken", err)
+		}
+	})
+}
+
+func TestStorePruneSessions(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		user := mustCreateUser(t, store, "alice@example.com")
+		now := time.Now()
+		expired, err := store.CreateSession(user.ID, "old phone", "hash-old", now.Add(-time.Minute))
+		if err != nil {
+			t.Fatal(err)
+		}
+		live, err := store.CreateSession(user.ID, "laptop", "hash-live", now.Add(time.Hour))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		pruned, err := store.PruneSessions(now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pruned != 1 {
+			t.Errorf("PruneSessions pruned %d sessions, want 1", pruned)
+		}
+		if _, err := store.GetSession(expired.ID); err == nil {
+			t.Error("the expired session is still there")
+		}
+		if _, err := store.GetSession(live.ID); err != nil {
+			t.Errorf("the live session was pruned: %s", err)
+		}
+		if _, err := store.RefreshSession("hash-live", "hash-next", now, now.Add(time.Hour)); err != nil {
+			t.Errorf("the live session's token stopped working: %s", err)
+		}
+
+		sessions, err := store.GetSessions(user.ID, now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(sessions) != 1 || sessions[0].ID != live.ID {
+			t.Errorf("GetSessions = %+v, want only the live session", sessions)
+		}
+	})
+}
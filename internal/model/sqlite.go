@@ -0,0 +1,343 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+)
+
+type SQLiteDB struct {
+	db   *sql.DB
+	path string
+}
+
+type sqliteMigration struct {
+	name string
+	stmt string
+	// fn, if set, runs after stmt in the same transaction, for changes that
+	// can't be expressed in SQL such as backfilling derived data.
+	fn func(tx *sql.Tx) error
+}
+
+// sqliteMigrations holds the schema changes for the SQLite store. Each entry
+// is applied once, in order, and the number applied is tracked in the
+// database's user_version pragma. Append new migrations; never edit old ones.
+var sqliteMigrations = []sqliteMigration{
+	{"create users, chirps and revoked_tokens", `CREATE TABLE users (
+		id            INTEGER PRIMARY KEY AUTOINCREMENT,
+		email         TEXT    NOT NULL UNIQUE,
+		password      TEXT    NOT NULL,
+		is_chirpy_red INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE TABLE chirps (
+		id        INTEGER PRIMARY KEY AUTOINCREMENT,
+		body      TEXT    NOT NULL,
+		author_id INTEGER NOT NULL REFERENCES users(id)
+	);
+	CREATE INDEX chirps_author_id ON chirps(author_id);
+	CREATE TABLE revoked_tokens (
+		token      TEXT PRIMARY KEY,
+		revoked_at TEXT NOT NULL
+	);`, nil},
+	{"add chirp timestamps and revisions", `ALTER TABLE chirps ADD COLUMN created_at DATETIME NOT NULL DEFAULT '';
+	ALTER TABLE chirps ADD COLUMN updated_at DATETIME NOT NULL DEFAULT '';
+	UPDATE chirps SET
+		created_at = strftime('%Y-%m-%dT%H:%M:%f000000Z'),
+		updated_at = strftime('%Y-%m-%dT%H:%M:%f000000Z');
+	CREATE TABLE chirp_revisions (
+		id         INTEGER  PRIMARY KEY AUTOINCREMENT,
+		chirp_id   INTEGER  NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		body       TEXT     NOT NULL,
+		created_at DATETIME NOT NULL
+	);
+	CREATE INDEX chirp_revisions_chirp_id ON chirp_revisions(chirp_id);`, nil},
+	{"add full-text search index", `CREATE TABLE chirp_terms (
+		term     TEXT    NOT NULL,
+		chirp_id INTEGER NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		position INTEGER NOT NULL
+	);
+	CREATE INDEX chirp_terms_term ON chirp_terms(term, chirp_id);
+	CREATE INDEX chirp_terms_chirp_id ON chirp_terms(chirp_id);
+	ALTER TABLE chirps ADD COLUMN term_count INTEGER NOT NULL DEFAULT 0;`, backfillSearchIndex},
+	{"add follows", `CREATE TABLE follows (
+		follower_id INTEGER  NOT NULL REFERENCES users(id),
+		followee_id INTEGER  NOT NULL REFERENCES users(id),
+		created_at  DATETIME NOT NULL,
+		PRIMARY KEY (follower_id, followee_id)
+	);
+	CREATE INDEX follows_followee_id ON follows(followee_id);`, nil},
+	{"add likes and rechirps", `CREATE TABLE likes (
+		chirp_id   INTEGER  NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		user_id    INTEGER  NOT NULL REFERENCES users(id),
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (chirp_id, user_id)
+	);
+	CREATE TABLE rechirps (
+		chirp_id   INTEGER  NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		user_id    INTEGER  NOT NULL REFERENCES users(id),
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (chirp_id, user_id)
+	);
+	ALTER TABLE chirps ADD COLUMN like_count INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE chirps ADD COLUMN rechirp_count INTEGER NOT NULL DEFAULT 0;`, nil},
+	{"add replies and tombstones", `ALTER TABLE chirps ADD COLUMN in_reply_to_id INTEGER REFERENCES chirps(id);
+	ALTER TABLE chirps ADD COLUMN deleted_at DATETIME;
+	CREATE INDEX chirps_in_reply_to_id ON chirps(in_reply_to_id);`, nil},
+	{"add handles, hashtags and mentions", `ALTER TABLE users ADD COLUMN handle TEXT;
+	CREATE UNIQUE INDEX users_handle ON users(handle COLLATE NOCASE);
+	ALTER TABLE chirps ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+	ALTER TABLE chirps ADD COLUMN mentions TEXT NOT NULL DEFAULT '[]';
+	CREATE TABLE chirp_tags (
+		chirp_id INTEGER NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		tag      TEXT    NOT NULL,
+		PRIMARY KEY (chirp_id, tag)
+	);
+	CREATE INDEX chirp_tags_tag ON chirp_tags(tag, chirp_id);
+	CREATE TABLE chirp_mentions (
+		chirp_id INTEGER NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		user_id  INTEGER NOT NULL REFERENCES users(id),
+		PRIMARY KEY (chirp_id, user_id)
+	);
+	CREATE INDEX chirp_mentions_user_id ON chirp_mentions(user_id, chirp_id);`, backfillEntities},
+	{"add moderation flag", `ALTER TABLE chirps ADD COLUMN flagged INTEGER NOT NULL DEFAULT 0;`, nil},
+	{"add reports, hidden chirps, admins and audit log", `ALTER TABLE chirps ADD COLUMN hidden INTEGER NOT NULL DEFAULT 0;
+	ALTER TABLE users ADD COLUMN is_admin INTEGER NOT NULL DEFAULT 0;
+	CREATE TABLE reports (
+		id          INTEGER  PRIMARY KEY AUTOINCREMENT,
+		chirp_id    INTEGER  NOT NULL REFERENCES chirps(id) ON DELETE CASCADE,
+		reporter_id INTEGER  NOT NULL REFERENCES users(id),
+		reason      TEXT     NOT NULL,
+		created_at  DATETIME NOT NULL,
+		UNIQUE (chirp_id, reporter_id)
+	);
+	CREATE TABLE audit_log (
+		id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+		moderator_id INTEGER  NOT NULL REFERENCES users(id),
+		chirp_id     INTEGER  NOT NULL,
+		action       TEXT     NOT NULL,
+		note         TEXT     NOT NULL,
+		chirp_body   TEXT     NOT NULL,
+		created_at   DATETIME NOT NULL
+	);`, nil},
+	{"add media", `CREATE TABLE media (
+		id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+		owner_id     INTEGER  NOT NULL REFERENCES users(id),
+		key          TEXT     NOT NULL UNIQUE,
+		content_type TEXT     NOT NULL,
+		size         INTEGER  NOT NULL,
+		created_at   DATETIME NOT NULL,
+		chirp_id     INTEGER  REFERENCES chirps(id) ON DELETE SET NULL
+	);
+	CREATE INDEX media_chirp_id ON media(chirp_id);
+	ALTER TABLE chirps ADD COLUMN attachments TEXT NOT NULL DEFAULT '[]';`, nil},
+	{"add link previews", `ALTER TABLE chirps ADD COLUMN preview TEXT;`, nil},
+	// in_reply_to_id has no foreign key so the chirp can be deleted; the
+	// scheduler turns the reply back into a draft instead.
+	{"add scheduled chirps and drafts", `CREATE TABLE pending_chirps (
+		id             INTEGER  PRIMARY KEY AUTOINCREMENT,
+		author_id      INTEGER  NOT NULL REFERENCES users(id),
+		body           TEXT     NOT NULL,
+		in_reply_to_id INTEGER,
+		media_ids      TEXT     NOT NULL DEFAULT '[]',
+		flagged        INTEGER  NOT NULL DEFAULT 0,
+		draft          INTEGER  NOT NULL DEFAULT 0,
+		publish_at     DATETIME,
+		created_at     DATETIME NOT NULL,
+		updated_at     DATETIME NOT NULL
+	);
+	CREATE INDEX pending_chirps_author_id ON pending_chirps(author_id);
+	CREATE INDEX pending_chirps_publish_at ON pending_chirps(publish_at);
+	ALTER TABLE media ADD COLUMN pending_id INTEGER REFERENCES pending_chirps(id) ON DELETE SET NULL;`, nil},
+	// Deleted chirps used to be purged straight away.
+	{"add soft delete", `ALTER TABLE chirps ADD COLUMN purged INTEGER NOT NULL DEFAULT 0;
+	UPDATE chirps SET purged = 1 WHERE deleted_at IS NOT NULL;`, nil},
+	// Refresh tokens used to be JWTs checked against a list of revoked
+	// tokens. Users signed in with one have to sign in again.
+	{"add sessions", `DROP TABLE revoked_tokens;
+	CREATE TABLE sessions (
+		id           INTEGER  PRIMARY KEY AUTOINCREMENT,
+		user_id      INTEGER  NOT NULL REFERENCES users(id),
+		device       TEXT     NOT NULL,
+		created_at   DATETIME NOT NULL,
+		last_used_at DATETIME NOT NULL,
+		expires_at   DATETIME NOT NULL
+	);
+	CREATE INDEX sessions_user_id ON sessions(user_id);
+	CREATE TABLE refresh_tokens (
+		hash       TEXT     PRIMARY KEY,
+		session_id INTEGER  NOT NULL REFERENCES sessions(id) ON DELETE CASCADE,
+		expires_at DATETIME NOT NULL,
+		rotated_at DATETIME
+	);
+	CREATE INDEX refresh_tokens_session_id ON refresh_tokens(session_id);`, nil},
+	{"add oauth clients", `CREATE TABLE oauth_clients (
+		id            TEXT     PRIMARY KEY,
+		name          TEXT     NOT NULL,
+		secret_hash   TEXT     NOT NULL DEFAULT '',
+		redirect_uris TEXT     NOT NULL,
+		scopes        TEXT     NOT NULL,
+		created_at    DATETIME NOT NULL
+	);
+	CREATE TABLE authorization_codes (
+		hash           TEXT     PRIMARY KEY,
+		client_id      TEXT     NOT NULL REFERENCES oauth_clients(id) ON DELETE CASCADE,
+		user_id        INTEGER  NOT NULL REFERENCES users(id),
+		redirect_uri   TEXT     NOT NULL,
+		scope          TEXT     NOT NULL,
+		code_challenge TEXT     NOT NULL,
+		nonce          TEXT     NOT NULL DEFAULT '',
+		auth_time      DATETIME NOT NULL,
+		expires_at     DATETIME NOT NULL
+	);`, nil},
+	{"add external identities", `CREATE TABLE external_identities (
+		issuer     TEXT     NOT NULL,
+		subject    TEXT     NOT NULL,
+		user_id    INTEGER  NOT NULL REFERENCES users(id),
+		created_at DATETIME NOT NULL,
+		PRIMARY KEY (issuer, subject)
+	);
+	CREATE INDEX external_identities_user_id ON external_identities(user_id);`, nil},
+	// Review deletes have always purged the chirp.
+	{"record purges in the audit log", `ALTER TABLE audit_log ADD COLUMN purged INTEGER NOT NULL DEFAULT 0;
+	UPDATE audit_log SET purged = 1 WHERE action = 'delete';`, nil},
+}
+
+// sqliteTimeLayout is a fixed-width UTC layout, so times stored as text sort
+// and compare in chronological order.
+const sqliteTimeLayout = "2006-01-02T15:04:05.000000000Z"
+
+func sqliteTime(t time.Time) string {
+	return t.UTC().Format(sqliteTimeLayout)
+}
+
+// sqlPlaceholders returns n comma-separated bind parameters for an IN list.
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+func NewSQLiteDB(path string) (*SQLiteDB, error) {
+	sqliteDB, err := openSQLiteDB(path)
+	if err != nil {
+		return nil, err
+	}
+
+	report, err := sqliteDB.migrate(false)
+	if err != nil {
+		sqliteDB.Close()
+		return nil, err
+	}
+	if len(report.Applied) > 0 {
+		log.Println(report)
+	}
+	return sqliteDB, nil
+}
+
+// MigrateSQLiteDB brings the SQLite database at path up to the latest schema
+// version. A copy of the database as it was before migrating is written next
+// to it. With dryRun the pending migrations are only reported.
+func MigrateSQLiteDB(path string, dryRun bool) (MigrationReport, error) {
+	sqliteDB, err := openSQLiteDB(path)
+	if err != nil {
+		return MigrationReport{Path: path, DryRun: dryRun}, err
+	}
+	defer sqliteDB.Close()
+
+	report, err := sqliteDB.migrate(dryRun)
+	report.Path = path
+	return report, err
+}
+
+func openSQLiteDB(path string) (*SQLiteDB, error) {
+	dsn := fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path)
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, err
+	}
+	// SQLite allows a single writer; one connection keeps transactions simple
+	// and avoids SQLITE_BUSY under concurrent requests.
+	db.SetMaxOpenConns(1)
+
+	return &SQLiteDB{db: db, path: path}, nil
+}
+
+// ResetSQLiteDB removes the database file along with its WAL and shared
+// memory files.
+func ResetSQLiteDB(path string) error {
+	for _, suffix := range []string{"-wal", "-shm"} {
+		if err := os.Remove(path + suffix); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return os.Remove(path)
+}
+
+func (s *SQLiteDB) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLiteDB) migrate(dryRun bool) (MigrationReport, error) {
+	report := MigrationReport{Path: s.path, DryRun: dryRun}
+
+	var version int
+	if err := s.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return report, err
+	}
+	report.FromVersion = version
+	report.ToVersion = version
+	if version > len(sqliteMigrations) {
+		return report, fmt.Errorf("schema version %d is newer than the latest supported version %d", version, len(sqliteMigrations))
+	}
+
+	pending := sqliteMigrations[version:]
+	if dryRun {
+		for _, m := range pending {
+			report.Applied = append(report.Applied, m.name)
+		}
+		report.ToVersion = len(sqliteMigrations)
+		return report, nil
+	}
+
+	// A brand new database has nothing worth backing up.
+	if version > 0 && len(pending) > 0 {
+		backup := fmt.Sprintf("%s.v%d.bak", s.path, version)
+		os.Remove(backup)
+		if _, err := s.db.Exec("VACUUM INTO ?", backup); err != nil {
+			return report, fmt.Errorf("backing up database: %w", err)
+		}
+		report.Backup = backup
+	}
+
+	for _, m := range pending {
+		tx, err := s.db.Begin()
+		if err != nil {
+			return report, err
+		}
+		if _, err := tx.Exec(m.stmt); err != nil {
+			tx.Rollback()
+			return report, fmt.Errorf("migration %q: %w", m.name, err)
+		}
+		if m.fn != nil {
+			if err := m.fn(tx); err != nil {
+				tx.Rollback()
+				return report, fmt.Errorf("migration %q: %w", m.name, err)
+			}
+		}
+		if _, err := tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", report.ToVersion+1)); err != nil {
+			tx.Rollback()
+			return report, err
+		}
+		if err := tx.Commit(); err != nil {
+			return report, err
+		}
+		report.ToVersion++
+		report.Applied = append(report.Applied, m.name)
+	}
+
+	return report, nil
+}
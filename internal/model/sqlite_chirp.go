@@ -0,0 +1,297 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const sqliteChirpColumns = "chirps.id, chirps.body, chirps.author_id, chirps.created_at, chirps.updated_at, " +
+	"chirps.like_count, chirps.rechirp_count, chirps.in_reply_to_id, chirps.deleted_at, chirps.flagged, " +
+	"chirps.hidden, chirps.tags, chirps.mentions, chirps.attachments, chirps.preview, chirps.purged"
+
+func scanChirp(row interface{ Scan(...interface{}) error }) (Chirp, error) {
+	chirp := Chirp{}
+	var inReplyToID sql.NullInt64
+	var deletedAt sql.NullTime
+	var tags, mentions, attachments, preview []byte
+	err := row.Scan(
+		&chirp.ID, &chirp.Body, &chirp.AuthorID, &chirp.CreatedAt, &chirp.UpdatedAt,
+		&chirp.LikeCount, &chirp.RechirpCount, &inReplyToID, &deletedAt, &chirp.Flagged,
+		&chirp.Hidden, &tags, &mentions, &attachments, &preview, &chirp.Purged,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	chirp.InReplyToID = int(inReplyToID.Int64)
+	if deletedAt.Valid {
+		chirp.DeletedAt = &deletedAt.Time
+	}
+	if err := json.Unmarshal(tags, &chirp.Tags); err != nil {
+		return Chirp{}, err
+	}
+	if err := json.Unmarshal(mentions, &chirp.Mentions); err != nil {
+		return Chirp{}, err
+	}
+	if err := json.Unmarshal(attachments, &chirp.Attachments); err != nil {
+		return Chirp{}, err
+	}
+	if preview != nil {
+		if err := json.Unmarshal(preview, &chirp.Preview); err != nil {
+			return Chirp{}, err
+		}
+	}
+	if len(chirp.Tags) == 0 {
+		chirp.Tags = nil
+	}
+	if len(chirp.Mentions) == 0 {
+		chirp.Mentions = nil
+	}
+	if len(chirp.Attachments) == 0 {
+		chirp.Attachments = nil
+	}
+	return chirp, nil
+}
+
+// nullID maps the zero ID to NULL for optional references.
+func nullID(id int) sql.NullInt64 {
+	return sql.NullInt64{Int64: int64(id), Valid: id != 0}
+}
+
+// sqliteLiveChirp loads a chirp unless it doesn't exist, is a tombstone or was
+// hidden by a moderator.
+func sqliteLiveChirp(q interface {
+	QueryRow(string, ...interface{}) *sql.Row
+}, id int) (Chirp, error) {
+	row := q.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ? AND deleted_at IS NULL AND hidden = 0", id)
+	chirp, err := scanChirp(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, fmt.Errorf("Chirp ID %d not found", id)
+	}
+	return chirp, err
+}
+
+func (s *SQLiteDB) CreateChirp(params ChirpParams) (Chirp, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := sqliteCreateChirp(tx, params, 0, chirpTime(params))
+	if err != nil {
+		return Chirp{}, err
+	}
+	return chirp, tx.Commit()
+}
+
+// sqliteCreateChirp implements CreateChirp. pendingID is the pending chirp
+// being published, if any, whose media the new chirp may carry.
+func sqliteCreateChirp(tx *sql.Tx, params ChirpParams, pendingID int, now time.Time) (Chirp, error) {
+	body := params.Body
+	if params.InReplyToID != 0 {
+		if _, err := sqliteLiveChirp(tx, params.InReplyToID); err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO chirps (body, author_id, created_at, updated_at, in_reply_to_id, flagged) VALUES (?, ?, ?, ?, ?, ?)",
+		body, params.AuthorID, sqliteTime(now), sqliteTime(now), nullID(params.InReplyToID), params.Flagged,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Chirp{}, err
+	}
+	if err := sqliteIndexChirp(tx, int(id), body); err != nil {
+		return Chirp{}, err
+	}
+	tags, mentions, err := sqliteIndexEntities(tx, int(id), body)
+	if err != nil {
+		return Chirp{}, err
+	}
+	attachments, err := sqliteAttachMedia(tx, int(id), params.AuthorID, params.MediaIDs, pendingID)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirp := Chirp{
+		ID:          int(id),
+		Body:        body,
+		AuthorID:    params.AuthorID,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		InReplyToID: params.InReplyToID,
+		Flagged:     params.Flagged,
+		Tags:        tags,
+		Mentions:    mentions,
+		Attachments: attachments,
+	}
+	return chirp, nil
+}
+
+func (s *SQLiteDB) DeleteChirp(id int) error {
+	result, err := s.db.Exec("UPDATE chirps SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", sqliteTime(time.Now()), id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("Chirp ID %d not found", id)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) UpdateChirp(id int, body string, flagged bool) (Chirp, error) {
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := sqliteLiveChirp(tx, id)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO chirp_revisions (chirp_id, body, created_at) VALUES (?, ?, ?)",
+		id, chirp.Body, sqliteTime(chirp.UpdatedAt),
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	_, err = tx.Exec(
+		"UPDATE chirps SET body = ?, updated_at = ?, flagged = ? WHERE id = ?",
+		body, sqliteTime(now), flagged, id,
+	)
+	if err != nil {
+		return Chirp{}, err
+	}
+	if LinkURL(body) != LinkURL(chirp.Body) {
+		if _, err := tx.Exec("UPDATE chirps SET preview = NULL WHERE id = ?", id); err != nil {
+			return Chirp{}, err
+		}
+		chirp.Preview = nil
+	}
+	if err := sqliteIndexChirp(tx, id, body); err != nil {
+		return Chirp{}, err
+	}
+	chirp.Tags, chirp.Mentions, err = sqliteIndexEntities(tx, id, body)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	chirp.Body = body
+	chirp.Flagged = flagged
+	chirp.UpdatedAt = now
+	return chirp, tx.Commit()
+}
+
+func (s *SQLiteDB) GetChirpHistory(id int) ([]ChirpRevision, error) {
+	if _, err := s.GetChirp(id); err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query("SELECT body, created_at FROM chirp_revisions WHERE chirp_id = ? ORDER BY id", id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	revisions := []ChirpRevision{}
+	for rows.Next() {
+		revision := ChirpRevision{}
+		if err := rows.Scan(&revision.Body, &revision.CreatedAt); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+
+	return revisions, rows.Err()
+}
+
+func (s *SQLiteDB) GetChirp(id int) (Chirp, error) {
+	return sqliteLiveChirp(s.db, id)
+}
+
+func (s *SQLiteDB) GetChirps(q ChirpQuery) ([]Chirp, error) {
+	conds, args := q.sqlConditions()
+	return s.queryChirpPage("SELECT "+sqliteChirpColumns+" FROM chirps", conds, args, q)
+}
+
+// sqlConditions translates the filters of q, apart from Limit and Order,
+// into WHERE conditions on the chirps table.
+func (q ChirpQuery) sqlConditions() ([]string, []interface{}) {
+	conds := []string{"chirps.deleted_at IS NULL", "chirps.hidden = 0"}
+	args := []interface{}{}
+	if q.AuthorID != nil {
+		conds = append(conds, "chirps.author_id = ?")
+		args = append(args, *q.AuthorID)
+	}
+	if q.AfterID > 0 {
+		if q.Order == "desc" {
+			conds = append(conds, "chirps.id < ?")
+		} else {
+			conds = append(conds, "chirps.id > ?")
+		}
+		args = append(args, q.AfterID)
+	}
+	if !q.Since.IsZero() {
+		conds = append(conds, "chirps.created_at >= ?")
+		args = append(args, sqliteTime(q.Since))
+	}
+	if !q.Until.IsZero() {
+		conds = append(conds, "chirps.created_at < ?")
+		args = append(args, sqliteTime(q.Until))
+	}
+	return conds, args
+}
+
+// queryChirpPage runs query with conds joined into its WHERE clause, then
+// orders and limits the result as q asks.
+func (s *SQLiteDB) queryChirpPage(query string, conds []string, args []interface{}, q ChirpQuery) ([]Chirp, error) {
+	if len(conds) > 0 {
+		query += " WHERE " + strings.Join(conds, " AND ")
+	}
+	if q.Order == "desc" {
+		query += " ORDER BY chirps.id DESC"
+	} else {
+		query += " ORDER BY chirps.id ASC"
+	}
+	if q.Limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, q.Limit)
+	}
+	return s.queryChirps(query, args...)
+}
+
+func (s *SQLiteDB) queryChirps(query string, args ...interface{}) ([]Chirp, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	chirps := []Chirp{}
+	for rows.Next() {
+		chirp, err := scanChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+
+	return chirps, rows.Err()
+}
@@ -0,0 +1,136 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+// sqliteIndexEntities extracts the hashtags and mentions from body and
+// replaces those stored for a chirp. The chirp's tags and mentions columns
+// keep them in order for display; chirp_tags and chirp_mentions index them
+// for lookups.
+func sqliteIndexEntities(tx *sql.Tx, id int, body string) ([]string, []int, error) {
+	var lookupErr error
+	tags, mentions := extractEntities(body, func(mention string) (int, bool) {
+		query := "SELECT id FROM users WHERE handle = ? COLLATE NOCASE"
+		if strings.Contains(mention, "@") {
+			query = "SELECT id FROM users WHERE email = ?"
+		}
+		var userID int
+		err := tx.QueryRow(query, mention).Scan(&userID)
+		if err != nil && !errors.Is(err, sql.ErrNoRows) && lookupErr == nil {
+			lookupErr = err
+		}
+		return userID, err == nil
+	})
+	if lookupErr != nil {
+		return nil, nil, lookupErr
+	}
+
+	for _, table := range []string{"chirp_tags", "chirp_mentions"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE chirp_id = ?", id); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, tag := range tags {
+		if _, err := tx.Exec("INSERT INTO chirp_tags (chirp_id, tag) VALUES (?, ?)", id, tag); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, userID := range mentions {
+		if _, err := tx.Exec("INSERT INTO chirp_mentions (chirp_id, user_id) VALUES (?, ?)", id, userID); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	tagsJSON, err := json.Marshal(append([]string{}, tags...))
+	if err != nil {
+		return nil, nil, err
+	}
+	mentionsJSON, err := json.Marshal(append([]int{}, mentions...))
+	if err != nil {
+		return nil, nil, err
+	}
+	_, err = tx.Exec("UPDATE chirps SET tags = ?, mentions = ? WHERE id = ?", tagsJSON, mentionsJSON, id)
+	return tags, mentions, err
+}
+
+func backfillEntities(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, body FROM chirps")
+	if err != nil {
+		return err
+	}
+	bodies := map[int]string{}
+	for rows.Next() {
+		var id int
+		var body string
+		if err := rows.Scan(&id, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		bodies[id] = body
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, body := range bodies {
+		if _, _, err := sqliteIndexEntities(tx, id, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteDB) GetChirpsByTag(tag string, q ChirpQuery) ([]Chirp, error) {
+	conds, args := q.sqlConditions()
+	conds = append(conds, "chirp_tags.tag = ?")
+	args = append(args, NormalizeTag(tag))
+	query := "SELECT " + sqliteChirpColumns + " FROM chirps JOIN chirp_tags ON chirp_tags.chirp_id = chirps.id"
+	return s.queryChirpPage(query, conds, args, q)
+}
+
+func (s *SQLiteDB) GetMentions(userID int, q ChirpQuery) ([]Chirp, error) {
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+
+	conds, args := q.sqlConditions()
+	conds = append(conds, "chirp_mentions.user_id = ?")
+	args = append(args, userID)
+	query := "SELECT " + sqliteChirpColumns + " FROM chirps JOIN chirp_mentions ON chirp_mentions.chirp_id = chirps.id"
+	return s.queryChirpPage(query, conds, args, q)
+}
+
+func (s *SQLiteDB) GetTrendingTags(since time.Time, limit int) ([]TagCount, error) {
+	query := `SELECT chirp_tags.tag, COUNT(*) FROM chirp_tags
+		JOIN chirps ON chirps.id = chirp_tags.chirp_id
+		WHERE chirps.created_at >= ? AND chirps.deleted_at IS NULL AND chirps.hidden = 0
+		GROUP BY chirp_tags.tag
+		ORDER BY COUNT(*) DESC, chirp_tags.tag`
+	args := []interface{}{sqliteTime(since)}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tags := []TagCount{}
+	for rows.Next() {
+		tag := TagCount{}
+		if err := rows.Scan(&tag.Tag, &tag.Count); err != nil {
+			return nil, err
+		}
+		tags = append(tags, tag)
+	}
+	return tags, rows.Err()
+}
@@ -0,0 +1,63 @@
+package model
+
+import "time"
+
+func (s *SQLiteDB) FollowUser(followerID int, followeeID int) error {
+	if _, err := s.GetUser(followeeID); err != nil {
+		return err
+	}
+	_, err := s.db.Exec(
+		"INSERT OR IGNORE INTO follows (follower_id, followee_id, created_at) VALUES (?, ?, ?)",
+		followerID, followeeID, sqliteTime(time.Now()),
+	)
+	return err
+}
+
+func (s *SQLiteDB) UnfollowUser(followerID int, followeeID int) error {
+	_, err := s.db.Exec("DELETE FROM follows WHERE follower_id = ? AND followee_id = ?", followerID, followeeID)
+	return err
+}
+
+func (s *SQLiteDB) GetFollowers(userID int) ([]User, error) {
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+	return s.queryUsers(`SELECT `+sqliteUserColumns+` FROM users
+		JOIN follows f ON f.follower_id = users.id
+		WHERE f.followee_id = ? ORDER BY users.id`, userID)
+}
+
+func (s *SQLiteDB) GetFollowing(userID int) ([]User, error) {
+	if _, err := s.GetUser(userID); err != nil {
+		return nil, err
+	}
+	return s.queryUsers(`SELECT `+sqliteUserColumns+` FROM users
+		JOIN follows f ON f.followee_id = users.id
+		WHERE f.follower_id = ? ORDER BY users.id`, userID)
+}
+
+func (s *SQLiteDB) GetTimeline(userID int, q ChirpQuery) ([]Chirp, error) {
+	conds, args := q.sqlConditions()
+	conds = append(conds, "f.follower_id = ?")
+	args = append(args, userID)
+	query := "SELECT " + sqliteChirpColumns + " FROM chirps JOIN follows f ON f.followee_id = chirps.author_id"
+	return s.queryChirpPage(query, conds, args, q)
+}
+
+func (s *SQLiteDB) queryUsers(query string, args ...interface{}) ([]User, error) {
+	rows, err := s.db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []User{}
+	for rows.Next() {
+		user, err := scanUser(rows)
+		if err != nil {
+			return nil, err
+		}
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
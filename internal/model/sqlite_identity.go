@@ -0,0 +1,68 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+func (s *SQLiteDB) SignInExternalUser(issuer string, subject string, email string) (User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	user, err := scanUser(tx.QueryRow(
+		"SELECT "+sqliteUserColumns+" FROM users "+
+			"JOIN external_identities ON external_identities.user_id = users.id "+
+			"WHERE external_identities.issuer = ? AND external_identities.subject = ?",
+		issuer, subject,
+	))
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return User{}, err
+	}
+	if email == "" {
+		return User{}, ErrNoVerifiedEmail
+	}
+
+	user, err = scanUser(tx.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE email = ?", email))
+	if errors.Is(err, sql.ErrNoRows) {
+		result, err := tx.Exec("INSERT INTO users (email, password) VALUES (?, '')", email)
+		if err != nil {
+			return User{}, err
+		}
+		id, err := result.LastInsertId()
+		if err != nil {
+			return User{}, err
+		}
+		user = User{ID: int(id), Email: email}
+	} else if err != nil {
+		return User{}, err
+	} else if user.Password != "" {
+		// See DB.SignInExternalUser. The session's refresh tokens go with
+		// it through ON DELETE CASCADE.
+		user.Password = ""
+		for _, stmt := range []string{
+			"UPDATE users SET password = '' WHERE id = ?",
+			"DELETE FROM sessions WHERE user_id = ?",
+			"DELETE FROM authorization_codes WHERE user_id = ?",
+		} {
+			if _, err := tx.Exec(stmt, user.ID); err != nil {
+				return User{}, err
+			}
+		}
+	}
+
+	_, err = tx.Exec(
+		"INSERT INTO external_identities (issuer, subject, user_id, created_at) VALUES (?, ?, ?, ?)",
+		issuer, subject, user.ID, sqliteTime(time.Now()),
+	)
+	if err != nil {
+		return User{}, err
+	}
+	return user, tx.Commit()
+}
@@ -0,0 +1,113 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLiteDB) CreateMedia(media Media) (Media, error) {
+	media.CreatedAt = time.Now().UTC()
+	media.ChirpID = 0
+	result, err := s.db.Exec(
+		"INSERT INTO media (owner_id, key, content_type, size, created_at) VALUES (?, ?, ?, ?, ?)",
+		media.OwnerID, media.Key, media.ContentType, media.Size, sqliteTime(media.CreatedAt),
+	)
+	if err != nil {
+		return Media{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Media{}, err
+	}
+	media.ID = int(id)
+	return media, nil
+}
+
+func (s *SQLiteDB) PruneMedia(cutoff time.Time) ([]Media, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT id, owner_id, key, content_type, size, created_at FROM media "+
+			"WHERE chirp_id IS NULL AND pending_id IS NULL AND created_at < ?",
+		sqliteTime(cutoff),
+	)
+	if err != nil {
+		return nil, err
+	}
+	pruned := []Media{}
+	for rows.Next() {
+		media := Media{}
+		if err := rows.Scan(&media.ID, &media.OwnerID, &media.Key, &media.ContentType, &media.Size, &media.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		pruned = append(pruned, media)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	for _, media := range pruned {
+		if _, err := tx.Exec("DELETE FROM media WHERE id = ?", media.ID); err != nil {
+			return nil, err
+		}
+	}
+	return pruned, tx.Commit()
+}
+
+// sqliteAttachMedia attaches the media in ids, which must be unattached
+// uploads by ownerID, to a new chirp. Media reserved by a pending chirp can
+// only be attached when publishing that chirp, as pendingID.
+func sqliteAttachMedia(tx *sql.Tx, chirpID int, ownerID int, ids []int, pendingID int) ([]Attachment, error) {
+	attachments, err := sqliteAttachments(tx, ownerID, ids, pendingID)
+	if err != nil {
+		return nil, err
+	}
+	for _, attachment := range attachments {
+		if _, err := tx.Exec("UPDATE media SET chirp_id = ?, pending_id = NULL WHERE id = ?", chirpID, attachment.ID); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(append([]Attachment{}, attachments...))
+	if err != nil {
+		return nil, err
+	}
+	_, err = tx.Exec("UPDATE chirps SET attachments = ? WHERE id = ?", data, chirpID)
+	return attachments, err
+}
+
+// sqliteAttachments checks that a new chirp by ownerID can carry the media
+// in ids and returns them as attachments.
+func sqliteAttachments(tx *sql.Tx, ownerID int, ids []int, pendingID int) ([]Attachment, error) {
+	if len(ids) > MaxAttachments {
+		return nil, fmt.Errorf("%w: a chirp can have at most %d attachments", ErrInvalidMedia, MaxAttachments)
+	}
+
+	var attachments []Attachment
+	seen := map[int]bool{}
+	for _, id := range ids {
+		attachment := Attachment{ID: id}
+		err := tx.QueryRow(
+			"SELECT key, content_type FROM media WHERE id = ? AND owner_id = ? AND chirp_id IS NULL AND pending_id IS ?",
+			id, ownerID, nullID(pendingID),
+		).Scan(&attachment.Key, &attachment.ContentType)
+		if errors.Is(err, sql.ErrNoRows) || seen[id] {
+			return nil, fmt.Errorf("%w: media ID %d can't be attached", ErrInvalidMedia, id)
+		}
+		if err != nil {
+			return nil, err
+		}
+		seen[id] = true
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
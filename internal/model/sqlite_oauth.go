@@ -0,0 +1,146 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const sqliteOAuthClientColumns = "id, name, secret_hash, redirect_uris, scopes, created_at"
+
+func scanOAuthClient(row interface{ Scan(...interface{}) error }) (OAuthClient, error) {
+	client := OAuthClient{}
+	var redirectURIs, scopes []byte
+	err := row.Scan(&client.ID, &client.Name, &client.SecretHash, &redirectURIs, &scopes, &client.CreatedAt)
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	if err := json.Unmarshal(redirectURIs, &client.RedirectURIs); err != nil {
+		return OAuthClient{}, err
+	}
+	if err := json.Unmarshal(scopes, &client.Scopes); err != nil {
+		return OAuthClient{}, err
+	}
+	return client, nil
+}
+
+func (s *SQLiteDB) CreateOAuthClient(client OAuthClient) (OAuthClient, error) {
+	client.CreatedAt = time.Now().UTC()
+	redirectURIs, err := json.Marshal(append([]string{}, client.RedirectURIs...))
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	scopes, err := json.Marshal(append([]string{}, client.Scopes...))
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	_, err = s.db.Exec(
+		"INSERT INTO oauth_clients ("+sqliteOAuthClientColumns+") VALUES (?, ?, ?, ?, ?, ?)",
+		client.ID, client.Name, client.SecretHash, string(redirectURIs), string(scopes), sqliteTime(client.CreatedAt),
+	)
+	if err != nil {
+		return OAuthClient{}, err
+	}
+	return client, nil
+}
+
+func (s *SQLiteDB) GetOAuthClient(id string) (OAuthClient, error) {
+	client, err := scanOAuthClient(s.db.QueryRow("SELECT "+sqliteOAuthClientColumns+" FROM oauth_clients WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return OAuthClient{}, fmt.Errorf("OAuth client %s not found", id)
+	}
+	return client, err
+}
+
+func (s *SQLiteDB) GetOAuthClients() ([]OAuthClient, error) {
+	rows, err := s.db.Query("SELECT " + sqliteOAuthClientColumns + " FROM oauth_clients ORDER BY created_at, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	clients := []OAuthClient{}
+	for rows.Next() {
+		client, err := scanOAuthClient(rows)
+		if err != nil {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, rows.Err()
+}
+
+func (s *SQLiteDB) DeleteOAuthClient(id string) error {
+	// The client's codes go with it through ON DELETE CASCADE.
+	result, err := s.db.Exec("DELETE FROM oauth_clients WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("OAuth client %s not found", id)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) CreateAuthorizationCode(code AuthorizationCode, now time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM authorization_codes WHERE expires_at <= ?", sqliteTime(now)); err != nil {
+		return err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO authorization_codes "+
+			"(hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, auth_time, expires_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		code.Hash, code.ClientID, code.UserID, code.RedirectURI, code.Scope,
+		code.CodeChallenge, code.Nonce, sqliteTime(code.AuthTime), sqliteTime(code.ExpiresAt),
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *SQLiteDB) ConsumeAuthorizationCode(hash string, now time.Time) (AuthorizationCode, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+	defer tx.Rollback()
+
+	code := AuthorizationCode{}
+	err = tx.QueryRow(
+		"SELECT hash, client_id, user_id, redirect_uri, scope, code_challenge, nonce, auth_time, expires_at "+
+			"FROM authorization_codes WHERE hash = ?",
+		hash,
+	).Scan(
+		&code.Hash, &code.ClientID, &code.UserID, &code.RedirectURI, &code.Scope,
+		&code.CodeChallenge, &code.Nonce, &code.AuthTime, &code.ExpiresAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	if err != nil {
+		return AuthorizationCode{}, err
+	}
+	if _, err := tx.Exec("DELETE FROM authorization_codes WHERE hash = ?", hash); err != nil {
+		return AuthorizationCode{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return AuthorizationCode{}, err
+	}
+	if !code.ExpiresAt.After(now) {
+		return AuthorizationCode{}, ErrInvalidAuthorizationCode
+	}
+	return code, nil
+}
@@ -0,0 +1,37 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+)
+
+func (s *SQLiteDB) SetChirpPreview(id int, preview LinkPreview) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var body string
+	err = tx.QueryRow("SELECT body FROM chirps WHERE id = ? AND deleted_at IS NULL", id).Scan(&body)
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("Chirp ID %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+	if LinkURL(body) != preview.URL {
+		return nil
+	}
+
+	data, err := json.Marshal(preview)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE chirps SET preview = ? WHERE id = ?", data, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
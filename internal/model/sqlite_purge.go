@@ -0,0 +1,126 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLiteDB) GetDeletedChirp(id int) (Chirp, error) {
+	row := s.db.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ? AND deleted_at IS NOT NULL AND purged = 0", id)
+	chirp, err := scanChirp(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, fmt.Errorf("Chirp ID %d not found", id)
+	}
+	return chirp, err
+}
+
+func (s *SQLiteDB) RestoreChirp(id int) (Chirp, error) {
+	result, err := s.db.Exec("UPDATE chirps SET deleted_at = NULL WHERE id = ? AND deleted_at IS NOT NULL AND purged = 0", id)
+	if err != nil {
+		return Chirp{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Chirp{}, err
+	}
+	if n == 0 {
+		return Chirp{}, fmt.Errorf("Chirp ID %d not found", id)
+	}
+	return scanChirp(s.db.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ?", id))
+}
+
+func (s *SQLiteDB) PurgeDeletedChirps(cutoff time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id FROM chirps WHERE deleted_at < ? AND purged = 0 ORDER BY id", sqliteTime(cutoff))
+	if err != nil {
+		return 0, err
+	}
+	ids := []int{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	for _, id := range ids {
+		if err := sqlitePurgeChirp(tx, id); err != nil {
+			return 0, err
+		}
+	}
+	return len(ids), tx.Commit()
+}
+
+// sqlitePurgeChirp implements purgeChirp for the SQLite store.
+func sqlitePurgeChirp(tx *sql.Tx, id int) error {
+	chirp, err := scanChirp(tx.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ? AND purged = 0", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("Chirp ID %d not found", id)
+	}
+	if err != nil {
+		return err
+	}
+
+	var replies int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM chirps WHERE in_reply_to_id = ?", id).Scan(&replies); err != nil {
+		return err
+	}
+	if replies > 0 {
+		for _, table := range []string{"likes", "rechirps", "chirp_revisions", "reports"} {
+			if _, err := tx.Exec("DELETE FROM "+table+" WHERE chirp_id = ?", id); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec("UPDATE media SET chirp_id = NULL WHERE chirp_id = ?", id); err != nil {
+			return err
+		}
+		_, err = tx.Exec(
+			"UPDATE chirps SET body = '', like_count = 0, rechirp_count = 0, flagged = 0, hidden = 0, "+
+				"attachments = '[]', preview = NULL, deleted_at = COALESCE(deleted_at, ?), purged = 1 WHERE id = ?",
+			sqliteTime(time.Now()), id,
+		)
+		if err != nil {
+			return err
+		}
+		if err := sqliteIndexChirp(tx, id, ""); err != nil {
+			return err
+		}
+		_, _, err := sqliteIndexEntities(tx, id, "")
+		return err
+	}
+
+	if _, err := tx.Exec("DELETE FROM chirps WHERE id = ?", id); err != nil {
+		return err
+	}
+	// A tombstone is only kept while it has replies.
+	for parentID := chirp.InReplyToID; parentID != 0; {
+		var grandparentID sql.NullInt64
+		err := tx.QueryRow(`SELECT in_reply_to_id FROM chirps
+			WHERE id = ? AND purged = 1
+			AND NOT EXISTS (SELECT 1 FROM chirps r WHERE r.in_reply_to_id = chirps.id)`, parentID).Scan(&grandparentID)
+		if errors.Is(err, sql.ErrNoRows) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec("DELETE FROM chirps WHERE id = ?", parentID); err != nil {
+			return err
+		}
+		parentID = int(grandparentID.Int64)
+	}
+	return nil
+}
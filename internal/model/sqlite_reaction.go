@@ -0,0 +1,97 @@
+package model
+
+import (
+	"database/sql"
+	"time"
+)
+
+func (s *SQLiteDB) LikeChirp(chirpID int, userID int) (Chirp, error) {
+	return s.setReaction(reactionLike, chirpID, userID, true)
+}
+
+func (s *SQLiteDB) UnlikeChirp(chirpID int, userID int) (Chirp, error) {
+	return s.setReaction(reactionLike, chirpID, userID, false)
+}
+
+func (s *SQLiteDB) Rechirp(chirpID int, userID int) (Chirp, error) {
+	return s.setReaction(reactionRechirp, chirpID, userID, true)
+}
+
+func (s *SQLiteDB) UndoRechirp(chirpID int, userID int) (Chirp, error) {
+	return s.setReaction(reactionRechirp, chirpID, userID, false)
+}
+
+func (s *SQLiteDB) GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error) {
+	liked := map[int]bool{}
+	if len(chirpIDs) == 0 {
+		return liked, nil
+	}
+
+	placeholders := sqlPlaceholders(len(chirpIDs))
+	args := []interface{}{userID}
+	for _, id := range chirpIDs {
+		args = append(args, id)
+	}
+	rows, err := s.db.Query("SELECT chirp_id FROM likes WHERE user_id = ? AND chirp_id IN ("+placeholders+")", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		liked[id] = true
+	}
+	return liked, rows.Err()
+}
+
+func (s *SQLiteDB) setReaction(kind reactionKind, chirpID int, userID int, on bool) (Chirp, error) {
+	table, column := "likes", "like_count"
+	if kind == reactionRechirp {
+		table, column = "rechirps", "rechirp_count"
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Chirp{}, err
+	}
+	defer tx.Rollback()
+
+	var result sql.Result
+	if on {
+		result, err = tx.Exec(
+			"INSERT OR IGNORE INTO "+table+" (chirp_id, user_id, created_at) "+
+				"SELECT id, ?, ? FROM chirps WHERE id = ? AND deleted_at IS NULL AND hidden = 0",
+			userID, sqliteTime(time.Now()), chirpID,
+		)
+	} else {
+		result, err = tx.Exec("DELETE FROM "+table+" WHERE chirp_id = ? AND user_id = ?", chirpID, userID)
+	}
+	if err != nil {
+		return Chirp{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return Chirp{}, err
+	}
+	if n > 0 {
+		delta := 1
+		if !on {
+			delta = -1
+		}
+		_, err = tx.Exec("UPDATE chirps SET "+column+" = "+column+" + ? WHERE id = ?", delta, chirpID)
+		if err != nil {
+			return Chirp{}, err
+		}
+	}
+
+	chirp, err := sqliteLiveChirp(tx, chirpID)
+	if err != nil {
+		return Chirp{}, err
+	}
+
+	return chirp, tx.Commit()
+}
@@ -0,0 +1,177 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+func (s *SQLiteDB) ReportChirp(chirpID int, reporterID int, reason string) (Report, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Report{}, err
+	}
+	defer tx.Rollback()
+
+	var found int
+	err = tx.QueryRow("SELECT 1 FROM chirps WHERE id = ? AND deleted_at IS NULL", chirpID).Scan(&found)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Report{}, fmt.Errorf("Chirp ID %d not found", chirpID)
+	}
+	if err != nil {
+		return Report{}, err
+	}
+
+	report := Report{}
+	err = tx.QueryRow(
+		"SELECT id, chirp_id, reporter_id, reason, created_at FROM reports WHERE chirp_id = ? AND reporter_id = ?",
+		chirpID, reporterID,
+	).Scan(&report.ID, &report.ChirpID, &report.ReporterID, &report.Reason, &report.CreatedAt)
+	if err == nil {
+		return report, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return Report{}, err
+	}
+
+	now := time.Now().UTC()
+	result, err := tx.Exec(
+		"INSERT INTO reports (chirp_id, reporter_id, reason, created_at) VALUES (?, ?, ?, ?)",
+		chirpID, reporterID, reason, sqliteTime(now),
+	)
+	if err != nil {
+		return Report{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Report{}, err
+	}
+
+	report = Report{
+		ID:         int(id),
+		ChirpID:    chirpID,
+		ReporterID: reporterID,
+		Reason:     reason,
+		CreatedAt:  now,
+	}
+	return report, tx.Commit()
+}
+
+func (s *SQLiteDB) GetReviewQueue() ([]ReviewItem, error) {
+	chirps, err := s.queryChirps(`SELECT ` + sqliteChirpColumns + ` FROM chirps
+		WHERE chirps.deleted_at IS NULL
+		AND (chirps.flagged = 1 OR EXISTS (SELECT 1 FROM reports WHERE reports.chirp_id = chirps.id))
+		ORDER BY chirps.id`)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.Query(`SELECT reports.id, reports.chirp_id, reports.reporter_id, reports.reason, reports.created_at
+		FROM reports JOIN chirps ON chirps.id = reports.chirp_id
+		WHERE chirps.deleted_at IS NULL
+		ORDER BY reports.id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	reports := map[int][]Report{}
+	for rows.Next() {
+		report := Report{}
+		if err := rows.Scan(&report.ID, &report.ChirpID, &report.ReporterID, &report.Reason, &report.CreatedAt); err != nil {
+			return nil, err
+		}
+		reports[report.ChirpID] = append(reports[report.ChirpID], report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	queue := make([]ReviewItem, 0, len(chirps))
+	for _, chirp := range chirps {
+		queue = append(queue, ReviewItem{
+			Chirp:   chirp,
+			Reports: append([]Report{}, reports[chirp.ID]...),
+		})
+	}
+	return queue, nil
+}
+
+func (s *SQLiteDB) ReviewChirp(chirpID int, moderatorID int, action ReviewAction, note string) (AuditEntry, error) {
+	now := time.Now().UTC()
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	defer tx.Rollback()
+
+	chirp, err := scanChirp(tx.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ? AND deleted_at IS NULL", chirpID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return AuditEntry{}, fmt.Errorf("Chirp ID %d not found", chirpID)
+	}
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	switch action {
+	case ReviewApprove, ReviewHide:
+		_, err := tx.Exec("UPDATE chirps SET flagged = 0, hidden = ? WHERE id = ?", action == ReviewHide, chirpID)
+		if err != nil {
+			return AuditEntry{}, err
+		}
+		if _, err := tx.Exec("DELETE FROM reports WHERE chirp_id = ?", chirpID); err != nil {
+			return AuditEntry{}, err
+		}
+	case ReviewDelete:
+		if err := sqlitePurgeChirp(tx, chirpID); err != nil {
+			return AuditEntry{}, err
+		}
+	default:
+		return AuditEntry{}, fmt.Errorf("unknown review action %q", action)
+	}
+
+	result, err := tx.Exec(
+		"INSERT INTO audit_log (moderator_id, chirp_id, action, note, chirp_body, purged, created_at) VALUES (?, ?, ?, ?, ?, ?, ?)",
+		moderatorID, chirpID, action, note, chirp.Body, action == ReviewDelete, sqliteTime(now),
+	)
+	if err != nil {
+		return AuditEntry{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return AuditEntry{}, err
+	}
+
+	entry := AuditEntry{
+		ID:          int(id),
+		ModeratorID: moderatorID,
+		ChirpID:     chirpID,
+		Action:      action,
+		Note:        note,
+		ChirpBody:   chirp.Body,
+		Purged:      action == ReviewDelete,
+		CreatedAt:   now,
+	}
+	return entry, tx.Commit()
+}
+
+func (s *SQLiteDB) GetAuditLog() ([]AuditEntry, error) {
+	rows, err := s.db.Query("SELECT id, moderator_id, chirp_id, action, note, chirp_body, purged, created_at FROM audit_log ORDER BY id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		entry := AuditEntry{}
+		err := rows.Scan(&entry.ID, &entry.ModeratorID, &entry.ChirpID, &entry.Action, &entry.Note, &entry.ChirpBody, &entry.Purged, &entry.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
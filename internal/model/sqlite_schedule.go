@@ -0,0 +1,233 @@
+package model
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+const sqlitePendingColumns = "id, author_id, body, in_reply_to_id, media_ids, flagged, draft, publish_at, created_at, updated_at"
+
+func scanPendingChirp(row interface{ Scan(...interface{}) error }) (PendingChirp, error) {
+	pending := PendingChirp{}
+	var inReplyToID sql.NullInt64
+	var publishAt sql.NullTime
+	var mediaIDs []byte
+	err := row.Scan(
+		&pending.ID, &pending.AuthorID, &pending.Body, &inReplyToID, &mediaIDs,
+		&pending.Flagged, &pending.Draft, &publishAt, &pending.CreatedAt, &pending.UpdatedAt,
+	)
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	pending.InReplyToID = int(inReplyToID.Int64)
+	if publishAt.Valid {
+		pending.PublishAt = &publishAt.Time
+	}
+	if err := json.Unmarshal(mediaIDs, &pending.MediaIDs); err != nil {
+		return PendingChirp{}, err
+	}
+	if len(pending.MediaIDs) == 0 {
+		pending.MediaIDs = nil
+	}
+	return pending, nil
+}
+
+// nullTime maps a nil time to NULL.
+func nullTime(t *time.Time) sql.NullString {
+	if t == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: sqliteTime(*t), Valid: true}
+}
+
+func (s *SQLiteDB) CreatePendingChirp(pending PendingChirp) (PendingChirp, error) {
+	now := time.Now().UTC()
+	pending.CreatedAt = now
+	pending.UpdatedAt = now
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	defer tx.Rollback()
+
+	problem, err := sqliteCheckPublishable(tx, pending)
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	if problem != nil {
+		return PendingChirp{}, problem
+	}
+
+	mediaIDs, err := json.Marshal(append([]int{}, pending.MediaIDs...))
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	result, err := tx.Exec(
+		"INSERT INTO pending_chirps (author_id, body, in_reply_to_id, media_ids, flagged, draft, publish_at, created_at, updated_at) "+
+			"VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		pending.AuthorID, pending.Body, nullID(pending.InReplyToID), mediaIDs, pending.Flagged, pending.Draft,
+		nullTime(pending.PublishAt), sqliteTime(now), sqliteTime(now),
+	)
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	pending.ID = int(id)
+
+	for _, mediaID := range pending.MediaIDs {
+		if _, err := tx.Exec("UPDATE media SET pending_id = ? WHERE id = ?", pending.ID, mediaID); err != nil {
+			return PendingChirp{}, err
+		}
+	}
+	return pending, tx.Commit()
+}
+
+func (s *SQLiteDB) GetPendingChirp(id int) (PendingChirp, error) {
+	row := s.db.QueryRow("SELECT "+sqlitePendingColumns+" FROM pending_chirps WHERE id = ?", id)
+	pending, err := scanPendingChirp(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return PendingChirp{}, fmt.Errorf("Pending chirp ID %d not found", id)
+	}
+	return pending, err
+}
+
+func (s *SQLiteDB) GetPendingChirps(authorID int) ([]PendingChirp, error) {
+	rows, err := s.db.Query("SELECT "+sqlitePendingColumns+" FROM pending_chirps WHERE author_id = ? ORDER BY id", authorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	pending := []PendingChirp{}
+	for rows.Next() {
+		p, err := scanPendingChirp(rows)
+		if err != nil {
+			return nil, err
+		}
+		pending = append(pending, p)
+	}
+	return pending, rows.Err()
+}
+
+func (s *SQLiteDB) UpdatePendingChirp(pending PendingChirp) (PendingChirp, error) {
+	result, err := s.db.Exec(
+		"UPDATE pending_chirps SET body = ?, flagged = ?, draft = ?, publish_at = ?, updated_at = ? WHERE id = ?",
+		pending.Body, pending.Flagged, pending.Draft, nullTime(pending.PublishAt), sqliteTime(time.Now()), pending.ID,
+	)
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return PendingChirp{}, err
+	}
+	if n == 0 {
+		return PendingChirp{}, fmt.Errorf("Pending chirp ID %d not found", pending.ID)
+	}
+	return s.GetPendingChirp(pending.ID)
+}
+
+func (s *SQLiteDB) DeletePendingChirp(id int) error {
+	// Deleting the row releases its media through ON DELETE SET NULL.
+	result, err := s.db.Exec("DELETE FROM pending_chirps WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("Pending chirp ID %d not found", id)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) PublishDueChirps(now time.Time) ([]Chirp, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(
+		"SELECT "+sqlitePendingColumns+" FROM pending_chirps "+
+			"WHERE draft = 0 AND (publish_at IS NULL OR publish_at <= ?) ORDER BY publish_at, id",
+		sqliteTime(now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	due := []PendingChirp{}
+	for rows.Next() {
+		pending, err := scanPendingChirp(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, pending)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	published := []Chirp{}
+	for _, pending := range due {
+		problem, err := sqliteCheckPublishable(tx, pending)
+		if err != nil {
+			return nil, err
+		}
+		if problem != nil {
+			log.Printf("Can't publish pending chirp %d, keeping it as a draft: %s\n", pending.ID, problem)
+			_, err := tx.Exec("UPDATE pending_chirps SET draft = 1, updated_at = ? WHERE id = ?", sqliteTime(now), pending.ID)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		chirp, err := sqliteCreateChirp(tx, pending.params(), pending.ID, now.UTC())
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tx.Exec("DELETE FROM pending_chirps WHERE id = ?", pending.ID); err != nil {
+			return nil, err
+		}
+		published = append(published, chirp)
+	}
+	return published, tx.Commit()
+}
+
+// sqliteCheckPublishable is checkPublishable for the SQLite store. The
+// reason pending can't be published is returned as problem; err is for
+// failures reading the database.
+func sqliteCheckPublishable(tx *sql.Tx, pending PendingChirp) (problem error, err error) {
+	if pending.InReplyToID != 0 {
+		var n int
+		err := tx.QueryRow(
+			"SELECT COUNT(*) FROM chirps WHERE id = ? AND deleted_at IS NULL AND hidden = 0",
+			pending.InReplyToID,
+		).Scan(&n)
+		if err != nil {
+			return nil, err
+		}
+		if n == 0 {
+			return fmt.Errorf("Chirp ID %d not found", pending.InReplyToID), nil
+		}
+	}
+
+	_, err = sqliteAttachments(tx, pending.AuthorID, pending.MediaIDs, pending.ID)
+	if errors.Is(err, ErrInvalidMedia) {
+		return err, nil
+	}
+	return nil, err
+}
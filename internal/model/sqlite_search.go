@@ -0,0 +1,118 @@
+package model
+
+import "database/sql"
+
+// sqliteIndexChirp replaces the search index entries for a chirp.
+func sqliteIndexChirp(tx *sql.Tx, id int, body string) error {
+	if _, err := tx.Exec("DELETE FROM chirp_terms WHERE chirp_id = ?", id); err != nil {
+		return err
+	}
+
+	tokens := tokenize(body)
+	for pos, term := range tokens {
+		_, err := tx.Exec("INSERT INTO chirp_terms (term, chirp_id, position) VALUES (?, ?, ?)", term, id, pos)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec("UPDATE chirps SET term_count = ? WHERE id = ?", len(tokens), id)
+	return err
+}
+
+func backfillSearchIndex(tx *sql.Tx) error {
+	rows, err := tx.Query("SELECT id, body FROM chirps")
+	if err != nil {
+		return err
+	}
+	bodies := map[int]string{}
+	for rows.Next() {
+		var id int
+		var body string
+		if err := rows.Scan(&id, &body); err != nil {
+			rows.Close()
+			return err
+		}
+		bodies[id] = body
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for id, body := range bodies {
+		if err := sqliteIndexChirp(tx, id, body); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *SQLiteDB) SearchChirps(q SearchQuery) ([]Chirp, error) {
+	parsed, err := parseSearchQuery(q.Text)
+	if err != nil {
+		return nil, err
+	}
+
+	var n int
+	var avgLength float64
+	err = s.db.QueryRow("SELECT COUNT(*), COALESCE(AVG(term_count), 0) FROM chirps").Scan(&n, &avgLength)
+	if err != nil {
+		return nil, err
+	}
+
+	placeholders := sqlPlaceholders(len(parsed.terms))
+	args := make([]interface{}, 0, len(parsed.terms))
+	for _, term := range parsed.terms {
+		args = append(args, term)
+	}
+	rows, err := s.db.Query(`SELECT t.term, t.chirp_id, t.position, c.term_count, c.author_id
+		FROM chirp_terms t JOIN chirps c ON c.id = t.chirp_id
+		WHERE t.term IN (`+placeholders+`) AND c.deleted_at IS NULL AND c.hidden = 0`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	terms := postings{}
+	lengths := map[int]int{}
+	authors := map[int]int{}
+	for rows.Next() {
+		var term string
+		var id, pos, length, authorID int
+		if err := rows.Scan(&term, &id, &pos, &length, &authorID); err != nil {
+			return nil, err
+		}
+		if terms[term] == nil {
+			terms[term] = map[int][]int{}
+		}
+		terms[term][id] = append(terms[term][id], pos)
+		lengths[id] = length
+		authors[id] = authorID
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	chirps := []Chirp{}
+	skipped := 0
+	for _, result := range rank(parsed, terms, lengths, n, avgLength) {
+		if q.Limit > 0 && len(chirps) == q.Limit {
+			break
+		}
+		if q.AuthorID != nil && authors[result.id] != *q.AuthorID {
+			continue
+		}
+		if skipped < q.Offset {
+			skipped++
+			continue
+		}
+		chirp, err := s.GetChirp(result.id)
+		if err != nil {
+			return nil, err
+		}
+		chirps = append(chirps, chirp)
+	}
+	return chirps, nil
+}
@@ -0,0 +1,202 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+const sqliteSessionColumns = "id, user_id, device, created_at, last_used_at, expires_at"
+
+func scanSession(row interface{ Scan(...interface{}) error }) (Session, error) {
+	session := Session{}
+	err := row.Scan(
+		&session.ID, &session.UserID, &session.Device,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt,
+	)
+	return session, err
+}
+
+func (s *SQLiteDB) CreateSession(userID int, device string, tokenHash string, expiresAt time.Time) (Session, error) {
+	now := time.Now().UTC()
+	session := Session{
+		UserID:     userID,
+		Device:     device,
+		CreatedAt:  now,
+		LastUsedAt: now,
+		ExpiresAt:  expiresAt.UTC(),
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		"INSERT INTO sessions (user_id, device, created_at, last_used_at, expires_at) VALUES (?, ?, ?, ?, ?)",
+		userID, device, sqliteTime(now), sqliteTime(now), sqliteTime(session.ExpiresAt),
+	)
+	if err != nil {
+		return Session{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return Session{}, err
+	}
+	session.ID = int(id)
+
+	_, err = tx.Exec(
+		"INSERT INTO refresh_tokens (hash, session_id, expires_at) VALUES (?, ?, ?)",
+		tokenHash, session.ID, sqliteTime(session.ExpiresAt),
+	)
+	if err != nil {
+		return Session{}, err
+	}
+	return session, tx.Commit()
+}
+
+func (s *SQLiteDB) RefreshSession(oldHash string, newHash string, now time.Time, expiresAt time.Time) (Session, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return Session{}, err
+	}
+	defer tx.Rollback()
+
+	var sessionID int
+	var rotatedAt sql.NullTime
+	err = tx.QueryRow(
+		"SELECT session_id, rotated_at FROM refresh_tokens WHERE hash = ? AND expires_at > ?",
+		oldHash, sqliteTime(now),
+	).Scan(&sessionID, &rotatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, err
+	}
+
+	if rotatedAt.Valid {
+		// The session's tokens go with it through ON DELETE CASCADE.
+		if _, err := tx.Exec("DELETE FROM sessions WHERE id = ?", sessionID); err != nil {
+			return Session{}, err
+		}
+		if err := tx.Commit(); err != nil {
+			return Session{}, err
+		}
+		return Session{}, ErrRefreshTokenReused
+	}
+
+	_, err = tx.Exec("UPDATE refresh_tokens SET rotated_at = ? WHERE hash = ?", sqliteTime(now), oldHash)
+	if err != nil {
+		return Session{}, err
+	}
+	_, err = tx.Exec(
+		"UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE id = ?",
+		sqliteTime(now), sqliteTime(expiresAt), sessionID,
+	)
+	if err != nil {
+		return Session{}, err
+	}
+	_, err = tx.Exec(
+		"INSERT INTO refresh_tokens (hash, session_id, expires_at) VALUES (?, ?, ?)",
+		newHash, sessionID, sqliteTime(expiresAt),
+	)
+	if err != nil {
+		return Session{}, err
+	}
+
+	session, err := scanSession(tx.QueryRow("SELECT "+sqliteSessionColumns+" FROM sessions WHERE id = ?", sessionID))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return Session{}, err
+	}
+	return session, tx.Commit()
+}
+
+func (s *SQLiteDB) GetSession(id int) (Session, error) {
+	session, err := scanSession(s.db.QueryRow("SELECT "+sqliteSessionColumns+" FROM sessions WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Session{}, fmt.Errorf("Session ID %d not found", id)
+	}
+	return session, err
+}
+
+func (s *SQLiteDB) GetSessions(userID int, now time.Time) ([]Session, error) {
+	rows, err := s.db.Query(
+		"SELECT "+sqliteSessionColumns+" FROM sessions WHERE user_id = ? AND expires_at > ? "+
+			"ORDER BY last_used_at DESC, id DESC",
+		userID, sqliteTime(now),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []Session{}
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions, rows.Err()
+}
+
+func (s *SQLiteDB) DeleteSession(id int) error {
+	result, err := s.db.Exec("DELETE FROM sessions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("Session ID %d not found", id)
+	}
+	return nil
+}
+
+func (s *SQLiteDB) DeleteSessionByToken(tokenHash string) error {
+	result, err := s.db.Exec(
+		"DELETE FROM sessions WHERE id = (SELECT session_id FROM refresh_tokens WHERE hash = ?)",
+		tokenHash,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrInvalidRefreshToken
+	}
+	return nil
+}
+
+func (s *SQLiteDB) PruneSessions(now time.Time) (int, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec("DELETE FROM sessions WHERE expires_at <= ?", sqliteTime(now))
+	if err != nil {
+		return 0, err
+	}
+	pruned, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM refresh_tokens WHERE expires_at <= ?", sqliteTime(now)); err != nil {
+		return 0, err
+	}
+	return int(pruned), tx.Commit()
+}
@@ -0,0 +1,44 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+func (s *SQLiteDB) GetThread(id int) (Thread, error) {
+	chirp, err := s.getChirpOrTombstone(id)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	ancestors := []Chirp{}
+	for parentID := chirp.InReplyToID; parentID != 0; {
+		parent, err := s.getChirpOrTombstone(parentID)
+		if err != nil {
+			return Thread{}, err
+		}
+		ancestors = append([]Chirp{parent}, ancestors...)
+		parentID = parent.InReplyToID
+	}
+
+	descendants, err := s.queryChirps(`WITH RECURSIVE thread(id) AS (
+			SELECT id FROM chirps WHERE in_reply_to_id = ?
+			UNION ALL
+			SELECT c.id FROM chirps c JOIN thread t ON c.in_reply_to_id = t.id
+		)
+		SELECT `+sqliteChirpColumns+` FROM chirps WHERE id IN (SELECT id FROM thread) ORDER BY id`, id)
+	if err != nil {
+		return Thread{}, err
+	}
+
+	return newThread(ancestors, chirp, descendants), nil
+}
+
+func (s *SQLiteDB) getChirpOrTombstone(id int) (Chirp, error) {
+	chirp, err := scanChirp(s.db.QueryRow("SELECT "+sqliteChirpColumns+" FROM chirps WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return Chirp{}, fmt.Errorf("Chirp ID %d not found", id)
+	}
+	return chirp, err
+}
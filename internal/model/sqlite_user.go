@@ -0,0 +1,169 @@
+package model
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+)
+
+const sqliteUserColumns = "users.id, users.email, users.password, users.is_chirpy_red, users.handle, users.is_admin"
+
+func scanUser(row interface{ Scan(...interface{}) error }) (User, error) {
+	user := User{}
+	var handle sql.NullString
+	err := row.Scan(&user.ID, &user.Email, &user.Password, &user.IsChirpyRed, &handle, &user.IsAdmin)
+	user.Handle = handle.String
+	return user, err
+}
+
+func (s *SQLiteDB) AuthenticateUser(email string, password string) (User, error) {
+	errMsg := "Invalid email address or password"
+	row := s.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE email = ?", email)
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, errors.New(errMsg)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if !doPasswordsMatch(user.Password, password) {
+		return User{}, errors.New(errMsg)
+	}
+
+	return user, nil
+}
+
+func (s *SQLiteDB) GetUser(id int) (User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", id))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("unable to fetch user with ID %d", id)
+	}
+	return user, err
+}
+
+func (s *SQLiteDB) GetUserByHandle(handle string) (User, error) {
+	user, err := scanUser(s.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE handle = ? COLLATE NOCASE", handle))
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("unable to fetch user with handle %q", handle)
+	}
+	return user, err
+}
+
+func (s *SQLiteDB) CreateUser(email string, password string) (User, error) {
+	row := s.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE email = ?", email)
+	user, err := scanUser(row)
+	if err == nil {
+		return user, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return User{}, err
+	}
+
+	hashedPassword, err := hashPassword(password)
+	if err != nil {
+		log.Printf("Error hashing password: %s\n", err)
+		return User{}, err
+	}
+
+	result, err := s.db.Exec("INSERT INTO users (email, password) VALUES (?, ?)", email, hashedPassword)
+	if err != nil {
+		return User{}, err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return User{}, err
+	}
+
+	user = User{
+		ID:          int(id),
+		Email:       email,
+		Password:    hashedPassword,
+		IsChirpyRed: false,
+	}
+	return user, nil
+}
+
+func (s *SQLiteDB) UpdateUser(id int, email string, password string, handle string, isChirpyRed *bool) (User, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return User{}, err
+	}
+	defer tx.Rollback()
+
+	row := tx.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE id = ?", id)
+	user, err := scanUser(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return User{}, fmt.Errorf("unable to fetch user with ID %d", id)
+	}
+	if err != nil {
+		return User{}, err
+	}
+
+	if email != "" && email != user.Email {
+		var takenBy int
+		err := tx.QueryRow("SELECT id FROM users WHERE email = ?", email).Scan(&takenBy)
+		if err == nil {
+			return User{}, ErrEmailTaken
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return User{}, err
+		}
+		user.Email = email
+	}
+
+	if handle != "" && !strings.EqualFold(handle, user.Handle) {
+		var takenBy int
+		err := tx.QueryRow("SELECT id FROM users WHERE handle = ? COLLATE NOCASE", handle).Scan(&takenBy)
+		if err == nil {
+			return User{}, ErrHandleTaken
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return User{}, err
+		}
+	}
+	if handle != "" {
+		user.Handle = handle
+	}
+
+	if password != "" {
+		hashedPassword, err := hashPassword(password)
+		if err != nil {
+			log.Printf("Error hashing password: %s\n", err)
+			return User{}, err
+		}
+		user.Password = hashedPassword
+	}
+
+	if isChirpyRed != nil {
+		user.IsChirpyRed = *isChirpyRed
+	}
+
+	_, err = tx.Exec(
+		"UPDATE users SET email = ?, password = ?, is_chirpy_red = ?, handle = ? WHERE id = ?",
+		user.Email, user.Password, user.IsChirpyRed, sql.NullString{String: user.Handle, Valid: user.Handle != ""}, id,
+	)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, tx.Commit()
+}
+
+func (s *SQLiteDB) SetUserAdmin(email string, isAdmin bool) (User, error) {
+	result, err := s.db.Exec("UPDATE users SET is_admin = ? WHERE email = ?", isAdmin, email)
+	if err != nil {
+		return User{}, err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return User{}, err
+	}
+	if n == 0 {
+		return User{}, fmt.Errorf("no user with email %s", email)
+	}
+
+	return scanUser(s.db.QueryRow("SELECT "+sqliteUserColumns+" FROM users WHERE email = ?", email))
+}
@@ -0,0 +1,80 @@
+package model
+
+import "time"
+
+// Store is the persistence layer used by the API handlers. The JSON file
+// database (DB) and the SQLite database (SQLiteDB) both implement it.
+type Store interface {
+	CreateChirp(params ChirpParams) (Chirp, error)
+	DeleteChirp(id int) error
+	GetDeletedChirp(id int) (Chirp, error)
+	RestoreChirp(id int) (Chirp, error)
+	PurgeDeletedChirps(cutoff time.Time) (int, error)
+	GetChirp(id int) (Chirp, error)
+	GetChirps(q ChirpQuery) ([]Chirp, error)
+	UpdateChirp(id int, body string, flagged bool) (Chirp, error)
+	GetChirpHistory(id int) ([]ChirpRevision, error)
+	SetChirpPreview(id int, preview LinkPreview) error
+	SearchChirps(q SearchQuery) ([]Chirp, error)
+	GetThread(id int) (Thread, error)
+	GetChirpsByTag(tag string, q ChirpQuery) ([]Chirp, error)
+	GetMentions(userID int, q ChirpQuery) ([]Chirp, error)
+	GetTrendingTags(since time.Time, limit int) ([]TagCount, error)
+
+	CreatePendingChirp(pending PendingChirp) (PendingChirp, error)
+	GetPendingChirp(id int) (PendingChirp, error)
+	GetPendingChirps(authorID int) ([]PendingChirp, error)
+	UpdatePendingChirp(pending PendingChirp) (PendingChirp, error)
+	DeletePendingChirp(id int) error
+	PublishDueChirps(now time.Time) ([]Chirp, error)
+
+	CreateMedia(media Media) (Media, error)
+	PruneMedia(cutoff time.Time) ([]Media, error)
+
+	LikeChirp(chirpID int, userID int) (Chirp, error)
+	UnlikeChirp(chirpID int, userID int) (Chirp, error)
+	Rechirp(chirpID int, userID int) (Chirp, error)
+	UndoRechirp(chirpID int, userID int) (Chirp, error)
+	GetLikedChirps(userID int, chirpIDs []int) (map[int]bool, error)
+
+	ReportChirp(chirpID int, reporterID int, reason string) (Report, error)
+	GetReviewQueue() ([]ReviewItem, error)
+	ReviewChirp(chirpID int, moderatorID int, action ReviewAction, note string) (AuditEntry, error)
+	GetAuditLog() ([]AuditEntry, error)
+
+	AuthenticateUser(email string, password string) (User, error)
+	GetUser(id int) (User, error)
+	GetUserByHandle(handle string) (User, error)
+	CreateUser(email string, password string) (User, error)
+	UpdateUser(id int, email string, password string, handle string, isChirpyRed *bool) (User, error)
+	SetUserAdmin(email string, isAdmin bool) (User, error)
+	SignInExternalUser(issuer string, subject string, email string) (User, error)
+
+	FollowUser(followerID int, followeeID int) error
+	UnfollowUser(followerID int, followeeID int) error
+	GetFollowers(userID int) ([]User, error)
+	GetFollowing(userID int) ([]User, error)
+	GetTimeline(userID int, q ChirpQuery) ([]Chirp, error)
+
+	CreateSession(userID int, device string, tokenHash string, expiresAt time.Time) (Session, error)
+	RefreshSession(oldHash string, newHash string, now time.Time, expiresAt time.Time) (Session, error)
+	GetSession(id int) (Session, error)
+	GetSessions(userID int, now time.Time) ([]Session, error)
+	DeleteSession(id int) error
+	DeleteSessionByToken(tokenHash string) error
+	PruneSessions(now time.Time) (int, error)
+
+	CreateOAuthClient(client OAuthClient) (OAuthClient, error)
+	GetOAuthClient(id string) (OAuthClient, error)
+	GetOAuthClients() ([]OAuthClient, error)
+	DeleteOAuthClient(id string) error
+	CreateAuthorizationCode(code AuthorizationCode, now time.Time) error
+	ConsumeAuthorizationCode(hash string, now time.Time) (AuthorizationCode, error)
+
+	Close() error
+}
+
+var (
+	_ Store = (*DB)(nil)
+	_ Store = (*SQLiteDB)(nil)
+)
@@ -0,0 +1,237 @@
+package model
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+// testStores runs fn against a fresh database of each Store implementation,
+// so both backends are held to the same behaviour.
+func testStores(t *testing.T, fn func(t *testing.T, store Store)) {
+	t.Helper()
+	t.Run("json", func(t *testing.T) {
+		db, err := NewDB(filepath.Join(t.TempDir(), "database.json"), DBConfig{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+	t.Run("sqlite", func(t *testing.T) {
+		db, err := NewSQLiteDB(filepath.Join(t.TempDir(), "database.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+		fn(t, db)
+	})
+}
+
+func mustCreateUser(t *testing.T, store Store, email string) User {
+	t.Helper()
+	user, err := store.CreateUser(email, "password")
+	if err != nil {
+		t.Fatalf("CreateUser(%q): %s", email, err)
+	}
+	return user
+}
+
+func TestStoreCreateUser(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+		if alice.ID == bob.ID {
+			t.Fatalf("users got the same ID %d", alice.ID)
+		}
+
+		again, err := store.CreateUser("alice@example.com", "other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.ID != alice.ID {
+			t.Errorf("CreateUser with a known email returned user %d, want %d", again.ID, alice.ID)
+		}
+
+		if _, err := store.AuthenticateUser("alice@example.com", "password"); err != nil {
+			t.Errorf("AuthenticateUser with the right password: %s", err)
+		}
+		if _, err := store.AuthenticateUser("alice@example.com", "other"); err == nil {
+			t.Error("AuthenticateUser with the wrong password succeeded")
+		}
+		if _, err := store.AuthenticateUser("carol@example.com", "password"); err == nil {
+			t.Error("AuthenticateUser for an unknown email succeeded")
+		}
+	})
+}
+
+func TestStoreUpdateUserEmail(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+
+		_, err := store.UpdateUser(bob.ID, "alice@example.com", "", "", nil)
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("UpdateUser to a taken email: got %v, want ErrEmailTaken", err)
+		}
+		if _, err := store.AuthenticateUser("alice@example.com", "password"); err != nil {
+			t.Fatalf("alice can't log in after the refused update: %s", err)
+		}
+
+		// Keeping one's own email is not a conflict.
+		if _, err := store.UpdateUser(alice.ID, "alice@example.com", "", "", nil); err != nil {
+			t.Fatalf("UpdateUser to the same email: %s", err)
+		}
+
+		updated, err := store.UpdateUser(alice.ID, "alice@example.org", "", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Email != "alice@example.org" {
+			t.Errorf("Email = %q, want alice@example.org", updated.Email)
+		}
+		if _, err := store.AuthenticateUser("alice@example.com", "password"); err == nil {
+			t.Error("the old email still logs in")
+		}
+		if user, err := store.AuthenticateUser("alice@example.org", "password"); err != nil || user.ID != alice.ID {
+			t.Errorf("the new email doesn't log in as alice: %v", err)
+		}
+
+		// The old email is free for someone else.
+		carol := mustCreateUser(t, store, "alice@example.com")
+		if carol.ID == alice.ID {
+			t.Error("the old email still belongs to alice")
+		}
+	})
+}
+
+func TestStoreUpdateUserHandle(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+
+		if _, err := store.UpdateUser(alice.ID, "", "", "Alice", nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.UpdateUser(bob.ID, "", "", "alice", nil); !errors.Is(err, ErrHandleTaken) {
+			t.Fatalf("UpdateUser to a taken handle: got %v, want ErrHandleTaken", err)
+		}
+		user, err := store.GetUserByHandle("ALICE")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.ID != alice.ID {
+			t.Errorf("GetUserByHandle returned user %d, want %d", user.ID, alice.ID)
+		}
+
+		red := true
+		user, err = store.UpdateUser(alice.ID, "", "", "", &red)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !user.IsChirpyRed || user.Handle != "Alice" || user.Email != "alice@example.com" {
+			t.Errorf("UpdateUser changed fields it wasn't given: %+v", user)
+		}
+	})
+}
+
+func TestStoreUpdateUserRejectedKeepsHandle(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		mustCreateUser(t, store, "bob@example.com")
+		if _, err := store.UpdateUser(alice.ID, "", "", "alice", nil); err != nil {
+			t.Fatal(err)
+		}
+
+		// The email is taken, so the new handle mustn't be applied either.
+		_, err := store.UpdateUser(alice.ID, "bob@example.com", "", "ally", nil)
+		if !errors.Is(err, ErrEmailTaken) {
+			t.Fatalf("UpdateUser to a taken email: got %v, want ErrEmailTaken", err)
+		}
+		if user, err := store.GetUserByHandle("alice"); err != nil || user.ID != alice.ID {
+			t.Errorf("GetUserByHandle(alice) = %+v, %v", user, err)
+		}
+		if _, err := store.GetUserByHandle("ally"); err == nil {
+			t.Error("the handle of the rejected update was taken")
+		}
+		carol := mustCreateUser(t, store, "carol@example.com")
+		if _, err := store.UpdateUser(carol.ID, "", "", "ally", nil); err != nil {
+			t.Errorf("the handle of the rejected update isn't free: %s", err)
+		}
+	})
+}
+
+func TestStoreChirps(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+
+		chirp, err := store.CreateChirp(ChirpParams{Body: "hello #world", AuthorID: alice.ID})
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := store.GetChirp(chirp.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Body != "hello #world" || got.AuthorID != alice.ID {
+			t.Errorf("GetChirp = %+v", got)
+		}
+		if len(got.Tags) != 1 || got.Tags[0] != "world" {
+			t.Errorf("Tags = %v, want [world]", got.Tags)
+		}
+
+		if _, err := store.CreateChirp(ChirpParams{Body: "reply", AuthorID: alice.ID, InReplyToID: chirp.ID + 100}); err == nil {
+			t.Error("CreateChirp replying to a missing chirp succeeded")
+		}
+
+		if err := store.DeleteChirp(chirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetChirp(chirp.ID); err == nil {
+			t.Error("GetChirp found a deleted chirp")
+		}
+		if _, err := store.RestoreChirp(chirp.ID); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := store.GetChirp(chirp.ID); err != nil {
+			t.Errorf("GetChirp after restoring: %s", err)
+		}
+	})
+}
+
+func TestStoreFollows(t *testing.T) {
+	testStores(t, func(t *testing.T, store Store) {
+		alice := mustCreateUser(t, store, "alice@example.com")
+		bob := mustCreateUser(t, store, "bob@example.com")
+
+		if err := store.FollowUser(alice.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		// Following twice is not an error.
+		if err := store.FollowUser(alice.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.FollowUser(alice.ID, bob.ID+100); err == nil {
+			t.Error("FollowUser of a missing user succeeded")
+		}
+
+		followers, err := store.GetFollowers(bob.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(followers) != 1 || followers[0].ID != alice.ID {
+			t.Errorf("GetFollowers = %+v, want alice", followers)
+		}
+
+		if err := store.UnfollowUser(alice.ID, bob.ID); err != nil {
+			t.Fatal(err)
+		}
+		following, err := store.GetFollowing(alice.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(following) != 0 {
+			t.Errorf("GetFollowing after unfollowing = %+v", following)
+		}
+	})
+}
@@ -0,0 +1,94 @@
+package model
+
+import "fmt"
+
+// Thread is the conversation around a chirp.
+type Thread struct {
+	// Ancestors lists the chirps the requested chirp replies to, starting
+	// from the root of the conversation.
+	Ancestors []Chirp
+	// Root is the requested chirp with all replies below it.
+	Root ThreadNode
+}
+
+// ThreadNode is a chirp and the replies to it, oldest first.
+type ThreadNode struct {
+	Chirp   Chirp
+	Replies []ThreadNode
+}
+
+// GetThread returns the conversation around a chirp. Deleted chirps and
+// tombstones are included so the thread stays connected.
+func (db *DB) GetThread(id int) (Thread, error) {
+	thread := Thread{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		chirp, ok := dbStructure.Chirps[id]
+		if !ok {
+			return fmt.Errorf("Chirp ID %d not found", id)
+		}
+
+		ancestors := []Chirp{}
+		for parentID := chirp.InReplyToID; parentID != 0; {
+			parent := dbStructure.Chirps[parentID]
+			ancestors = append([]Chirp{parent}, ancestors...)
+			parentID = parent.InReplyToID
+		}
+
+		descendants := []Chirp{}
+		queue := append([]int{}, dbStructure.index.replies[id]...)
+		for len(queue) > 0 {
+			reply := dbStructure.Chirps[queue[0]]
+			queue = append(queue[1:], dbStructure.index.replies[reply.ID]...)
+			descendants = append(descendants, reply)
+		}
+
+		thread = newThread(ancestors, chirp, descendants)
+		return nil
+	})
+	return thread, err
+}
+
+// newThread builds the thread for root. Deleted chirps and chirps hidden by
+// a moderator keep their place in it, but without their content.
+func newThread(ancestors []Chirp, root Chirp, descendants []Chirp) Thread {
+	for i := range ancestors {
+		ancestors[i] = redact(ancestors[i])
+	}
+	return Thread{
+		Ancestors: ancestors,
+		Root:      buildThreadTree(root, descendants),
+	}
+}
+
+func redact(chirp Chirp) Chirp {
+	if !chirp.Hidden && chirp.DeletedAt == nil {
+		return chirp
+	}
+	return Chirp{
+		ID:          chirp.ID,
+		AuthorID:    chirp.AuthorID,
+		CreatedAt:   chirp.CreatedAt,
+		UpdatedAt:   chirp.UpdatedAt,
+		InReplyToID: chirp.InReplyToID,
+		Hidden:      chirp.Hidden,
+		DeletedAt:   chirp.DeletedAt,
+	}
+}
+
+// buildThreadTree arranges the descendants of root into a tree.
+func buildThreadTree(root Chirp, descendants []Chirp) ThreadNode {
+	children := map[int][]Chirp{}
+	for _, chirp := range descendants {
+		children[chirp.InReplyToID] = append(children[chirp.InReplyToID], chirp)
+	}
+
+	var build func(chirp Chirp) ThreadNode
+	build = func(chirp Chirp) ThreadNode {
+		node := ThreadNode{Chirp: redact(chirp), Replies: []ThreadNode{}}
+		for _, child := range children[chirp.ID] {
+			node.Replies = append(node.Replies, build(child))
+		}
+		return node
+	}
+	return build(root)
+}
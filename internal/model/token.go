@@ -1,58 +1,190 @@
 package model
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/christopherplain/chirpy/internal/keys"
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func (db *DB) IsTokenRevoked(token string) (bool, error) {
-	dbStructure, err := db.loadDB()
+const (
+	accessIssuer = "chirpy-access"
+	// tokenAudience is the audience of the tokens the API accepts.
+	tokenAudience = "chirpy-api"
+	// AccessTokenTTL is how long access tokens are valid for.
+	AccessTokenTTL = time.Hour
+	// idTokenTTL is how long ID tokens are valid for. Clients check them
+	// once, right after sign-in.
+	idTokenTTL = 10 * time.Minute
+	// loginStateAudience is the audience, and issuer, of login state tokens.
+	loginStateAudience = "chirpy-login-state"
+)
+
+// TokenClaims are the claims of the access tokens Chirpy issues.
+type TokenClaims struct {
+	jwt.RegisteredClaims
+	// Scope is the space-separated list of scopes a delegated token is
+	// limited to. Tokens issued at login have none and are unrestricted.
+	Scope string `json:"scope,omitempty"`
+	// SessionID is the session the token was issued for.
+	SessionID int `json:"sid,omitempty"`
+	// ClientID is the OAuth client a delegated token was issued to.
+	ClientID string `json:"client_id,omitempty"`
+}
+
+// Scopes splits Scope into its scopes.
+func (c TokenClaims) Scopes() []string {
+	return strings.Fields(c.Scope)
+}
+
+// UserID parses the subject of the token as a user ID.
+func (c TokenClaims) UserID() (int, error) {
+	return strconv.Atoi(c.Subject)
+}
+
+// newAccessClaims returns the claims every access token for user id has.
+func newAccessClaims(id int) (TokenClaims, error) {
+	tokenID := make([]byte, 16)
+	if _, err := rand.Read(tokenID); err != nil {
+		return TokenClaims{}, err
+	}
+	now := time.Now()
+	return TokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        hex.EncodeToString(tokenID),
+			Issuer:    accessIssuer,
+			Audience:  jwt.ClaimStrings{tokenAudience},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(AccessTokenTTL)),
+			Subject:   strconv.Itoa(id),
+		},
+	}, nil
+}
+
+// GenerateAccessToken issues a short-lived access token to user id, signed
+// in with the session sessionID.
+func GenerateAccessToken(ring *keys.Ring, id int, sessionID int) (string, error) {
+	claims, err := newAccessClaims(id)
 	if err != nil {
-		return false, err
+		return "", err
 	}
-	if _, ok := dbStructure.RevokedTokens[token]; ok {
-		return true, nil
+	claims.SessionID = sessionID
+	return ring.Sign(claims)
+}
+
+// GenerateDelegatedToken issues a short-lived access token that lets the
+// OAuth client clientID act for user id within scope.
+func GenerateDelegatedToken(ring *keys.Ring, id int, clientID string, scope string) (string, error) {
+	claims, err := newAccessClaims(id)
+	if err != nil {
+		return "", err
 	}
-	return false, nil
+	claims.Scope = scope
+	claims.ClientID = clientID
+	return ring.Sign(claims)
 }
 
-func (db *DB) RevokeToken(token string) error {
-	dbStructure, err := db.loadDB()
+// ValidateAccessToken checks the signature, expiry, issuer and audience of
+// an access token and returns its claims.
+func ValidateAccessToken(token string, ring *keys.Ring) (TokenClaims, error) {
+	claims := TokenClaims{}
+	_, err := jwt.ParseWithClaims(token, &claims, ring.Keyfunc,
+		jwt.WithValidMethods(ring.Methods()),
+		jwt.WithIssuer(accessIssuer),
+		jwt.WithAudience(tokenAudience),
+	)
 	if err != nil {
-		return err
+		return TokenClaims{}, err
+	}
+	return claims, nil
+}
+
+// UserClaims are the OpenID Connect claims about a user that the profile and
+// email scopes release.
+type UserClaims struct {
+	Email             string `json:"email,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// NewUserClaims returns the claims about user that scopes allow a client
+// to see.
+func NewUserClaims(user User, scopes []string) UserClaims {
+	claims := UserClaims{}
+	for _, scope := range scopes {
+		switch scope {
+		case ScopeEmail:
+			claims.Email = user.Email
+		case ScopeProfile:
+			claims.PreferredUsername = user.Handle
+		}
 	}
-	dbStructure.RevokedTokens[token] = time.Now().String()
-	return db.writeDB(dbStructure)
+	return claims
+}
+
+// IDTokenClaims are the claims of the OpenID Connect ID tokens Chirpy
+// issues to OAuth clients.
+type IDTokenClaims struct {
+	jwt.RegisteredClaims
+	UserClaims
+	Nonce    string           `json:"nonce,omitempty"`
+	AuthTime *jwt.NumericDate `json:"auth_time,omitempty"`
 }
 
-func GenerateAccessToken(secret string, id int) (string, error) {
-	issuer := "chirpy-access"
-	expires := time.Duration(1 * time.Hour)
-	return generateJWT(secret, issuer, expires, id)
+// GenerateIDToken issues the ID token telling the client code was issued to
+// which user signed in. issuer is the URL Chirpy is reached at.
+func GenerateIDToken(ring *keys.Ring, issuer string, user User, code AuthorizationCode) (string, error) {
+	now := time.Now()
+	claims := IDTokenClaims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    issuer,
+			Audience:  jwt.ClaimStrings{code.ClientID},
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(now.Add(idTokenTTL)),
+			Subject:   strconv.Itoa(user.ID),
+		},
+		UserClaims: NewUserClaims(user, strings.Fields(code.Scope)),
+		Nonce:      code.Nonce,
+		AuthTime:   jwt.NewNumericDate(code.AuthTime),
+	}
+	return ring.Sign(claims)
 }
 
-func GenerateRefreshToken(secret string, id int) (string, error) {
-	issuer := "chirpy-refresh"
-	expires := time.Duration(1440 * time.Hour)
-	return generateJWT(secret, issuer, expires, id)
+// LoginState is what Chirpy remembers about a sign-in with an external
+// provider between sending the user there and their coming back.
+type LoginState struct {
+	jwt.RegisteredClaims
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
 }
 
-func ValidateJWT(token string, secret string) (*jwt.Token, error) {
-	claims := &jwt.RegisteredClaims{}
-	return jwt.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	})
+// GenerateLoginStateToken signs state so it can be kept by the browser for
+// ttl. Login state tokens aren't accepted as access tokens.
+func GenerateLoginStateToken(ring *keys.Ring, state LoginState, ttl time.Duration) (string, error) {
+	now := time.Now()
+	state.RegisteredClaims = jwt.RegisteredClaims{
+		Issuer:    loginStateAudience,
+		Audience:  jwt.ClaimStrings{loginStateAudience},
+		IssuedAt:  jwt.NewNumericDate(now),
+		ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+	}
+	return ring.Sign(state)
 }
 
-func generateJWT(secret string, issuer string, expires time.Duration, id int) (string, error) {
-	claims := jwt.RegisteredClaims{
-		Issuer:    issuer,
-		IssuedAt:  jwt.NewNumericDate(time.Now()),
-		ExpiresAt: jwt.NewNumericDate(time.Now().Add(expires)),
-		Subject:   strconv.Itoa(id),
+// ValidateLoginStateToken checks a login state token and returns the state.
+func ValidateLoginStateToken(token string, ring *keys.Ring) (LoginState, error) {
+	state := LoginState{}
+	_, err := jwt.ParseWithClaims(token, &state, ring.Keyfunc,
+		jwt.WithValidMethods(ring.Methods()),
+		jwt.WithIssuer(loginStateAudience),
+		jwt.WithAudience(loginStateAudience),
+	)
+	if err != nil {
+		return LoginState{}, err
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString([]byte(secret))
+	return state, nil
 }
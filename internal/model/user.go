@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"strings"
 
 	"golang.org/x/crypto/bcrypt"
 )
@@ -13,55 +14,91 @@ type User struct {
 	Email       string `json:"email"`
 	Password    string `json:"password"`
 	IsChirpyRed bool   `json:"is_chirpy_red"`
+	// Handle is the optional name the user can be @mentioned by. Handles
+	// are unique ignoring case.
+	Handle string `json:"handle,omitempty"`
+	// IsAdmin lets the user review reported chirps.
+	IsAdmin bool `json:"is_admin,omitempty"`
 }
 
+var ErrHandleTaken = errors.New("handle is already taken")
+
+var ErrEmailTaken = errors.New("email is already taken")
+
 func (db *DB) AuthenticateUser(email string, password string) (User, error) {
-	dbStructure, err := db.loadDB()
+	user := User{}
+	found := false
+	err := db.View(func(dbStructure *dbStructure) error {
+		id, ok := dbStructure.UsersEmailToID[email]
+		if ok {
+			user, found = dbStructure.Users[id]
+		}
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
 	errMsg := "Invalid email address or password"
-	id, ok := dbStructure.UsersEmailToID[email]
-	if !ok {
-		return User{}, errors.New(errMsg)
-	}
-	user := dbStructure.Users[id]
-
-	if !doPasswordsMatch(user.Password, password) {
+	if !found || !doPasswordsMatch(user.Password, password) {
 		return User{}, errors.New(errMsg)
 	}
 
 	return user, nil
 }
 
-func (db *DB) CreateUser(email string, password string) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
+func (db *DB) GetUser(id int) (User, error) {
+	user := User{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		u, ok := dbStructure.Users[id]
+		if !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", id)
+		}
+		user = u
+		return nil
+	})
+	return user, err
+}
 
-	if id, ok := dbStructure.UsersEmailToID[email]; ok {
-		return dbStructure.Users[id], nil
-	}
+// GetUserByHandle looks up a user by handle, ignoring case.
+func (db *DB) GetUserByHandle(handle string) (User, error) {
+	user := User{}
+	err := db.View(func(dbStructure *dbStructure) error {
+		id, ok := dbStructure.UsersHandleToID[strings.ToLower(handle)]
+		if !ok {
+			return fmt.Errorf("unable to fetch user with handle %q", handle)
+		}
+		user = dbStructure.Users[id]
+		return nil
+	})
+	return user, err
+}
 
+func (db *DB) CreateUser(email string, password string) (User, error) {
 	hashedPassword, err := hashPassword(password)
 	if err != nil {
 		log.Printf("Error hashing password: %s\n", err)
 		return User{}, err
 	}
 
-	id := len(dbStructure.Users) + 1
-	user := User{
-		ID:          id,
-		Email:       email,
-		Password:    hashedPassword,
-		IsChirpyRed: false,
-	}
-	dbStructure.Users[id] = user
-	dbStructure.UsersEmailToID[email] = id
+	user := User{}
+	err = db.Update(func(dbStructure *dbStructure) error {
+		if id, ok := dbStructure.UsersEmailToID[email]; ok {
+			user = dbStructure.Users[id]
+			return nil
+		}
 
-	err = db.writeDB(dbStructure)
+		id := dbStructure.nextID(userSequence)
+		user = User{
+			ID:          id,
+			Email:       email,
+			Password:    hashedPassword,
+			IsChirpyRed: false,
+		}
+		setKey(dbStructure, dbStructure.Users, id, user)
+		setKey(dbStructure, dbStructure.UsersEmailToID, email, id)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
@@ -69,48 +106,86 @@ func (db *DB) CreateUser(email string, password string) (User, error) {
 	return user, nil
 }
 
-func (db *DB) UpdateUser(id int, email string, password string, isChirpyRed *bool) (User, error) {
-	dbStructure, err := db.loadDB()
-	if err != nil {
-		return User{}, err
-	}
-
-	user, ok := dbStructure.Users[id]
-	if !ok {
-		return User{}, fmt.Errorf("unable to fetch user with ID %d", id)
-	}
-	updatedUser := User{
-		ID:          id,
-		Email:       user.Email,
-		Password:    user.Password,
-		IsChirpyRed: user.IsChirpyRed,
-	}
-
-	if email != "" {
-		updatedUser.Email = email
-		dbStructure.UsersEmailToID[email] = id
-	}
-
+func (db *DB) UpdateUser(id int, email string, password string, handle string, isChirpyRed *bool) (User, error) {
+	hashedPassword := ""
 	if password != "" {
-		hashedPassword, err := hashPassword(password)
+		var err error
+		hashedPassword, err = hashPassword(password)
 		if err != nil {
 			log.Printf("Error hashing password: %s\n", err)
 			return User{}, err
 		}
-		updatedUser.Password = hashedPassword
 	}
 
-	if isChirpyRed != nil {
-		updatedUser.IsChirpyRed = *isChirpyRed
-	}
+	updatedUser := User{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		user, ok := dbStructure.Users[id]
+		if !ok {
+			return fmt.Errorf("unable to fetch user with ID %d", id)
+		}
+		updatedUser = user
+
+		// Check everything before touching the indexes, so a rejected
+		// update leaves them as they were.
+		handleChanged := handle != "" && !strings.EqualFold(handle, user.Handle)
+		if handleChanged {
+			if _, ok := dbStructure.UsersHandleToID[strings.ToLower(handle)]; ok {
+				return ErrHandleTaken
+			}
+		}
+		emailChanged := email != "" && email != user.Email
+		if emailChanged {
+			if _, ok := dbStructure.UsersEmailToID[email]; ok {
+				return ErrEmailTaken
+			}
+		}
+
+		if handleChanged {
+			deleteKey(dbStructure, dbStructure.UsersHandleToID, strings.ToLower(user.Handle))
+			setKey(dbStructure, dbStructure.UsersHandleToID, strings.ToLower(handle), id)
+		}
+		if handle != "" {
+			updatedUser.Handle = handle
+		}
+
+		if emailChanged {
+			deleteKey(dbStructure, dbStructure.UsersEmailToID, user.Email)
+			setKey(dbStructure, dbStructure.UsersEmailToID, email, id)
+			updatedUser.Email = email
+		}
 
-	dbStructure.Users[id] = updatedUser
-	err = db.writeDB(dbStructure)
+		if hashedPassword != "" {
+			updatedUser.Password = hashedPassword
+		}
+
+		if isChirpyRed != nil {
+			updatedUser.IsChirpyRed = *isChirpyRed
+		}
+
+		setKey(dbStructure, dbStructure.Users, id, updatedUser)
+		return nil
+	})
 	if err != nil {
 		return User{}, err
 	}
 
-	return user, nil
+	return updatedUser, nil
+}
+
+// SetUserAdmin grants or revokes a user's admin rights.
+func (db *DB) SetUserAdmin(email string, isAdmin bool) (User, error) {
+	user := User{}
+	err := db.Update(func(dbStructure *dbStructure) error {
+		id, ok := dbStructure.UsersEmailToID[email]
+		if !ok {
+			return fmt.Errorf("no user with email %s", email)
+		}
+		user = dbStructure.Users[id]
+		user.IsAdmin = isAdmin
+		setKey(dbStructure, dbStructure.Users, id, user)
+		return nil
+	})
+	return user, err
 }
 
 func doPasswordsMatch(hashedPassword string, password string) bool {
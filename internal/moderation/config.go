@@ -0,0 +1,139 @@
+package moderation
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Config is the JSON moderation config file. Filters run in the order
+// listed, for example:
+//
+//	{
+//	  "filters": [
+//	    {"type": "words", "file": "banned.txt", "action": "reject"},
+//	    {"type": "words", "words": ["kerfuffle", "sharbert"], "action": "mask"},
+//	    {"type": "regex", "pattern": "(?i)buy now", "action": "flag"}
+//	  ]
+//	}
+type Config struct {
+	Filters []FilterConfig `json:"filters"`
+}
+
+// FilterConfig configures one filter. Type is "words", using Words and the
+// word list File (relative to the config file), or "regex", using Pattern.
+type FilterConfig struct {
+	Type    string   `json:"type"`
+	Action  string   `json:"action"`
+	Words   []string `json:"words"`
+	File    string   `json:"file"`
+	Pattern string   `json:"pattern"`
+}
+
+// Default is used when no config file is given. It masks the words Chirpy
+// has always masked.
+func Default() Moderator {
+	return Pipeline{NewWordList([]string{"kerfuffle", "sharbert", "fornax"}, ActionMask)}
+}
+
+// LoadConfig builds the pipeline described by the config file at path.
+func LoadConfig(path string) (Moderator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	config := Config{}
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	pipeline := Pipeline{}
+	for i, fc := range config.Filters {
+		m, err := fc.build(filepath.Dir(path))
+		if err != nil {
+			return nil, fmt.Errorf("%s: filter %d: %w", path, i, err)
+		}
+		pipeline = append(pipeline, m)
+	}
+	return pipeline, nil
+}
+
+func (fc FilterConfig) build(dir string) (Moderator, error) {
+	action, err := ParseAction(fc.Action)
+	if err != nil {
+		return nil, err
+	}
+
+	switch fc.Type {
+	case "words":
+		words := fc.Words
+		if fc.File != "" {
+			file := fc.File
+			if !filepath.IsAbs(file) {
+				file = filepath.Join(dir, file)
+			}
+			list, err := LoadWordList(file, action)
+			if err != nil {
+				return nil, err
+			}
+			if len(words) == 0 {
+				return list, nil
+			}
+			for word := range list.words {
+				words = append(words, word)
+			}
+		}
+		return NewWordList(words, action), nil
+	case "regex":
+		return NewRegexRule(fc.Pattern, action)
+	default:
+		return nil, fmt.Errorf("unknown filter type %q", fc.Type)
+	}
+}
+
+// Reloader is a Moderator backed by a config file that can be reloaded while
+// the server is running.
+type Reloader struct {
+	path string
+
+	mu        sync.RWMutex
+	moderator Moderator
+}
+
+// NewReloader loads the config file at path, or uses Default if path is
+// empty.
+func NewReloader(path string) (*Reloader, error) {
+	r := &Reloader{path: path, moderator: Default()}
+	if path == "" {
+		return r, nil
+	}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload rereads the config file. If it can't be loaded the previous
+// configuration stays in effect.
+func (r *Reloader) Reload() error {
+	if r.path == "" {
+		return nil
+	}
+	m, err := LoadConfig(r.path)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	r.moderator = m
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) Moderate(body string) Verdict {
+	r.mu.RLock()
+	m := r.moderator
+	r.mu.RUnlock()
+	return m.Moderate(body)
+}
@@ -0,0 +1,98 @@
+package moderation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeFile(t *testing.T, path string, data string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	dir := t.TempDir()
+	writeFile(t, filepath.Join(dir, "banned.txt"), "# banned words\n\nfornax\n  Grawlix  \n")
+	writeFile(t, filepath.Join(dir, "moderation.json"), `{
+		"filters": [
+			{"type": "words", "file": "banned.txt", "action": "reject"},
+			{"type": "words", "words": ["kerfuffle"], "action": "mask"},
+			{"type": "regex", "pattern": "(?i)buy now", "action": "flag"}
+		]
+	}`)
+
+	m, err := LoadConfig(filepath.Join(dir, "moderation.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		body string
+		want Verdict
+	}{
+		{"grawlix!", Verdict{Body: "grawlix!", Rejected: true}},
+		{"a kerfuffle", Verdict{Body: "a ****"}},
+		{"Kerfuffle, buy now", Verdict{Body: "****, buy now", Flagged: true}},
+		{"# banned words", Verdict{Body: "# banned words"}},
+	}
+	for _, tt := range tests {
+		if v := m.Moderate(tt.body); v != tt.want {
+			t.Errorf("Moderate(%q) = %+v, want %+v", tt.body, v, tt.want)
+		}
+	}
+}
+
+func TestLoadConfigErrors(t *testing.T) {
+	for name, config := range map[string]string{
+		"bad JSON":       `{"filters": [`,
+		"unknown type":   `{"filters": [{"type": "ai", "action": "mask"}]}`,
+		"unknown action": `{"filters": [{"type": "words", "words": ["a"], "action": "ban"}]}`,
+		"bad pattern":    `{"filters": [{"type": "regex", "pattern": "(", "action": "mask"}]}`,
+		"missing file":   `{"filters": [{"type": "words", "file": "missing.txt", "action": "mask"}]}`,
+	} {
+		path := filepath.Join(t.TempDir(), "moderation.json")
+		writeFile(t, path, config)
+		if _, err := LoadConfig(path); err == nil {
+			t.Errorf("%s: LoadConfig succeeded", name)
+		}
+	}
+}
+
+func TestReloader(t *testing.T) {
+	r, err := NewReloader("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Moderate("kerfuffle"); v.Body != "****" {
+		t.Errorf("without a config: got %+v, want the default word list", v)
+	}
+
+	path := filepath.Join(t.TempDir(), "moderation.json")
+	writeFile(t, path, `{"filters": [{"type": "words", "words": ["fornax"], "action": "reject"}]}`)
+	r, err = NewReloader(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Moderate("fornax"); !v.Rejected {
+		t.Errorf("got %+v, want a rejection", v)
+	}
+
+	writeFile(t, path, `{"filters": [{"type": "words", "words": ["fornax"], "action": "flag"}]}`)
+	if err := r.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if v := r.Moderate("fornax"); v.Rejected || !v.Flagged {
+		t.Errorf("after reloading: got %+v, want a flag", v)
+	}
+
+	// A config that can't be loaded leaves the previous one in effect.
+	writeFile(t, path, `{"filters": [`)
+	if err := r.Reload(); err == nil {
+		t.Fatal("Reload accepted a broken config")
+	}
+	if v := r.Moderate("fornax"); !v.Flagged {
+		t.Errorf("after a failed reload: got %+v, want a flag", v)
+	}
+}
@@ -0,0 +1,84 @@
+// Package moderation checks chirp bodies against configurable rules before
+// they are stored.
+package moderation
+
+import "fmt"
+
+// Action is what a filter does with a body that matches it.
+type Action string
+
+const (
+	// ActionMask replaces the matched text with asterisks.
+	ActionMask Action = "mask"
+	// ActionReject refuses the chirp.
+	ActionReject Action = "reject"
+	// ActionFlag accepts the chirp unchanged but marks it for review.
+	ActionFlag Action = "flag"
+)
+
+func ParseAction(s string) (Action, error) {
+	switch action := Action(s); action {
+	case ActionMask, ActionReject, ActionFlag:
+		return action, nil
+	default:
+		return "", fmt.Errorf("unknown moderation action %q", s)
+	}
+}
+
+// mask is what masked text is replaced with.
+const mask = "****"
+
+// Verdict is the outcome of moderating a body.
+type Verdict struct {
+	// Body is the body to store, with any masking applied.
+	Body string
+	// Rejected is set if the chirp must not be stored.
+	Rejected bool
+	// Flagged is set if the chirp should be reviewed by a moderator.
+	Flagged bool
+}
+
+// Moderator decides what happens to a chirp body.
+type Moderator interface {
+	Moderate(body string) Verdict
+}
+
+// Pipeline runs moderators in order, each one seeing the body as masked by
+// those before it. It stops at the first rejection.
+type Pipeline []Moderator
+
+func (p Pipeline) Moderate(body string) Verdict {
+	verdict := Verdict{Body: body}
+	for _, m := range p {
+		v := m.Moderate(verdict.Body)
+		verdict.Body = v.Body
+		verdict.Flagged = verdict.Flagged || v.Flagged
+		if v.Rejected {
+			verdict.Rejected = true
+			return verdict
+		}
+	}
+	return verdict
+}
+
+// apply returns the verdict for a body in which filter found the spans
+// [start, end) of matching text, which must be sorted and not overlap.
+func apply(action Action, body string, spans [][2]int) Verdict {
+	if len(spans) == 0 {
+		return Verdict{Body: body}
+	}
+	switch action {
+	case ActionReject:
+		return Verdict{Body: body, Rejected: true}
+	case ActionFlag:
+		return Verdict{Body: body, Flagged: true}
+	}
+
+	masked := ""
+	last := 0
+	for _, span := range spans {
+		masked += body[last:span[0]] + mask
+		last = span[1]
+	}
+	return Verdict{Body: masked + body[last:]}
+}
@@ -0,0 +1,105 @@
+package moderation
+
+import (
+	"testing"
+)
+
+func mustRegexRule(t *testing.T, pattern string, action Action) *RegexRule {
+	t.Helper()
+	r, err := NewRegexRule(pattern, action)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r
+}
+
+func TestWordList(t *testing.T) {
+	w := NewWordList([]string{"kerfuffle", " Sharbert ", ""}, ActionMask)
+	tests := []struct {
+		body string
+		want string
+	}{
+		{"what a kerfuffle", "what a ****"},
+		{"Kerfuffle!", "****!"},
+		{"KERFUFFLE, sharbert.", "****, ****."},
+		{"Kérfuffle", "****"},
+		{"Ke\u0301rfuffle", "****"},
+		{"(sharbert)", "(****)"},
+		{"kerfuffles", "kerfuffles"},
+		{"kerfuffle-free", "****-free"},
+		{"nothing to see", "nothing to see"},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		v := w.Moderate(tt.body)
+		if v.Body != tt.want || v.Rejected || v.Flagged {
+			t.Errorf("Moderate(%q) = %+v, want body %q", tt.body, v, tt.want)
+		}
+	}
+}
+
+func TestActions(t *testing.T) {
+	tests := []struct {
+		action Action
+		want   Verdict
+	}{
+		{ActionMask, Verdict{Body: "a **** chirp"}},
+		{ActionReject, Verdict{Body: "a fornax chirp", Rejected: true}},
+		{ActionFlag, Verdict{Body: "a fornax chirp", Flagged: true}},
+	}
+	for _, tt := range tests {
+		if v := NewWordList([]string{"fornax"}, tt.action).Moderate("a fornax chirp"); v != tt.want {
+			t.Errorf("%s: got %+v, want %+v", tt.action, v, tt.want)
+		}
+		if v := mustRegexRule(t, "forn[a-z]+", tt.action).Moderate("a fornax chirp"); v != tt.want {
+			t.Errorf("%s regex: got %+v, want %+v", tt.action, v, tt.want)
+		}
+		// Nothing happens to bodies that don't match.
+		if v := NewWordList([]string{"fornax"}, tt.action).Moderate("a fine chirp"); v != (Verdict{Body: "a fine chirp"}) {
+			t.Errorf("%s without a match: got %+v", tt.action, v)
+		}
+	}
+}
+
+func TestRegexRule(t *testing.T) {
+	// x* also matches the empty string, which mustn't be masked.
+	r := mustRegexRule(t, `(?i)buy\s+now|x*`, ActionMask)
+	if v := r.Moderate("Buy  now, BUY NOW"); v.Body != "****, ****" {
+		t.Errorf("got %q", v.Body)
+	}
+	if _, err := NewRegexRule("(", ActionMask); err == nil {
+		t.Error("NewRegexRule accepted an invalid pattern")
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	p := Pipeline{
+		NewWordList([]string{"kerfuffle"}, ActionMask),
+		mustRegexRule(t, `\*\*\*\*`, ActionFlag),
+		NewWordList([]string{"fornax"}, ActionReject),
+		mustRegexRule(t, "never", ActionFlag),
+	}
+
+	// Later filters see the body as masked by earlier ones.
+	if v := p.Moderate("a kerfuffle"); v != (Verdict{Body: "a ****", Flagged: true}) {
+		t.Errorf("got %+v", v)
+	}
+	// The pipeline stops at a rejection.
+	if v := p.Moderate("fornax never"); !v.Rejected || v.Flagged {
+		t.Errorf("got %+v, want a rejection before the last filter", v)
+	}
+	if v := p.Moderate("fine"); v != (Verdict{Body: "fine"}) {
+		t.Errorf("got %+v", v)
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	for _, s := range []string{"mask", "reject", "flag"} {
+		if action, err := ParseAction(s); err != nil || string(action) != s {
+			t.Errorf("ParseAction(%q) = %q, %v", s, action, err)
+		}
+	}
+	if _, err := ParseAction("delete"); err == nil {
+		t.Error("ParseAction accepted an unknown action")
+	}
+}
@@ -0,0 +1,27 @@
+package moderation
+
+import "regexp"
+
+// RegexRule matches text against a regular expression.
+type RegexRule struct {
+	pattern *regexp.Regexp
+	action  Action
+}
+
+func NewRegexRule(pattern string, action Action) (*RegexRule, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return &RegexRule{pattern: re, action: action}, nil
+}
+
+func (r *RegexRule) Moderate(body string) Verdict {
+	spans := [][2]int{}
+	for _, match := range r.pattern.FindAllStringIndex(body, -1) {
+		if match[0] < match[1] {
+			spans = append(spans, [2]int{match[0], match[1]})
+		}
+	}
+	return apply(r.action, body, spans)
+}
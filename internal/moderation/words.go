@@ -0,0 +1,104 @@
+package moderation
+
+import (
+	"bufio"
+	"os"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// WordList matches whole words from a list. Words are compared after case
+// folding and stripping accents, so "Kérfuffle" matches "kerfuffle", and
+// punctuation around a word doesn't stop it matching: in "Kerfuffle!" only
+// "Kerfuffle" is masked.
+type WordList struct {
+	words  map[string]struct{}
+	action Action
+}
+
+func NewWordList(words []string, action Action) *WordList {
+	w := &WordList{
+		words:  make(map[string]struct{}, len(words)),
+		action: action,
+	}
+	for _, word := range words {
+		if word = normalize(strings.TrimSpace(word)); word != "" {
+			w.words[word] = struct{}{}
+		}
+	}
+	return w
+}
+
+// LoadWordList reads a word list with one word per line. Blank lines and
+// lines starting with # are ignored.
+func LoadWordList(path string, action Action) (*WordList, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	words := []string{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		words = append(words, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return NewWordList(words, action), nil
+}
+
+func (w *WordList) Moderate(body string) Verdict {
+	spans := [][2]int{}
+	for _, span := range wordSpans(body) {
+		if _, ok := w.words[normalize(body[span[0]:span[1]])]; ok {
+			spans = append(spans, span)
+		}
+	}
+	return apply(w.action, body, spans)
+}
+
+// isWordRune reports whether r is part of a word. Combining marks are, so
+// decomposed accents stay with their letter.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.Is(unicode.Mn, r)
+}
+
+// wordSpans returns the byte offsets [start, end) of the words in s.
+func wordSpans(s string) [][2]int {
+	spans := [][2]int{}
+	start := -1
+	for i, r := range s {
+		switch {
+		case isWordRune(r) && start < 0:
+			start = i
+		case !isWordRune(r) && start >= 0:
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(s)})
+	}
+	return spans
+}
+
+// normalize folds case and strips accents and other combining marks.
+func normalize(s string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), cases.Fold(), norm.NFC)
+	normalized, _, err := transform.String(t, s)
+	if err != nil {
+		return strings.ToLower(s)
+	}
+	return normalized
+}
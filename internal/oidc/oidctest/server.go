@@ -0,0 +1,207 @@
+// Package oidctest provides a stand-in OpenID Connect provider for tests.
+package oidctest
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// KeyID is the kid of the key Server signs ID tokens with.
+const KeyID = "test-key"
+
+// User is the account the next sign-in at a Server is for.
+type User struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+}
+
+// Server is an OpenID Connect provider with one registered client. Its
+// authorization endpoint signs the user set with SetUser in straight away
+// and redirects back with a code.
+type Server struct {
+	*httptest.Server
+	ClientID     string
+	ClientSecret string
+	Key          ed25519.PrivateKey
+
+	mu sync.Mutex
+	// user is who the next sign-in is for. If Subject is empty the
+	// sign-in is refused with access_denied.
+	user  User
+	codes map[string]grant
+}
+
+// grant is what an authorization code stands for.
+type grant struct {
+	user        User
+	nonce       string
+	challenge   string
+	redirectURI string
+}
+
+// NewServer starts a provider for the client clientID, which authenticates
+// with clientSecret. Close it when done.
+func NewServer(clientID string, clientSecret string) *Server {
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		panic(err)
+	}
+	s := &Server{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		Key:          key,
+		codes:        map[string]grant{},
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+	mux.HandleFunc("/jwks", s.handleJWKS)
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// SetUser sets who the next sign-in is for.
+func (s *Server) SetUser(user User) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.user = user
+}
+
+// Sign signs claims with the server's key, as an ID token.
+func (s *Server) Sign(claims jwt.Claims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+	token.Header["kid"] = KeyID
+	signed, err := token.SignedString(s.Key)
+	if err != nil {
+		panic(err)
+	}
+	return signed
+}
+
+// IDTokenClaims returns the claims of a valid ID token for user.
+func (s *Server) IDTokenClaims(user User, nonce string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":            s.URL,
+		"aud":            s.ClientID,
+		"sub":            user.Subject,
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"nonce":          nonce,
+		"iat":            now.Unix(),
+		"exp":            now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{
+		"issuer":                 s.URL,
+		"authorization_endpoint": s.URL + "/authorize",
+		"token_endpoint":         s.URL + "/token",
+		"jwks_uri":               s.URL + "/jwks",
+	})
+}
+
+func (s *Server) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	public := s.Key.Public().(ed25519.PublicKey)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"kid": KeyID,
+			"use": "sig",
+			"x":   base64.RawURLEncoding.EncodeToString(public),
+		}},
+	})
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	redirectURI := query.Get("redirect_uri")
+	if query.Get("client_id") != s.ClientID || redirectURI == "" {
+		http.Error(w, "unknown client", http.StatusBadRequest)
+		return
+	}
+	back, err := url.Parse(redirectURI)
+	if err != nil {
+		http.Error(w, "bad redirect URI", http.StatusBadRequest)
+		return
+	}
+	params := back.Query()
+	params.Set("state", query.Get("state"))
+
+	s.mu.Lock()
+	user := s.user
+	switch {
+	case user.Subject == "":
+		params.Set("error", "access_denied")
+	case query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "":
+		params.Set("error", "invalid_request")
+	default:
+		b := make([]byte, 16)
+		rand.Read(b)
+		code := hex.EncodeToString(b)
+		s.codes[code] = grant{
+			user:        user,
+			nonce:       query.Get("nonce"),
+			challenge:   query.Get("code_challenge"),
+			redirectURI: redirectURI,
+		}
+		params.Set("code", code)
+	}
+	s.mu.Unlock()
+
+	back.RawQuery = params.Encode()
+	http.Redirect(w, r, back.String(), http.StatusFound)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	id, secret, ok := r.BasicAuth()
+	if !ok {
+		id, secret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	id, _ = url.QueryUnescape(id)
+	secret, _ = url.QueryUnescape(secret)
+	if id != s.ClientID || secret != s.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	s.mu.Lock()
+	code := r.PostFormValue("code")
+	g, ok := s.codes[code]
+	delete(s.codes, code)
+	s.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+	if !ok || r.PostFormValue("grant_type") != "authorization_code" ||
+		r.PostFormValue("redirect_uri") != g.redirectURI ||
+		base64.RawURLEncoding.EncodeToString(sum[:]) != g.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]string{
+		"access_token": "unused",
+		"token_type":   "Bearer",
+		"id_token":     s.Sign(s.IDTokenClaims(g.user, g.nonce)),
+	})
+}
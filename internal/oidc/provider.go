@@ -0,0 +1,288 @@
+// Package oidc signs users in with an external OpenID Connect provider,
+// using the authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// maxResponseBytes caps how much of a response from the provider is read.
+const maxResponseBytes = 1 << 20
+
+// keyRefreshInterval is the least time between two fetches of the
+// provider's keys, so tokens naming unknown keys can't be used to make
+// Chirpy hammer the provider.
+const keyRefreshInterval = time.Minute
+
+// Config is the client registration at the provider.
+type Config struct {
+	// Issuer is the provider's issuer URL, which its discovery document is
+	// found under.
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is Chirpy's callback URL, as registered at the provider.
+	RedirectURL string
+}
+
+// Claims are the claims of a verified ID token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Nonce           string `json:"nonce"`
+	AuthorizedParty string `json:"azp"`
+	Email           string `json:"email"`
+	EmailVerified   bool   `json:"email_verified"`
+}
+
+// Provider is an OpenID Connect provider users can sign in with. Its
+// discovery document is fetched on first use and its keys whenever a token
+// names one that isn't known yet.
+type Provider struct {
+	cfg Config
+	// Client makes the requests to the provider. Tests can substitute
+	// their own.
+	Client *http.Client
+
+	mu          sync.Mutex
+	metadata    *metadata
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// metadata is the part of the discovery document Chirpy uses.
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// NewProvider returns the provider cfg is registered at.
+func NewProvider(cfg Config) *Provider {
+	cfg.Issuer = strings.TrimSuffix(cfg.Issuer, "/")
+	return &Provider{
+		cfg:    cfg,
+		Client: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Issuer returns the provider's issuer URL, which together with the subject
+// of an ID token identifies the account it was issued for.
+func (p *Provider) Issuer() string {
+	return p.cfg.Issuer
+}
+
+// RedirectURL returns Chirpy's callback URL.
+func (p *Provider) RedirectURL() string {
+	return p.cfg.RedirectURL
+}
+
+// AuthCodeURL returns the URL to send the user to to sign in. state and
+// nonce come back in the callback and the ID token, and challenge is the
+// S256 PKCE challenge of the verifier Exchange gets.
+func (p *Provider) AuthCodeURL(ctx context.Context, state string, nonce string, challenge string) (string, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	u, err := url.Parse(meta.AuthorizationEndpoint)
+	if err != nil {
+		return "", fmt.Errorf("invalid authorization endpoint: %w", err)
+	}
+	query := u.Query()
+	query.Set("response_type", "code")
+	query.Set("client_id", p.cfg.ClientID)
+	query.Set("redirect_uri", p.cfg.RedirectURL)
+	query.Set("scope", "openid email")
+	query.Set("state", state)
+	query.Set("nonce", nonce)
+	query.Set("code_challenge", challenge)
+	query.Set("code_challenge_method", "S256")
+	u.RawQuery = query.Encode()
+	return u.String(), nil
+}
+
+// Exchange redeems an authorization code and returns the claims of the ID
+// token that comes with it, once its signature, issuer, audience, expiry
+// and nonce have been checked.
+func (p *Provider) Exchange(ctx context.Context, code string, verifier string, nonce string) (Claims, error) {
+	meta, err := p.discover(ctx)
+	if err != nil {
+		return Claims{}, err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	if p.cfg.ClientSecret == "" {
+		form.Set("client_id", p.cfg.ClientID)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return Claims{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+
+	respBody := struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}{}
+	status, err := p.do(req, &respBody)
+	if err != nil {
+		return Claims{}, err
+	}
+	if respBody.Error != "" {
+		return Claims{}, fmt.Errorf("token request failed: %s %s", respBody.Error, respBody.ErrorDescription)
+	}
+	if status != http.StatusOK || respBody.IDToken == "" {
+		return Claims{}, fmt.Errorf("token request failed with status %d", status)
+	}
+	return p.verify(ctx, meta, respBody.IDToken, nonce)
+}
+
+// verify checks an ID token and returns its claims.
+func (p *Provider) verify(ctx context.Context, meta *metadata, token string, nonce string) (Claims, error) {
+	claims := Claims{}
+	keyfunc := func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, meta, kid)
+	}
+	_, err := jwt.ParseWithClaims(token, &claims, keyfunc,
+		// Never HS256: its key would be the client secret.
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(meta.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+	)
+	if err != nil {
+		return Claims{}, fmt.Errorf("invalid ID token: %w", err)
+	}
+	if claims.ExpiresAt == nil {
+		return Claims{}, errors.New("invalid ID token: no expiry")
+	}
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.cfg.ClientID {
+		return Claims{}, errors.New("invalid ID token: issued to another party")
+	}
+	if claims.Nonce != nonce {
+		return Claims{}, errors.New("invalid ID token: nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return Claims{}, errors.New("invalid ID token: no subject")
+	}
+	return claims, nil
+}
+
+// discover returns the provider's discovery document, fetching it the
+// first time.
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.metadata != nil {
+		return p.metadata, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, p.cfg.Issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	meta := metadata{}
+	status, err := p.do(req, &meta)
+	if err != nil {
+		return nil, fmt.Errorf("fetching discovery document: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching discovery document: status %d", status)
+	}
+	if strings.TrimSuffix(meta.Issuer, "/") != p.cfg.Issuer {
+		return nil, fmt.Errorf("discovery document is for issuer %q", meta.Issuer)
+	}
+	if meta.AuthorizationEndpoint == "" || meta.TokenEndpoint == "" || meta.JWKSURI == "" {
+		return nil, errors.New("discovery document is missing endpoints")
+	}
+	p.metadata = &meta
+	return p.metadata, nil
+}
+
+// key returns the provider's key with ID kid, refetching the provider's
+// keys if it isn't known. A token without a kid may only be verified when
+// the provider has a single key.
+func (p *Provider) key(ctx context.Context, meta *metadata, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	if time.Since(p.keysFetched) < keyRefreshInterval {
+		return nil, fmt.Errorf("unknown key %q", kid)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, meta.JWKSURI, nil)
+	if err != nil {
+		return nil, err
+	}
+	set := jwkSet{}
+	status, err := p.do(req, &set)
+	if err != nil {
+		return nil, fmt.Errorf("fetching keys: %w", err)
+	}
+	if status != http.StatusOK {
+		return nil, fmt.Errorf("fetching keys: status %d", status)
+	}
+	p.keys = set.publicKeys()
+	p.keysFetched = time.Now()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("unknown key %q", kid)
+}
+
+func (p *Provider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" {
+		if len(p.keys) != 1 {
+			return nil, false
+		}
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+// do sends req and decodes the JSON response into v, whatever its status,
+// which it returns.
+func (p *Provider) do(req *http.Request, v interface{}) (int, error) {
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxResponseBytes))
+	if err != nil {
+		return 0, err
+	}
+	if err := json.Unmarshal(data, v); err != nil {
+		return resp.StatusCode, fmt.Errorf("decoding response with status %d: %w", resp.StatusCode, err)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/christopherplain/chirpy/internal/oidc/oidctest"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "chirpy"
+	testClientSecret = "client-secret"
+	testRedirectURL  = "https://chirpy.example/api/login/oidc/callback"
+	testVerifier     = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+var alice = oidctest.User{Subject: "alice-sub", Email: "alice@example.com", EmailVerified: true}
+
+func newTestProvider(t *testing.T) (*oidctest.Server, *Provider) {
+	t.Helper()
+	server := oidctest.NewServer(testClientID, testClientSecret)
+	t.Cleanup(server.Close)
+	server.SetUser(alice)
+	p := NewProvider(Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	})
+	return server, p
+}
+
+// signIn sends the user to the provider as Chirpy would and returns the
+// code it redirects back with.
+func signIn(t *testing.T, p *Provider, nonce string) string {
+	t.Helper()
+	sum := sha256.Sum256([]byte(testVerifier))
+	authURL, err := p.AuthCodeURL(context.Background(), "state", nonce, base64.RawURLEncoding.EncodeToString(sum[:]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	back, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(back.String(), testRedirectURL) || back.Query().Get("state") != "state" {
+		t.Fatalf("provider redirected to %s", back)
+	}
+	return back.Query().Get("code")
+}
+
+func TestExchange(t *testing.T) {
+	_, p := newTestProvider(t)
+	code := signIn(t, p, "nonce")
+
+	claims, err := p.Exchange(context.Background(), code, testVerifier, "nonce")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if claims.Subject != alice.Subject || claims.Email != alice.Email || !claims.EmailVerified {
+		t.Errorf("claims = %+v", claims)
+	}
+
+	// Codes are good for one exchange.
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "nonce"); err == nil {
+		t.Error("a code was exchanged twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	_, p := newTestProvider(t)
+	code := signIn(t, p, "nonce")
+	if _, err := p.Exchange(context.Background(), code, strings.Repeat("a", 43), "nonce"); err == nil {
+		t.Error("Exchange with the wrong verifier succeeded")
+	}
+}
+
+func TestExchangeRejectsNonceMismatch(t *testing.T) {
+	_, p := newTestProvider(t)
+	code := signIn(t, p, "nonce")
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "other nonce"); err == nil {
+		t.Error("Exchange accepted an ID token with another nonce")
+	}
+}
+
+func TestExchangeRejectsWrongClientSecret(t *testing.T) {
+	server, _ := newTestProvider(t)
+	p := NewProvider(Config{
+		Issuer:       server.URL,
+		ClientID:     testClientID,
+		ClientSecret: "wrong",
+		RedirectURL:  testRedirectURL,
+	})
+	code := signIn(t, p, "nonce")
+	if _, err := p.Exchange(context.Background(), code, testVerifier, "nonce"); err == nil {
+		t.Error("Exchange with the wrong client secret succeeded")
+	}
+}
+
+func TestVerify(t *testing.T) {
+	server, p := newTestProvider(t)
+	meta, err := p.discover(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, foreignKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// claims returns valid ID token claims changed by edit.
+	claims := func(edit func(jwt.MapClaims)) jwt.MapClaims {
+		c := server.IDTokenClaims(alice, "nonce")
+		if edit != nil {
+			edit(c)
+		}
+		return c
+	}
+	signWith := func(method jwt.SigningMethod, key interface{}, c jwt.MapClaims) string {
+		token := jwt.NewWithClaims(method, c)
+		token.Header["kid"] = oidctest.KeyID
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+
+	if _, err := p.verify(context.Background(), meta, server.Sign(claims(nil)), "nonce"); err != nil {
+		t.Fatalf("valid ID token: %s", err)
+	}
+
+	tests := map[string]string{
+		"bad signature": signWith(jwt.SigningMethodEdDSA, foreignKey, claims(nil)),
+		"tampered": func() string {
+			parts := strings.Split(server.Sign(claims(nil)), ".")
+			payload, _ := jwt.NewParser().DecodeSegment(parts[1])
+			payload = []byte(strings.Replace(string(payload), alice.Subject, "mallory-sub", 1))
+			parts[1] = base64.RawURLEncoding.EncodeToString(payload)
+			return strings.Join(parts, ".")
+		}(),
+		// Signed with the client secret, which the client knows too.
+		"HS256": signWith(jwt.SigningMethodHS256, []byte(testClientSecret), claims(nil)),
+		"none":  signWith(jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, claims(nil)),
+		"wrong issuer": server.Sign(claims(func(c jwt.MapClaims) {
+			c["iss"] = "https://evil.example"
+		})),
+		"wrong audience": server.Sign(claims(func(c jwt.MapClaims) {
+			c["aud"] = "another-client"
+		})),
+		"issued to another party": server.Sign(claims(func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "another-client"}
+			c["azp"] = "another-client"
+		})),
+		"nonce mismatch": server.Sign(claims(func(c jwt.MapClaims) {
+			c["nonce"] = "other nonce"
+		})),
+		"no nonce": server.Sign(claims(func(c jwt.MapClaims) {
+			delete(c, "nonce")
+		})),
+		"expired": server.Sign(claims(func(c jwt.MapClaims) {
+			c["exp"] = time.Now().Add(-time.Minute).Unix()
+		})),
+		"no expiry": server.Sign(claims(func(c jwt.MapClaims) {
+			delete(c, "exp")
+		})),
+		"no subject": server.Sign(claims(func(c jwt.MapClaims) {
+			delete(c, "sub")
+		})),
+	}
+	for name, token := range tests {
+		if _, err := p.verify(context.Background(), meta, token, "nonce"); err == nil {
+			t.Errorf("%s: verify accepted the ID token", name)
+		}
+	}
+}
+
+func TestDiscoveryRejectsIssuerMismatch(t *testing.T) {
+	server, _ := newTestProvider(t)
+	// The same server under another name serves a document for its own
+	// issuer, not the configured one.
+	issuer := strings.Replace(server.URL, "127.0.0.1", "localhost", 1)
+	p := NewProvider(Config{Issuer: issuer, ClientID: testClientID})
+	if _, err := p.AuthCodeURL(context.Background(), "state", "nonce", "challenge"); err == nil || !strings.Contains(err.Error(), "issuer") {
+		t.Errorf("AuthCodeURL with another issuer's discovery document: got %v", err)
+	}
+}
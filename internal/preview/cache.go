@@ -0,0 +1,90 @@
+package preview
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache is a Fetcher that remembers the previews, and the failures, of
+// another Fetcher, so popular links are fetched once however often they are
+// posted.
+type Cache struct {
+	fetcher Fetcher
+	ttl     time.Duration
+	size    int
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// lru orders the entries from most to least recently used.
+	lru *list.List
+}
+
+type cacheEntry struct {
+	url     string
+	preview Preview
+	err     error
+	expires time.Time
+}
+
+// NewCache caches the results of fetcher for ttl, keeping at most size of
+// them.
+func NewCache(fetcher Fetcher, ttl time.Duration, size int) *Cache {
+	return &Cache{
+		fetcher: fetcher,
+		ttl:     ttl,
+		size:    size,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+func (c *Cache) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	if entry, ok := c.get(rawURL); ok {
+		return entry.preview, entry.err
+	}
+
+	p, err := c.fetcher.Fetch(ctx, rawURL)
+	if ctx.Err() != nil {
+		// Cancelled, not a result worth remembering.
+		return p, err
+	}
+	c.put(cacheEntry{url: rawURL, preview: p, err: err, expires: time.Now().Add(c.ttl)})
+	return p, err
+}
+
+func (c *Cache) get(rawURL string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	elem, ok := c.entries[rawURL]
+	if !ok {
+		return cacheEntry{}, false
+	}
+	entry := elem.Value.(cacheEntry)
+	if time.Now().After(entry.expires) {
+		c.lru.Remove(elem)
+		delete(c.entries, rawURL)
+		return cacheEntry{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+func (c *Cache) put(entry cacheEntry) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if elem, ok := c.entries[entry.url]; ok {
+		elem.Value = entry
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[entry.url] = c.lru.PushFront(entry)
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.entries, oldest.Value.(cacheEntry).url)
+	}
+}
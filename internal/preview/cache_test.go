@@ -0,0 +1,118 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// countingFetcher returns a preview titled after the URL, or err, and counts
+// the fetches per URL.
+type countingFetcher struct {
+	mu    sync.Mutex
+	calls map[string]int
+	err   error
+}
+
+func (f *countingFetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.calls == nil {
+		f.calls = map[string]int{}
+	}
+	f.calls[rawURL]++
+	if err := ctx.Err(); err != nil {
+		return Preview{}, err
+	}
+	if f.err != nil {
+		return Preview{}, f.err
+	}
+	return Preview{URL: rawURL, Title: rawURL}, nil
+}
+
+func (f *countingFetcher) count(rawURL string) int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls[rawURL]
+}
+
+func TestCacheTTL(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := NewCache(fetcher, 50*time.Millisecond, 10)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		p, err := cache.Fetch(ctx, "https://a.example/")
+		if err != nil || p.Title != "https://a.example/" {
+			t.Fatalf("Fetch = %+v, %v", p, err)
+		}
+	}
+	if n := fetcher.count("https://a.example/"); n != 1 {
+		t.Fatalf("fetched %d times within the TTL, want 1", n)
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	if _, err := cache.Fetch(ctx, "https://a.example/"); err != nil {
+		t.Fatal(err)
+	}
+	if n := fetcher.count("https://a.example/"); n != 2 {
+		t.Errorf("fetched %d times after the TTL, want 2", n)
+	}
+}
+
+func TestCacheRemembersFailures(t *testing.T) {
+	fetcher := &countingFetcher{err: ErrNoPreview}
+	cache := NewCache(fetcher, time.Hour, 10)
+
+	for i := 0; i < 2; i++ {
+		if _, err := cache.Fetch(context.Background(), "https://a.example/"); !errors.Is(err, ErrNoPreview) {
+			t.Fatalf("Fetch: got %v, want ErrNoPreview", err)
+		}
+	}
+	if n := fetcher.count("https://a.example/"); n != 1 {
+		t.Errorf("fetched a failing URL %d times, want 1", n)
+	}
+}
+
+func TestCacheSkipsCancelled(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := NewCache(fetcher, time.Hour, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := cache.Fetch(ctx, "https://a.example/"); err == nil {
+		t.Fatal("Fetch with a cancelled context succeeded")
+	}
+	if _, err := cache.Fetch(context.Background(), "https://a.example/"); err != nil {
+		t.Fatalf("Fetch after a cancelled one: %s", err)
+	}
+	if n := fetcher.count("https://a.example/"); n != 2 {
+		t.Errorf("fetched %d times, want 2: the cancelled fetch was cached", n)
+	}
+}
+
+func TestCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fetcher := &countingFetcher{}
+	cache := NewCache(fetcher, time.Hour, 2)
+	ctx := context.Background()
+
+	for _, u := range []string{"https://a.example/", "https://b.example/", "https://a.example/", "https://c.example/"} {
+		if _, err := cache.Fetch(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// b was used least recently when c came in, so it was evicted.
+	for _, u := range []string{"https://a.example/", "https://c.example/", "https://b.example/"} {
+		if _, err := cache.Fetch(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := map[string]int{"https://a.example/": 1, "https://b.example/": 2, "https://c.example/": 1}
+	for u, n := range want {
+		if got := fetcher.count(u); got != n {
+			t.Errorf("%s fetched %d times, want %d", u, got, n)
+		}
+	}
+}
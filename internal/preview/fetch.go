@@ -0,0 +1,153 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// maxRedirects is how many redirects a fetch follows before giving up.
+const maxRedirects = 5
+
+// ErrBlockedAddress is returned when a URL resolves to an address previews
+// may not be fetched from, such as a loopback or private network address.
+var ErrBlockedAddress = errors.New("address is not allowed")
+
+// HTTPFetcher fetches previews over HTTP.
+type HTTPFetcher struct {
+	// Client makes the requests. NewHTTPFetcher sets up one that refuses to
+	// connect to internal addresses; tests can substitute their own.
+	Client *http.Client
+	// MaxBytes caps how much of a page is read.
+	MaxBytes int64
+	// UserAgent is sent with every request.
+	UserAgent string
+}
+
+// NewHTTPFetcher returns a fetcher that gives up on a page after timeout,
+// including redirects, and reads at most maxBytes of it. It only connects to
+// public addresses on ports 80 and 443, checking the address it actually
+// dials so DNS can't be used to get around the check.
+func NewHTTPFetcher(timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: allowDial,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   timeout,
+		ResponseHeaderTimeout: timeout,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	return &HTTPFetcher{
+		Client: &http.Client{
+			Transport:     transport,
+			Timeout:       timeout,
+			CheckRedirect: checkRedirect,
+		},
+		MaxBytes:  maxBytes,
+		UserAgent: "Chirpy-LinkPreview/1.0",
+	}
+}
+
+func (f *HTTPFetcher) Fetch(ctx context.Context, rawURL string) (Preview, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return Preview{}, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return Preview{}, fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return Preview{}, err
+	}
+	req.Header.Set("Accept", "text/html")
+	req.Header.Set("User-Agent", f.UserAgent)
+
+	resp, err := f.Client.Do(req)
+	if err != nil {
+		return Preview{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Preview{}, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return Preview{}, ErrNoPreview
+	}
+
+	p, err := Parse(io.LimitReader(resp.Body, f.MaxBytes), resp.Request.URL)
+	if err != nil {
+		return Preview{}, err
+	}
+	p.URL = rawURL
+	return p, nil
+}
+
+func checkRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return errors.New("too many redirects")
+	}
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+	}
+	return nil
+}
+
+// allowDial is a net.Dialer Control function that refuses connections to
+// anything but public addresses on the standard web ports.
+func allowDial(network string, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+	if port := addrPort.Port(); port != 80 && port != 443 {
+		return fmt.Errorf("%w: port %d", ErrBlockedAddress, port)
+	}
+	if !IsPublic(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s", ErrBlockedAddress, addrPort.Addr())
+	}
+	return nil
+}
+
+// nonPublic are the ranges, beyond those the netip predicates cover, that
+// aren't reachable on the public internet.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("192.0.2.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("198.51.100.0/24"),
+	netip.MustParsePrefix("203.0.113.0/24"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	netip.MustParsePrefix("64:ff9b::/96"),
+	netip.MustParsePrefix("2001:db8::/32"),
+}
+
+// IsPublic reports whether addr is a public unicast address.
+func IsPublic(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsGlobalUnicast() || addr.IsPrivate() {
+		return false
+	}
+	for _, prefix := range nonPublic {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
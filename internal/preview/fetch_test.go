@@ -0,0 +1,182 @@
+package preview
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+const testPage = `<html><head><meta property="og:title" content="Test page"></head><body></body></html>`
+
+// newTestFetcher returns a fetcher set up by NewHTTPFetcher that may also
+// dial server, which listens on a loopback address allowDial refuses.
+func newTestFetcher(server *httptest.Server, timeout time.Duration, maxBytes int64) *HTTPFetcher {
+	f := NewHTTPFetcher(timeout, maxBytes)
+	serverAddr := server.Listener.Addr().String()
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network string, address string, c syscall.RawConn) error {
+			if address == serverAddr {
+				return nil
+			}
+			return allowDial(network, address, c)
+		},
+	}
+	f.Client.Transport.(*http.Transport).DialContext = dialer.DialContext
+	return f
+}
+
+func TestFetch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("User-Agent") != "Chirpy-LinkPreview/1.0" {
+			t.Errorf("User-Agent = %q", r.Header.Get("User-Agent"))
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(testPage))
+	}))
+	defer server.Close()
+
+	p, err := newTestFetcher(server, time.Second, 1<<20).Fetch(context.Background(), server.URL+"/page")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Title != "Test page" || p.URL != server.URL+"/page" {
+		t.Errorf("Fetch = %+v", p)
+	}
+}
+
+func TestFetchNotHTML(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(testPage))
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher(server, time.Second, 1<<20).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Fetch of a JSON response: got %v, want ErrNoPreview", err)
+	}
+}
+
+func TestFetchMaxBytes(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><head><!--" + strings.Repeat("x", 4096) + "-->"))
+		w.Write([]byte(`<meta property="og:title" content="Too far"></head>`))
+	}))
+	defer server.Close()
+
+	_, err := newTestFetcher(server, time.Second, 1024).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Fetch with metadata past MaxBytes: got %v, want ErrNoPreview", err)
+	}
+
+	p, err := newTestFetcher(server, time.Second, 8192).Fetch(context.Background(), server.URL)
+	if err != nil || p.Title != "Too far" {
+		t.Errorf("Fetch with metadata within MaxBytes = %+v, %v", p, err)
+	}
+}
+
+func TestFetchTimeout(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer server.Close()
+	defer close(release)
+
+	start := time.Now()
+	_, err := newTestFetcher(server, 100*time.Millisecond, 1<<20).Fetch(context.Background(), server.URL)
+	if err == nil {
+		t.Fatal("Fetch of a page that never responds succeeded")
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Fetch gave up after %s, want about 100ms", elapsed)
+	}
+}
+
+func TestFetchBlocksRedirectToInternalAddress(t *testing.T) {
+	for _, target := range []string{
+		"http://127.0.0.1/",
+		"http://10.0.0.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[::1]/",
+		"http://93.184.216.34:8080/",
+	} {
+		server := httptest.NewServer(http.RedirectHandler(target, http.StatusFound))
+		_, err := newTestFetcher(server, time.Second, 1<<20).Fetch(context.Background(), server.URL)
+		server.Close()
+		if !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("redirect to %s: got %v, want ErrBlockedAddress", target, err)
+		}
+	}
+}
+
+func TestFetchBlocksLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the fetcher connected to a loopback address")
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPFetcher(time.Second, 1<<20).Fetch(context.Background(), server.URL)
+	if !errors.Is(err, ErrBlockedAddress) {
+		t.Errorf("Fetch of a loopback address: got %v, want ErrBlockedAddress", err)
+	}
+}
+
+func TestAllowDial(t *testing.T) {
+	tests := []struct {
+		address string
+		allowed bool
+	}{
+		{"93.184.216.34:80", true},
+		{"93.184.216.34:443", true},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", true},
+		{"93.184.216.34:8080", false},
+		{"93.184.216.34:22", false},
+		{"127.0.0.1:80", false},
+		{"[::1]:443", false},
+		{"[::ffff:127.0.0.1]:80", false},
+		{"10.1.2.3:80", false},
+		{"172.16.0.1:443", false},
+		{"192.168.1.1:80", false},
+		{"100.64.0.1:80", false},
+		{"169.254.169.254:80", false},
+		{"[fe80::1]:443", false},
+		{"[fd00::1]:80", false},
+		{"0.0.0.0:80", false},
+		{"224.0.0.1:80", false},
+	}
+	for _, tt := range tests {
+		err := allowDial("tcp", tt.address, nil)
+		if tt.allowed && err != nil {
+			t.Errorf("allowDial(%s) = %v, want nil", tt.address, err)
+		}
+		if !tt.allowed && !errors.Is(err, ErrBlockedAddress) {
+			t.Errorf("allowDial(%s) = %v, want ErrBlockedAddress", tt.address, err)
+		}
+	}
+}
+
+func TestIsPublic(t *testing.T) {
+	for _, addr := range []string{"8.8.8.8", "1.1.1.1", "2001:4860:4860::8888"} {
+		if !IsPublic(netip.MustParseAddr(addr)) {
+			t.Errorf("IsPublic(%s) = false", addr)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1", "10.0.0.1", "172.31.255.255", "192.168.0.1", "100.127.255.255", "169.254.0.1", "198.18.0.1", "192.0.2.1", "::1", "fe80::1", "fc00::1", "::ffff:10.0.0.1"} {
+		if IsPublic(netip.MustParseAddr(addr)) {
+			t.Errorf("IsPublic(%s) = true", addr)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+// Package preview fetches web pages and extracts the OpenGraph and Twitter
+// card metadata used to show a preview of a link.
+package preview
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/url"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// maxFieldLength caps, in bytes, the text fields of a preview.
+const maxFieldLength = 300
+
+// ErrNoPreview is returned when a page has no metadata worth showing.
+var ErrNoPreview = errors.New("page has no preview")
+
+// Preview describes a linked page.
+type Preview struct {
+	URL         string
+	Title       string
+	Description string
+	Image       string
+	SiteName    string
+}
+
+// Fetcher fetches the preview of the page at a URL.
+type Fetcher interface {
+	Fetch(ctx context.Context, rawURL string) (Preview, error)
+}
+
+// Parse reads the head of an HTML document and returns its preview.
+// OpenGraph properties take precedence over Twitter card properties, which
+// take precedence over the <title> element and the description meta tag.
+// Relative image URLs are resolved against base.
+func Parse(r io.Reader, base *url.URL) (Preview, error) {
+	// Values for each field, in order of precedence.
+	fields := map[string]*[3]string{
+		"title":       {},
+		"description": {},
+		"image":       {},
+		"site_name":   {},
+	}
+	set := func(field string, rank int, value string) {
+		values, ok := fields[field]
+		if ok && values[rank] == "" {
+			values[rank] = strings.TrimSpace(value)
+		}
+	}
+
+	z := html.NewTokenizer(r)
+	inTitle := false
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if !errors.Is(z.Err(), io.EOF) {
+				return Preview{}, z.Err()
+			}
+			return newPreview(fields, base)
+		case html.TextToken:
+			if inTitle {
+				set("title", 2, string(z.Text()))
+			}
+		case html.EndTagToken:
+			name, _ := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = false
+			case atom.Head:
+				return newPreview(fields, base)
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch atom.Lookup(name) {
+			case atom.Title:
+				inTitle = tt == html.StartTagToken
+			case atom.Body:
+				return newPreview(fields, base)
+			case atom.Meta:
+				attrs := map[string]string{}
+				for hasAttr {
+					var key, val []byte
+					key, val, hasAttr = z.TagAttr()
+					attrs[string(key)] = string(val)
+				}
+				content := attrs["content"]
+				property := strings.ToLower(attrs["property"])
+				name := strings.ToLower(attrs["name"])
+				switch {
+				case strings.HasPrefix(property, "og:"):
+					set(strings.TrimPrefix(property, "og:"), 0, content)
+				case strings.HasPrefix(name, "twitter:"):
+					set(strings.TrimPrefix(name, "twitter:"), 1, content)
+				case name == "description":
+					set("description", 2, content)
+				}
+			}
+		}
+	}
+}
+
+func newPreview(fields map[string]*[3]string, base *url.URL) (Preview, error) {
+	first := func(field string) string {
+		for _, value := range fields[field] {
+			if value != "" {
+				return truncate(value)
+			}
+		}
+		return ""
+	}
+
+	p := Preview{
+		Title:       first("title"),
+		Description: first("description"),
+		SiteName:    first("site_name"),
+	}
+	if ref := first("image"); ref != "" {
+		image, err := base.Parse(ref)
+		if err == nil && (image.Scheme == "http" || image.Scheme == "https") {
+			p.Image = image.String()
+		}
+	}
+	if p.Title == "" && p.Description == "" && p.Image == "" {
+		return Preview{}, ErrNoPreview
+	}
+	return p, nil
+}
+
+// truncate shortens s to at most maxFieldLength bytes without splitting a
+// character.
+func truncate(s string) string {
+	if len(s) <= maxFieldLength {
+		return s
+	}
+	i := maxFieldLength
+	for i > 0 && !utf8.RuneStart(s[i]) {
+		i--
+	}
+	return s[:i]
+}
@@ -0,0 +1,96 @@
+package preview
+
+import (
+	"errors"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	base, _ := url.Parse("https://example.com/posts/1")
+	tests := []struct {
+		name string
+		page string
+		want Preview
+	}{
+		{
+			name: "OpenGraph wins",
+			page: `<html><head>
+				<title>Title element</title>
+				<meta name="description" content="Description tag">
+				<meta name="twitter:title" content="Twitter title">
+				<meta property="og:title" content="OpenGraph title">
+				<meta property="og:description" content="OpenGraph description">
+				<meta property="og:image" content="/images/cover.png">
+				<meta property="og:site_name" content="Example">
+				</head><body></body></html>`,
+			want: Preview{
+				Title:       "OpenGraph title",
+				Description: "OpenGraph description",
+				Image:       "https://example.com/images/cover.png",
+				SiteName:    "Example",
+			},
+		},
+		{
+			name: "Twitter card before plain tags",
+			page: `<head>
+				<title>Title element</title>
+				<meta name="description" content="Description tag">
+				<meta name="twitter:title" content="Twitter title">
+				<meta name="twitter:image" content="https://cdn.example.com/card.jpg">
+				</head>`,
+			want: Preview{
+				Title:       "Twitter title",
+				Description: "Description tag",
+				Image:       "https://cdn.example.com/card.jpg",
+			},
+		},
+		{
+			name: "plain tags",
+			page: `<head><title> Title element </title><meta name="description" content="Description tag"></head>`,
+			want: Preview{Title: "Title element", Description: "Description tag"},
+		},
+		{
+			name: "body is ignored",
+			page: `<head><title>Head</title></head><body><meta property="og:title" content="Body"></body>`,
+			want: Preview{Title: "Head"},
+		},
+		{
+			name: "image with another scheme is dropped",
+			page: `<head><title>Title</title><meta property="og:image" content="javascript:alert(1)"></head>`,
+			want: Preview{Title: "Title"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(strings.NewReader(tt.page), base)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Parse = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseNoPreview(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	_, err := Parse(strings.NewReader(`<html><head><meta charset="utf-8"></head><body>Hi</body></html>`), base)
+	if !errors.Is(err, ErrNoPreview) {
+		t.Errorf("Parse of a page without metadata: got %v, want ErrNoPreview", err)
+	}
+}
+
+func TestParseTruncates(t *testing.T) {
+	base, _ := url.Parse("https://example.com/")
+	title := strings.Repeat("é", maxFieldLength)
+	got, err := Parse(strings.NewReader(`<head><title>`+title+`</title></head>`), base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got.Title) > maxFieldLength || !strings.HasPrefix(title, got.Title) || len(got.Title)%2 != 0 {
+		t.Errorf("Title was cut to %d bytes, splitting a character or too long", len(got.Title))
+	}
+}
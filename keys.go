@@ -0,0 +1,97 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/christopherplain/chirpy/internal/keys"
+)
+
+// runKeys implements the "chirpy keys new|retire" subcommand, which manages
+// the token signing keys in a key directory. Send the server SIGHUP to pick
+// up the change.
+func runKeys(args []string) {
+	flags := flag.NewFlagSet("keys", flag.ExitOnError)
+	dir := flags.String("dir", "keys", "Key directory")
+	alg := flags.String("alg", "EdDSA", "Algorithm of a new key (EdDSA or RS256)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: chirpy keys [--dir keys] [--alg EdDSA|RS256] new")
+		fmt.Fprintln(flags.Output(), "       chirpy keys [--dir keys] retire <id>")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if err := checkKeysDir(filePathRoot, *dir); err != nil {
+		log.Fatal(err)
+	}
+
+	switch {
+	case flags.NArg() == 1 && flags.Arg(0) == "new":
+		id, err := keys.Generate(*dir, *alg)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Created %s key %s in %s\n", *alg, id, *dir)
+	case flags.NArg() == 2 && flags.Arg(0) == "retire":
+		if err := keys.Retire(*dir, flags.Arg(1)); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("Retired key %s\n", flags.Arg(1))
+	default:
+		flags.Usage()
+		os.Exit(2)
+	}
+}
+
+// checkKeysDir returns an error if the key directory dir is inside root, the
+// directory served at /app, where anyone could download the private keys by
+// their IDs from the JWKS. Symlinks are followed as far as the paths exist.
+func checkKeysDir(root string, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	absRoot, err := resolvePath(root)
+	if err != nil {
+		return err
+	}
+	absDir, err := resolvePath(dir)
+	if err != nil {
+		return err
+	}
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil {
+		return nil
+	}
+	if rel == "." || (rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))) {
+		return fmt.Errorf("key directory %s is inside the served directory %s", dir, root)
+	}
+	return nil
+}
+
+// resolvePath returns the absolute form of path with the symlinks in its
+// longest existing prefix resolved.
+func resolvePath(path string) (string, error) {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	rest := ""
+	for {
+		resolved, err := filepath.EvalSymlinks(abs)
+		if err == nil {
+			return filepath.Join(resolved, rest), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(abs)
+		if parent == abs {
+			return filepath.Join(abs, rest), nil
+		}
+		rest = filepath.Join(filepath.Base(abs), rest)
+		abs = parent
+	}
+}
@@ -1,65 +1,241 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
 
 	"github.com/christopherplain/chirpy/internal/api"
+	"github.com/christopherplain/chirpy/internal/keys"
+	"github.com/christopherplain/chirpy/internal/media"
 	"github.com/christopherplain/chirpy/internal/model"
+	"github.com/christopherplain/chirpy/internal/moderation"
+	"github.com/christopherplain/chirpy/internal/oidc"
+	"github.com/christopherplain/chirpy/internal/preview"
 	"github.com/go-chi/chi/v5"
 	"github.com/joho/godotenv"
 )
 
+const (
+	jsonDBPath   = "database.json"
+	sqliteDBPath = "database.db"
+	// filePathRoot is the directory served at /app. It holds only public
+	// files, so the database and keys next to it are never served.
+	filePathRoot = "public"
+)
+
 func main() {
-	const filePathRoot = "."
 	const port = "8080"
-	const dbPath = "database.json"
 
 	godotenv.Load()
 
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrate(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "admin" {
+		runAdmin(os.Args[2:])
+		return
+	}
+	if len(os.Args) > 1 && os.Args[1] == "keys" {
+		runKeys(os.Args[2:])
+		return
+	}
+
 	dbg := flag.Bool("debug", false, "Enable debug mode")
+	store := flag.String("store", "json", "Storage backend (json or sqlite)")
+	syncPolicy := flag.String("sync", "always", "When the json store writes to disk (always, interval or shutdown)")
+	syncInterval := flag.Duration("sync-interval", time.Second, "Flush interval for the json store with --sync interval")
+	moderationConfig := flag.String("moderation", "", "Moderation config file (reloaded on SIGHUP)")
+	mediaDir := flag.String("media-dir", "media", "Directory for uploaded media")
+	keysDir := flag.String("keys", "", "Directory of token signing keys (reloaded on SIGHUP); JWT_SECRET is used if empty")
 	flag.Parse()
-	if *dbg {
-		model.ResetDB(dbPath)
+
+	policy, err := model.ParseSyncPolicy(*syncPolicy)
+	if err != nil {
+		log.Fatal(err)
+	}
+	dbCfg := model.DBConfig{
+		SyncPolicy:   policy,
+		SyncInterval: *syncInterval,
 	}
 
-	db, err := model.NewDB("database.json")
+	db, err := openStore(*store, dbCfg, *dbg)
+	if err != nil {
+		log.Fatal(err)
+	}
+	moderator, err := moderation.NewReloader(*moderationConfig)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := checkKeysDir(filePathRoot, *keysDir); err != nil {
+		log.Fatal(err)
+	}
+	ring, err := keys.NewRing(*keysDir, os.Getenv("JWT_SECRET"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	go reloadOnHangup(moderator, ring)
+	blobs, err := media.NewLocalStore(*mediaDir)
 	if err != nil {
 		log.Fatal(err)
 	}
+	fetcher := preview.NewHTTPFetcher(
+		durationEnv("PREVIEW_TIMEOUT", 5*time.Second),
+		int64(intEnv("PREVIEW_MAX_BYTES", 1<<20)),
+	)
+	previews := api.NewPreviewWorker(db, preview.NewCache(fetcher, time.Hour, 1000), 100)
 	apiCfg := api.ApiConfig{
-		DB:             db,
-		FileserverHits: 0,
-		JwtSecret:      os.Getenv("JWT_SECRET"),
-		PolkaKey:       os.Getenv("POLKA_KEY"),
+		DB:                 db,
+		FileserverHits:     0,
+		Keys:               ring,
+		Issuer:             strings.TrimSuffix(stringEnv("OAUTH_ISSUER", "http://localhost:"+port), "/"),
+		PolkaKey:           os.Getenv("POLKA_KEY"),
+		ChirpEditWindow:    durationEnv("CHIRP_EDIT_WINDOW", 15*time.Minute),
+		ChirpRestoreWindow: durationEnv("CHIRP_RESTORE_WINDOW", 7*24*time.Hour),
+		RefreshTokenTTL:    durationEnv("REFRESH_TOKEN_TTL", 60*24*time.Hour),
+		ChirpLimits: model.ChirpLimits{
+			Default:   intEnv("CHIRP_MAX_LENGTH", model.DefaultChirpLimits.Default),
+			ChirpyRed: intEnv("CHIRP_MAX_LENGTH_RED", model.DefaultChirpLimits.ChirpyRed),
+		},
+		Moderator:      moderator,
+		Blobs:          blobs,
+		MaxUploadBytes: int64(intEnv("MEDIA_MAX_BYTES", 5<<20)),
+		MaxImportBytes: int64(intEnv("IMPORT_MAX_BYTES", 100<<20)),
+		Previews:       previews,
+	}
+
+	if issuer := os.Getenv("OIDC_LOGIN_ISSUER"); issuer != "" {
+		apiCfg.OIDC = oidc.NewProvider(oidc.Config{
+			Issuer:       issuer,
+			ClientID:     os.Getenv("OIDC_LOGIN_CLIENT_ID"),
+			ClientSecret: os.Getenv("OIDC_LOGIN_CLIENT_SECRET"),
+			RedirectURL:  stringEnv("OIDC_LOGIN_REDIRECT_URL", apiCfg.Issuer+"/api/login/oidc/callback"),
+		})
+	}
+
+	// Clients verify ID tokens with the public keys in the JWKS, so the OAuth
+	// provider needs a key directory rather than the shared secret.
+	oauthEnabled := *keysDir != ""
+	if !oauthEnabled {
+		log.Println("OAuth provider disabled: it needs signing keys (--keys)")
 	}
 
 	router := chi.NewRouter()
-	fsHandler := apiCfg.MiddlewareMetricsInc(http.StripPrefix("/app", http.FileServer(http.Dir(filePathRoot))))
+	fsHandler := apiCfg.MiddlewareMetricsInc(appFileServer(filePathRoot))
 	router.Handle("/app", fsHandler)
 	router.Handle("/app/*", fsHandler)
+	router.Get("/app/media/{key}", apiCfg.HandleGetMedia)
+	router.Get("/.well-known/jwks.json", apiCfg.HandleJWKS)
 
 	apiRouter := chi.NewRouter()
 	apiRouter.Get("/healthz", handleReadiness)
 	apiRouter.Get("/reset", apiCfg.HandleReset)
-	apiRouter.Get("/chirps", apiCfg.HandleGetChirps)
-	apiRouter.Get("/chirps/{id}", apiCfg.HandleGetChirp)
-	apiRouter.Delete("/chirps/{id}", apiCfg.HandleDeleteChirp)
-	apiRouter.Post("/chirps", apiCfg.HandlePostChirp)
 	apiRouter.Post("/login", apiCfg.HandleUserLogin)
+	if apiCfg.OIDC != nil {
+		apiRouter.Get("/login/oidc", apiCfg.HandleOIDCLogin)
+		apiRouter.Get("/login/oidc/callback", apiCfg.HandleOIDCCallback)
+	}
 	apiRouter.Post("/polka/webhooks", apiCfg.HandlePolkaWebhook)
+	// Refresh and revoke take a refresh token rather than an access token.
 	apiRouter.Post("/refresh", apiCfg.HandleRefresh)
 	apiRouter.Post("/revoke", apiCfg.HandleRevoke)
 	apiRouter.Post("/users", apiCfg.HandlePostUser)
-	apiRouter.Put("/users", apiCfg.HandlePutUser)
+	apiRouter.Get("/users/{id}/followers", apiCfg.HandleGetFollowers)
+	apiRouter.Get("/users/{id}/following", apiCfg.HandleGetFollowing)
+	apiRouter.Get("/tags/trending", apiCfg.HandleGetTrendingTags)
+
+	// Anyone can read chirps; signed-in users also see which they liked.
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.OptionalAuth)
+		r.Get("/chirps", apiCfg.HandleGetChirps)
+		r.Get("/chirps/search", apiCfg.HandleSearchChirps)
+		r.Get("/chirps/{id}", apiCfg.HandleGetChirp)
+		r.Get("/chirps/{id}/history", apiCfg.HandleGetChirpHistory)
+		r.Get("/chirps/{id}/thread", apiCfg.HandleGetThread)
+		r.Get("/users/{id}/mentions", apiCfg.HandleGetMentions)
+		r.Get("/tags/{tag}/chirps", apiCfg.HandleGetTagChirps)
+	})
+
+	// Tokens issued to OAuth clients only reach the routes their scopes
+	// cover, and never the account routes.
+	apiRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.RequireAuth)
+		r.Group(func(r chi.Router) {
+			r.Use(api.RequireScope(model.ScopeChirpsRead))
+			r.Get("/chirps/pending", apiCfg.HandleGetPendingChirps)
+			r.Get("/timeline", apiCfg.HandleGetTimeline)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RequireScope(model.ScopeChirpsWrite))
+			r.Post("/chirps", apiCfg.HandlePostChirp)
+			r.Delete("/chirps/{id}", apiCfg.HandleDeleteChirp)
+			r.Patch("/chirps/{id}", apiCfg.HandlePatchChirp)
+			r.Post("/chirps/{id}/restore", apiCfg.HandleRestoreChirp)
+			r.Post("/chirps/{id}/like", apiCfg.HandleLikeChirp)
+			r.Delete("/chirps/{id}/like", apiCfg.HandleUnlikeChirp)
+			r.Post("/chirps/{id}/report", apiCfg.HandleReportChirp)
+			r.Post("/chirps/{id}/rechirp", apiCfg.HandleRechirp)
+			r.Delete("/chirps/{id}/rechirp", apiCfg.HandleUndoRechirp)
+			r.Put("/chirps/pending/{id}", apiCfg.HandlePutPendingChirp)
+			r.Delete("/chirps/pending/{id}", apiCfg.HandleDeletePendingChirp)
+			r.Post("/media", apiCfg.HandlePostMedia)
+			r.Post("/users/{id}/follow", apiCfg.HandleFollowUser)
+			r.Delete("/users/{id}/follow", apiCfg.HandleUnfollowUser)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(api.RequireFirstParty)
+			r.Put("/users", apiCfg.HandlePutUser)
+			r.Get("/users/me/export", apiCfg.HandleExportUser)
+			r.Post("/users/me/import", apiCfg.HandleImportUser)
+			r.Get("/sessions", apiCfg.HandleGetSessions)
+			r.Delete("/sessions/{id}", apiCfg.HandleDeleteSession)
+		})
+	})
 	router.Mount("/api", apiRouter)
 
 	adminRouter := chi.NewRouter()
 	adminRouter.Get("/metrics", apiCfg.HandleMetrics)
+	adminRouter.Group(func(r chi.Router) {
+		r.Use(apiCfg.RequireAdmin)
+		r.Get("/reports", apiCfg.HandleGetReviewQueue)
+		r.Post("/chirps/{id}/approve", apiCfg.HandleReviewChirp(model.ReviewApprove))
+		r.Post("/chirps/{id}/hide", apiCfg.HandleReviewChirp(model.ReviewHide))
+		r.Post("/chirps/{id}/delete", apiCfg.HandleReviewChirp(model.ReviewDelete))
+		r.Get("/audit", apiCfg.HandleGetAuditLog)
+		r.Post("/purge", apiCfg.HandlePurgeChirps)
+		if oauthEnabled {
+			r.Post("/oauth/clients", apiCfg.HandleCreateOAuthClient)
+			r.Get("/oauth/clients", apiCfg.HandleGetOAuthClients)
+			r.Delete("/oauth/clients/{id}", apiCfg.HandleDeleteOAuthClient)
+		}
+	})
 	router.Mount("/admin", adminRouter)
 
+	if oauthEnabled {
+		router.Get("/.well-known/openid-configuration", apiCfg.HandleOpenIDConfiguration)
+		oauthRouter := chi.NewRouter()
+		oauthRouter.Get("/authorize", apiCfg.HandleAuthorize)
+		oauthRouter.Post("/authorize", apiCfg.HandleAuthorizeDecision)
+		oauthRouter.Post("/token", apiCfg.HandleOAuthToken)
+		oauthRouter.Group(func(r chi.Router) {
+			r.Use(apiCfg.RequireAuth, api.RequireScope(model.ScopeOpenID))
+			r.Get("/userinfo", apiCfg.HandleUserInfo)
+			r.Post("/userinfo", apiCfg.HandleUserInfo)
+		})
+		router.Mount("/oauth", oauthRouter)
+	}
+
 	corsMux := middlewareCors(router)
 
 	srv := &http.Server{
@@ -67,6 +243,129 @@ func main() {
 		Handler: corsMux,
 	}
 
-	log.Printf("Serving on port: %s\n", port)
-	log.Fatal(srv.ListenAndServe())
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var workers sync.WaitGroup
+	workers.Add(5)
+	go func() {
+		defer workers.Done()
+		apiCfg.RunMediaJanitor(ctx, time.Hour, durationEnv("UNATTACHED_MEDIA_TTL", 24*time.Hour))
+	}()
+	go func() {
+		defer workers.Done()
+		previews.Run(ctx)
+	}()
+	go func() {
+		defer workers.Done()
+		apiCfg.RunScheduler(ctx, durationEnv("SCHEDULER_INTERVAL", 15*time.Second))
+	}()
+	go func() {
+		defer workers.Done()
+		apiCfg.RunPurger(ctx, time.Hour)
+	}()
+	go func() {
+		defer workers.Done()
+		apiCfg.RunSessionPruner(ctx, time.Hour)
+	}()
+
+	go func() {
+		log.Printf("Serving on port: %s\n", port)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+	log.Println("Shutting down")
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %s\n", err)
+	}
+	workers.Wait()
+	if err := db.Close(); err != nil {
+		log.Printf("Error closing database: %s\n", err)
+	}
+}
+
+func openStore(backend string, cfg model.DBConfig, reset bool) (model.Store, error) {
+	switch backend {
+	case "json":
+		if reset {
+			model.ResetDB(jsonDBPath)
+		}
+		return model.NewDB(jsonDBPath, cfg)
+	case "sqlite":
+		if reset {
+			model.ResetSQLiteDB(sqliteDBPath)
+		}
+		return model.NewSQLiteDB(sqliteDBPath)
+	default:
+		return nil, fmt.Errorf("unknown store %q", backend)
+	}
+}
+
+// appFileServer serves the files in root at /app.
+func appFileServer(root string) http.Handler {
+	return http.StripPrefix("/app", http.FileServer(http.Dir(root)))
+}
+
+// reloadOnHangup reloads the moderation config and the signing keys each
+// time the process receives SIGHUP.
+func reloadOnHangup(moderator *moderation.Reloader, ring *keys.Ring) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	for range hangup {
+		if err := moderator.Reload(); err != nil {
+			log.Printf("Error reloading moderation config: %s\n", err)
+		} else {
+			log.Println("Reloaded moderation config")
+		}
+		if err := ring.Reload(); err != nil {
+			log.Printf("Error reloading signing keys: %s\n", err)
+		} else if id := ring.SigningKeyID(); id != "" {
+			log.Printf("Reloaded signing keys, signing with %s\n", id)
+		}
+	}
+}
+
+// stringEnv reads a string from the environment, falling back to def when
+// the variable is unset.
+func stringEnv(key string, def string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return def
+}
+
+// durationEnv reads a duration such as "15m" from the environment, falling
+// back to def when the variable is unset or invalid.
+func durationEnv(key string, def time.Duration) time.Duration {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Printf("Invalid %s %q, using %s\n", key, value, def)
+		return def
+	}
+	return d
+}
+
+// intEnv reads a positive integer from the environment, falling back to def
+// when the variable is unset or invalid.
+func intEnv(key string, def int) int {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Printf("Invalid %s %q, using %d\n", key, value, def)
+		return def
+	}
+	return n
 }
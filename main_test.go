@@ -0,0 +1,80 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/christopherplain/chirpy/internal/keys"
+)
+
+func TestCheckKeysDir(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "public")
+	if err := os.MkdirAll(filepath.Join(root, "assets"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(root, "assets"), filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, keysDir := range []string{
+		root,
+		filepath.Join(root, "keys"),
+		filepath.Join(root, "assets", "keys"),
+		filepath.Join(dir, "link", "keys"),
+		filepath.Join(dir, "keys", "..", "public", "keys"),
+	} {
+		if err := checkKeysDir(root, keysDir); err == nil {
+			t.Errorf("%s: accepted a key directory inside the served directory", keysDir)
+		}
+	}
+	for _, keysDir := range []string{
+		"",
+		dir,
+		filepath.Join(dir, "keys"),
+		filepath.Join(dir, "public-keys"),
+	} {
+		if err := checkKeysDir(root, keysDir); err != nil {
+			t.Errorf("%s: %s", keysDir, err)
+		}
+	}
+}
+
+// TestAppFileServerHidesKeys lays out a web root and a key directory the way
+// the README does and checks that the keys can't be fetched through /app.
+func TestAppFileServerHidesKeys(t *testing.T) {
+	dir := t.TempDir()
+	root := filepath.Join(dir, filePathRoot)
+	if err := os.MkdirAll(root, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(root, "index.html"), []byte("Welcome to Chirpy"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	id, err := keys.Generate(filepath.Join(dir, "keys"), "EdDSA")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handler := appFileServer(root)
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+		return w.Code
+	}
+	if code := get("/app/"); code != http.StatusOK {
+		t.Fatalf("/app/: got %d, want 200", code)
+	}
+	for _, path := range []string{
+		"/app/keys/" + id + ".pem",
+		"/app/../keys/" + id + ".pem",
+		"/app/%2e%2e/keys/" + id + ".pem",
+	} {
+		if code := get(path); code == http.StatusOK {
+			t.Errorf("%s was served", path)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+
+	"github.com/christopherplain/chirpy/internal/model"
+)
+
+// runMigrate implements the "chirpy migrate" subcommand, which upgrades the
+// database schema without starting the server.
+func runMigrate(args []string) {
+	flags := flag.NewFlagSet("migrate", flag.ExitOnError)
+	store := flags.String("store", "json", "Storage backend (json or sqlite)")
+	path := flags.String("path", "", "Database file (defaults to the store's standard file)")
+	dryRun := flags.Bool("dry-run", false, "Report pending migrations without applying them")
+	flags.Parse(args)
+
+	var report model.MigrationReport
+	var err error
+	switch *store {
+	case "json":
+		if *path == "" {
+			*path = jsonDBPath
+		}
+		report, err = model.MigrateDB(*path, *dryRun)
+	case "sqlite":
+		if *path == "" {
+			*path = sqliteDBPath
+		}
+		report, err = model.MigrateSQLiteDB(*path, *dryRun)
+	default:
+		err = fmt.Errorf("unknown store %q", *store)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println(report)
+}